@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dstout-devops/hephaestus/internal/command"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// newConfigCmd builds the config subcommand and its children.
+func newConfigCmd(a *app) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Work with the hephaestus configuration",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.Help()
+		},
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration and report every invalid field",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := a.loader.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("%w: %w", command.ErrConfig, err)
+			}
+			if err := command.ValidateConfig(cfg, config.AllSections); err != nil {
+				return fmt.Errorf("%w: %w", command.ErrConfig, err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "configuration is valid")
+			return nil
+		},
+	})
+	return cmd
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// newCSRCmd builds the csr subcommand.
+func newCSRCmd(a *app) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "csr",
+		Short: "Generate a CSR from key.input or a new key and write it to csr.output",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := a.command()
+			if err != nil {
+				return err
+			}
+			c.Require(config.SectionKey | config.SectionCSR)
+			if err := c.LoadConfig(cmd.Context()); err != nil {
+				return err
+			}
+			if err := c.PrepareKey(cmd.Context()); err != nil {
+				return err
+			}
+			if err := c.GenerateCSR(cmd.Context()); err != nil {
+				return err
+			}
+			return c.WriteCSRToFile(cmd.Context(), "")
+		},
+	}
+	addKeyFlags(cmd.Flags())
+	addSubjectFlags(cmd.Flags())
+	return cmd
+}
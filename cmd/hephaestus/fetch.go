@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// newFetchCmd builds the fetch subcommand.
+func newFetchCmd(a *app) *cobra.Command {
+	var requestID string
+	cmd := &cobra.Command{
+		Use:   "fetch",
+		Short: "Fetch a previously requested certificate and write it to certificate.output",
+		Long: `Fetch a previously requested certificate and write it to certificate.output.
+
+Without --request-id, the request saved to pending.file when the CA accepted
+it without issuing a certificate is fetched, using the key and CSR it was made
+with. While the request is pending, fetch checks again every
+pending.poll_interval until pending.poll_timeout has passed. A request the CA
+rejected is removed from pending.file, so the next renew makes a new one.`,
+		Args: usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := a.command()
+			if err != nil {
+				return err
+			}
+			c.Require(config.SectionKey | config.SectionCA)
+			if err := c.LoadConfig(cmd.Context()); err != nil {
+				return err
+			}
+			if requestID == "" {
+				req, err := c.Pending()
+				if err != nil {
+					return err
+				}
+				if req == nil {
+					return &usageError{err: errors.New("no pending request found, --request-id is required")}
+				}
+				return c.Resume(cmd.Context(), req, true)
+			}
+			if err := c.PollCertificate(cmd.Context(), requestID); err != nil {
+				return err
+			}
+			if err := c.VerifyCertificate(cmd.Context()); err != nil {
+				return err
+			}
+			return c.WriteCertificateToFile(cmd.Context(), "")
+		},
+	}
+	cmd.Flags().StringVar(&requestID, "request-id", "", "request ID returned by the CA (default the pending request)")
+	addSubmitFlags(cmd.Flags())
+	return cmd
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/spf13/pflag"
+)
+
+// configKeys maps command-line flags to the configuration keys they override.
+var configKeys = map[string]string{
+	"key-type":       "key.type",
+	"key-bits":       "key.bits",
+	"key-curve":      "key.curve",
+	"key-in":         "key.input",
+	"key-out":        "key.output",
+	"key-format":     "key.format",
+	"key-prompt":     "key.encryption.passphrase.prompt",
+	"cn":             "csr.common_name",
+	"org":            "csr.organization",
+	"ou":             "csr.organizational_unit",
+	"country":        "csr.country",
+	"state":          "csr.state",
+	"locality":       "csr.locality",
+	"dns":            "csr.dns_names",
+	"ip":             "csr.ip_addresses",
+	"email":          "csr.email_addresses",
+	"uri":            "csr.uris",
+	"key-usage":      "csr.key_usage",
+	"ext-key-usage":  "csr.extended_key_usage",
+	"csr-out":        "csr.output",
+	"backend":        "backend",
+	"endpoint":       "endpoint",
+	"program-id":     "esf.program_id",
+	"service-id":     "esf.service_id",
+	"application-id": "esf.application_id",
+	"cert-out":       "certificate.output",
+	"cert-format":    "certificate.format",
+	"log-level":      "log.level",
+	"log-format":     "log.format",
+}
+
+// bindFlags binds every flag in fs that has a configuration key.
+func bindFlags(loader *config.ViperConfigLoader, fs *pflag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *pflag.Flag) {
+		key, ok := configKeys[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		err = loader.BindFlag(key, f)
+	})
+	return err
+}
+
+// addLogFlags registers flags controlling logging.
+func addLogFlags(fs *pflag.FlagSet) {
+	fs.String("log-level", "", "log level: debug, info, warn or error (overrides log.level)")
+	fs.String("log-format", "", "log format: text or json (overrides log.format)")
+}
+
+// addKeyGenFlags registers flags controlling key generation.
+func addKeyGenFlags(fs *pflag.FlagSet) {
+	fs.String("key-type", "", "key type: rsa, ecdsa or ed25519 (overrides key.type)")
+	fs.Int("key-bits", 0, "RSA key size in bits (overrides key.bits)")
+	fs.String("key-curve", "", "ECDSA curve: P-256, P-384 or P-521 (overrides key.curve)")
+	fs.String("key-out", "", "private key output path (overrides key.output)")
+	fs.String("key-format", "", "private key encoding: pkcs8, pkcs1, sec1 or openssh (overrides key.format)")
+	fs.Bool("key-prompt", false, "prompt for a passphrase to encrypt the private key (sets key.encryption.passphrase.prompt)")
+}
+
+// addKeyFlags registers flags controlling key generation or reuse.
+func addKeyFlags(fs *pflag.FlagSet) {
+	addKeyGenFlags(fs)
+	fs.String("key-in", "", "existing PEM or OpenSSH private key to reuse (overrides key.input)")
+}
+
+// addSubjectFlags registers flags controlling the CSR subject and SANs.
+func addSubjectFlags(fs *pflag.FlagSet) {
+	fs.String("cn", "", "subject common name (overrides csr.common_name)")
+	fs.String("org", "", "subject organization (overrides csr.organization)")
+	fs.String("ou", "", "subject organizational unit (overrides csr.organizational_unit)")
+	fs.String("country", "", "subject country (overrides csr.country)")
+	fs.String("state", "", "subject state or province (overrides csr.state)")
+	fs.String("locality", "", "subject locality (overrides csr.locality)")
+	fs.StringSlice("dns", nil, "DNS SAN, repeatable (overrides csr.dns_names)")
+	fs.StringSlice("ip", nil, "IP address SAN, repeatable (overrides csr.ip_addresses)")
+	fs.StringSlice("email", nil, "email SAN, repeatable (overrides csr.email_addresses)")
+	fs.StringSlice("uri", nil, "URI SAN, repeatable (overrides csr.uris)")
+	fs.StringSlice("key-usage", nil, "requested key usage, e.g. digital_signature, repeatable (overrides csr.key_usage)")
+	fs.StringSlice("ext-key-usage", nil, "requested extended key usage, e.g. server_auth, repeatable (overrides csr.extended_key_usage)")
+	fs.String("csr-out", "", "CSR output path (overrides csr.output)")
+}
+
+// addSubmitFlags registers flags controlling CA submission.
+func addSubmitFlags(fs *pflag.FlagSet) {
+	fs.String("backend", "", "CA backend: esf, acme, est, scep or vault (overrides backend)")
+	fs.String("endpoint", "", "CA endpoint URL (overrides endpoint)")
+	fs.String("program-id", "", "ESF program ID (overrides esf.program_id)")
+	fs.String("service-id", "", "ESF service ID (overrides esf.service_id)")
+	fs.String("application-id", "", "ESF application ID (overrides esf.application_id)")
+	fs.String("cert-out", "", "certificate output path (overrides certificate.output)")
+	fs.String("cert-format", "", "certificate output format: pem or pkcs12 (overrides certificate.format)")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// overrideUsage matches the config key named in a flag's usage text.
+var overrideUsage = regexp.MustCompile(`\((?:overrides|sets) ([a-z0-9_.]+)\)`)
+
+// TestConfigKeys tests that every flag documented as overriding a config key
+// is bound to that key, and that every bound flag is registered.
+func TestConfigKeys(t *testing.T) {
+	registered := map[string]bool{}
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		visit := func(f *pflag.Flag) {
+			registered[f.Name] = true
+			m := overrideUsage.FindStringSubmatch(f.Usage)
+			if m == nil {
+				return
+			}
+			assert.Equal(t, m[1], configKeys[f.Name], "Flag --%s of %q should be bound to its config key", f.Name, cmd.Name())
+		}
+		cmd.LocalFlags().VisitAll(visit)
+		cmd.PersistentFlags().VisitAll(visit)
+		for _, sub := range cmd.Commands() {
+			walk(sub)
+		}
+	}
+	walk(newRootCmd(newApp()))
+
+	for name := range configKeys {
+		assert.True(t, registered[name], "Bound flag --%s is not registered by any command", name)
+	}
+}
+
+// TestBindFlags tests that bound flags override the config file.
+func TestBindFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(path, []byte("esf:\n  program_id: \"1\"\n  service_id: \"1\"\n  application_id: \"1\"\n"), 0644))
+
+	fs := pflag.NewFlagSet("submit", pflag.ContinueOnError)
+	addSubmitFlags(fs)
+	require.NoError(t, fs.Parse([]string{"--program-id", "7", "--service-id", "8", "--application-id", "9", "--backend", "vault"}))
+
+	loader := config.NewViperConfigLoader()
+	loader.SetConfigFile(path)
+	require.NoError(t, bindFlags(loader, fs))
+	cfg, err := loader.LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, config.ESFConfig{ProgramID: "7", ServiceID: "8", ApplicationID: "9"}, cfg.ESF)
+	assert.Equal(t, "vault", cfg.Backend)
+}
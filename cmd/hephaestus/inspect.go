@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/dstout-devops/hephaestus/internal/inspect"
+	"github.com/dstout-devops/hephaestus/internal/secret"
+	"github.com/spf13/cobra"
+)
+
+// newInspectCmd builds the inspect subcommand.
+func newInspectCmd() *cobra.Command {
+	var format string
+	var password config.PassphraseConfig
+	cmd := &cobra.Command{
+		Use:   "inspect FILE...",
+		Short: "Print a summary of keys, CSRs, certificates and PKCS#12 bundles",
+		Long: `Print a summary of keys, CSRs, certificates and PKCS#12 bundles.
+
+Each file may hold PEM blocks, DER or a PKCS#12 bundle; the type is detected
+from its content. Certificates are checked against any issuer in the same
+file, CSRs against their own key. The password for PKCS#12 bundles and
+encrypted private keys is read from --password-env or --password-file.`,
+		Args: usageArgs(cobra.MinimumNArgs(1)),
+		PreRunE: func(*cobra.Command, []string) error {
+			if format != "text" && format != "json" {
+				return &usageError{err: fmt.Errorf("invalid --format %q: expected text or json", format)}
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pass, err := secret.Resolve(password)
+			if err != nil {
+				return fmt.Errorf("failed to read password: %w", err)
+			}
+			out := cmd.OutOrStdout()
+			var all []inspect.Summary
+			for i, path := range args {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				summaries, err := inspect.Inspect(data, pass)
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				if format == "json" {
+					for j := range summaries {
+						summaries[j].File = path
+					}
+					all = append(all, summaries...)
+					continue
+				}
+				if len(args) > 1 {
+					if i > 0 {
+						fmt.Fprintln(out)
+					}
+					fmt.Fprintf(out, "==> %s <==\n", path)
+				}
+				if err := inspect.WriteText(out, summaries); err != nil {
+					return err
+				}
+			}
+			if format == "json" {
+				return inspect.WriteJSON(out, all)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text or json")
+	cmd.Flags().StringVar(&password.Env, "password-env", "", "environment variable holding the PKCS#12 or private key password")
+	cmd.Flags().StringVar(&password.File, "password-file", "", "file holding the PKCS#12 or private key password")
+	return cmd
+}
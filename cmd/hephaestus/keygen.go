@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// newKeygenCmd builds the keygen subcommand.
+func newKeygenCmd(a *app) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate a private key and write it to key.output",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := a.command()
+			if err != nil {
+				return err
+			}
+			c.Require(config.SectionKey)
+			if err := c.LoadConfig(cmd.Context()); err != nil {
+				return err
+			}
+			if err := c.GenerateKey(cmd.Context()); err != nil {
+				return err
+			}
+			return c.WriteKeyToFile(cmd.Context(), "")
+		},
+	}
+	addKeyGenFlags(cmd.Flags())
+	return cmd
+}
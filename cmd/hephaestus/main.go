@@ -1,18 +1,51 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	_ "github.com/dstout-devops/hephaestus/internal/builtins"
 	"github.com/dstout-devops/hephaestus/internal/command"
-	// _ "github.com/dstout-devops/hephaestus/internal/builtins"
 )
 
-func main() {
-	cmd := command.NewCommand(nil, nil, nil, nil)
+// Exit codes returned by hephaestus.
+const (
+	exitOK      = 0 // Success
+	exitFailure = 1 // The operation failed
+	exitUsage   = 2 // Invalid command, flags or arguments
+	exitConfig  = 3 // The configuration could not be loaded
+	exitPending = 4 // The CA accepted the request but has not issued the certificate yet
+)
 
-	if err := cmd.Run(); err != nil {
+func main() {
+	// SIGINT and SIGTERM cancel the context so long-running commands shut down cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	a := newApp()
+	err := newRootCmd(a).ExecuteContext(ctx)
+	a.Close()
+	stop()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "hephaestus: %s\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
+	}
+	os.Exit(exitOK)
+}
+
+// exitCode maps an error returned by a subcommand to a process exit code.
+func exitCode(err error) int {
+	var uerr *usageError
+	switch {
+	case errors.As(err, &uerr):
+		return exitUsage
+	case errors.Is(err, command.ErrConfig):
+		return exitConfig
+	case errors.Is(err, command.ErrPending):
+		return exitPending
+	default:
+		return exitFailure
 	}
 }
@@ -0,0 +1,32 @@
+package main
+
+import "github.com/spf13/cobra"
+
+// newRenewCmd builds the renew subcommand.
+func newRenewCmd(a *app) *cobra.Command {
+	var watch bool
+	cmd := &cobra.Command{
+		Use:   "renew",
+		Short: "Prepare a key, generate a CSR, submit it and write the certificate",
+		Long: `Prepare a key, generate a CSR, submit it and write the certificate.
+
+With --watch, run until interrupted, re-reading certificate.output and
+renewing it when due according to the renew section of the config.`,
+		Args: usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := a.command()
+			if err != nil {
+				return err
+			}
+			if watch {
+				return c.Watch(cmd.Context())
+			}
+			return c.Run(cmd.Context())
+		},
+	}
+	cmd.Flags().BoolVar(&watch, "watch", false, "keep running and renew the certificate when due")
+	addKeyFlags(cmd.Flags())
+	addSubjectFlags(cmd.Flags())
+	addSubmitFlags(cmd.Flags())
+	return cmd
+}
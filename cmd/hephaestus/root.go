@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dstout-devops/hephaestus/internal/command"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/dstout-devops/hephaestus/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+// app holds state shared by all subcommands.
+type app struct {
+	loader     *config.ViperConfigLoader
+	configPath string
+	overrides  []string
+	logCloser  io.Closer
+}
+
+// newApp creates an app with a fresh config loader.
+func newApp() *app {
+	return &app{loader: config.NewViperConfigLoader()}
+}
+
+// command creates a Command that loads configuration through the shared loader
+// and logs as described by the log section of the config.
+func (a *app) command() (*command.Command, error) {
+	cfg, err := a.loader.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", command.ErrConfig, err)
+	}
+	log, closer, err := logger.NewFromConfig(cfg.Log)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", command.ErrConfig, err)
+	}
+	a.logCloser = closer
+	return command.NewCommand(log, nil, a.loader, nil, nil), nil
+}
+
+// Close releases resources held by the app, such as the log file.
+func (a *app) Close() error {
+	if a.logCloser == nil {
+		return nil
+	}
+	return a.logCloser.Close()
+}
+
+// newRootCmd builds the hephaestus command tree.
+func newRootCmd(a *app) *cobra.Command {
+	root := &cobra.Command{
+		Use:   "hephaestus",
+		Short: "Generate private keys and CSRs and enroll certificates with a CA",
+		Long: `Generate private keys and CSRs and enroll certificates with a CA.
+
+Every config value can be overridden. In order of precedence:
+  --set key=value       any config key, e.g. --set csr.common_name=host.example.com
+  command flags         e.g. --cn host.example.com
+  HEPHAESTUS_* env      e.g. HEPHAESTUS_CSR_COMMON_NAME=host.example.com
+  config file
+List values given through --set or the environment are comma separated. Lists
+of sections, csr.extensions and csr.attributes, are read from the file only.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.Help()
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			if a.configPath != "" {
+				a.loader.SetConfigFile(a.configPath)
+			}
+			for _, o := range a.overrides {
+				if err := a.loader.Override(o); err != nil {
+					return &usageError{err: err}
+				}
+			}
+			return bindFlags(a.loader, cmd.Flags())
+		},
+	}
+	root.PersistentFlags().StringVarP(&a.configPath, "config", "c", "", "config file (default $CONFIG_PATH or ./config.yml)")
+	root.PersistentFlags().StringArrayVar(&a.overrides, "set", nil, "override a config key as key=value, repeatable")
+	addLogFlags(root.PersistentFlags())
+	root.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return &usageError{err: err}
+	})
+
+	root.AddCommand(
+		newKeygenCmd(a),
+		newCSRCmd(a),
+		newSubmitCmd(a),
+		newFetchCmd(a),
+		newInspectCmd(),
+		newRenewCmd(a),
+		newConfigCmd(a),
+	)
+	return root
+}
+
+// usageError marks an error caused by invalid command-line usage.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// usageArgs wraps a positional argument validator so its errors are reported as usage errors.
+func usageArgs(fn cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := fn(cmd, args); err != nil {
+			return &usageError{err: err}
+		}
+		return nil
+	}
+}
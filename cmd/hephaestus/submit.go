@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// newSubmitCmd builds the submit subcommand.
+func newSubmitCmd(a *app) *cobra.Command {
+	var csrPath string
+	cmd := &cobra.Command{
+		Use:   "submit",
+		Short: "Submit an existing CSR to the CA and write the certificate to certificate.output",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			c, err := a.command()
+			if err != nil {
+				return err
+			}
+			c.Require(config.SectionKey | config.SectionCA)
+			if err := c.LoadConfig(cmd.Context()); err != nil {
+				return err
+			}
+			if csrPath == "" {
+				csrPath = c.Config().CSR.Output
+			}
+			if err := c.LoadCSR(cmd.Context(), csrPath); err != nil {
+				return err
+			}
+			if err := c.SubmitCSR(cmd.Context()); err != nil {
+				return err
+			}
+			if err := c.VerifyCertificate(cmd.Context()); err != nil {
+				return err
+			}
+			return c.WriteCertificateToFile(cmd.Context(), "")
+		},
+	}
+	cmd.Flags().StringVar(&csrPath, "csr-in", "", "CSR to submit (default csr.output)")
+	addSubmitFlags(cmd.Flags())
+	return cmd
+}
@@ -0,0 +1,245 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/dstout-devops/hephaestus/internal/keys"
+	"github.com/dstout-devops/hephaestus/internal/transport"
+	xacme "golang.org/x/crypto/acme"
+)
+
+// Client enrolls certificates with an RFC 8555 ACME server.
+type Client struct {
+	httpClient *http.Client
+	cfg        config.ACMEConfig
+	retry      config.RetryConfig
+	solver     Solver
+}
+
+// NewClient creates a new Client. A nil httpClient uses http.DefaultClient and a
+// nil solver is built from the challenge settings in cfg. Failed ACME requests
+// are retried as described by retry, so httpClient should not retry itself.
+func NewClient(httpClient *http.Client, cfg config.ACMEConfig, retry config.RetryConfig, solver Solver) (*Client, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if solver == nil {
+		var err error
+		if solver, err = NewSolver(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return &Client{httpClient: httpClient, cfg: cfg, retry: retry, solver: solver}, nil
+}
+
+// Submit registers or looks up the ACME account, orders a certificate for the
+// names in the PEM-encoded CSR, solves the challenges, finalizes the order with
+// the CSR and downloads the certificate chain. Challenge validation is waited
+// for until ctx is done, which is bounded by retry.timeout.
+func (c *Client) Submit(ctx context.Context, csrPEM []byte) (*certs.Bundle, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("failed to decode CSR")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSR: %w", err)
+	}
+	ids := identifiers(csr)
+	if len(ids) == 0 {
+		return nil, errors.New("CSR contains no DNS names or IP addresses to order")
+	}
+
+	client, err := c.register(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err := c.authorize(ctx, client, authzURL); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("order not ready: %w", err)
+	}
+
+	der, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr.Raw, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finalize order: %w", err)
+	}
+	return bundleFromDER(der)
+}
+
+// register loads the account key and makes sure the account exists.
+func (c *Client) register(ctx context.Context) (*xacme.Client, error) {
+	if c.cfg.DirectoryURL == "" {
+		return nil, errors.New("no ACME directory URL configured")
+	}
+	key, err := loadOrCreateAccountKey(c.cfg.AccountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &xacme.Client{
+		Key:          key,
+		DirectoryURL: c.cfg.DirectoryURL,
+		HTTPClient:   c.httpClient,
+		UserAgent:    "hephaestus",
+		RetryBackoff: c.retryBackoff,
+	}
+
+	acct := &xacme.Account{}
+	if c.cfg.Email != "" {
+		acct.Contact = []string{"mailto:" + c.cfg.Email}
+	}
+	prompt := func(string) bool { return c.cfg.AcceptTOS }
+	if _, err := client.Register(ctx, acct, prompt); err != nil && !errors.Is(err, xacme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+	return client, nil
+}
+
+// retryBackoff applies the retry policy to the ACME client's own retries,
+// which sign every attempt with a fresh nonce. At least one retry is allowed
+// so a rejected nonce can always be replaced.
+func (c *Client) retryBackoff(n int, _ *http.Request, resp *http.Response) time.Duration {
+	if n >= max(c.retry.MaxAttempts, 2) {
+		return -1
+	}
+	return max(transport.Backoff(c.retry, n, resp), time.Nanosecond) // Zero would stop retrying
+}
+
+// authorize satisfies a single authorization with the configured challenge type.
+func (c *Client) authorize(ctx context.Context, client *xacme.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("failed to get authorization: %w", err)
+	}
+	if authz.Status == xacme.StatusValid {
+		return nil
+	}
+
+	challengeType := c.cfg.Challenge
+	if challengeType == "" {
+		challengeType = ChallengeHTTP01
+	}
+	var chal *xacme.Challenge
+	for _, ch := range authz.Challenges {
+		if ch.Type == challengeType {
+			chal = ch
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no %s challenge offered for %s", challengeType, authz.Identifier.Value)
+	}
+
+	challenge := Challenge{
+		Type:   chal.Type,
+		Domain: authz.Identifier.Value,
+		Token:  chal.Token,
+	}
+	switch chal.Type {
+	case ChallengeHTTP01:
+		challenge.Value, err = client.HTTP01ChallengeResponse(chal.Token)
+	case ChallengeDNS01:
+		challenge.Value, err = client.DNS01ChallengeRecord(chal.Token)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to compute challenge response: %w", err)
+	}
+
+	if err := c.solver.Present(challenge); err != nil {
+		return fmt.Errorf("failed to present %s challenge for %s: %w", chal.Type, challenge.Domain, err)
+	}
+	defer c.solver.CleanUp(challenge)
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("failed to accept challenge: %w", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorization for %s failed: %w", challenge.Domain, err)
+	}
+	return nil
+}
+
+// identifiers lists the order identifiers for a CSR. The common name is used
+// only when the CSR has no SANs.
+func identifiers(csr *x509.CertificateRequest) []xacme.AuthzID {
+	ids := xacme.DomainIDs(csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		ids = append(ids, xacme.IPIDs(ip.String())...)
+	}
+	if len(ids) == 0 && csr.Subject.CommonName != "" {
+		ids = xacme.DomainIDs(csr.Subject.CommonName)
+	}
+	return ids
+}
+
+// loadOrCreateAccountKey reads the ACME account key, creating and saving a new
+// ECDSA P-256 key the first time.
+func loadOrCreateAccountKey(path string) (crypto.Signer, error) {
+	if path == "" {
+		return nil, errors.New("no ACME account key path configured")
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := keys.GenerateECDSAKey("P-256")
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ACME account key: %w", err)
+		}
+		pemKey, err := keys.SerializePrivateKey(key, "")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, pemKey, 0600); err != nil {
+			return nil, fmt.Errorf("failed to save ACME account key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACME account key: %w", err)
+	}
+
+	key, err := keys.ParsePrivateKey(data, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ACME account key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("ACME account key does not implement crypto.Signer")
+	}
+	return signer, nil
+}
+
+// bundleFromDER builds a Bundle from a DER-encoded leaf-first chain.
+func bundleFromDER(der [][]byte) (*certs.Bundle, error) {
+	var chain []*x509.Certificate
+	for _, b := range der {
+		cert, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate returned")
+	}
+	return &certs.Bundle{Certificate: chain[0], Chain: chain[1:]}, nil
+}
@@ -0,0 +1,358 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeACME is a minimal RFC 8555 server in the spirit of Pebble. It does not
+// verify JWS signatures or validate challenges; accepting a challenge marks its
+// authorization valid.
+type fakeACME struct {
+	t      *testing.T
+	srv    *httptest.Server
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+
+	mu         sync.Mutex
+	accounts   int
+	identifier []map[string]string
+	authzValid []bool
+	issued     []byte // PEM chain once the order is finalized
+}
+
+func newFakeACME(t *testing.T) *fakeACME {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	f := &fakeACME{t: t, caKey: caKey, caCert: caCert}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// payload decodes the JWS payload of a request body.
+func (f *fakeACME) payload(r *http.Request) []byte {
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+	require.NoError(f.t, json.NewDecoder(r.Body).Decode(&jws))
+	data, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	require.NoError(f.t, err)
+	return data
+}
+
+func (f *fakeACME) reply(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeACME) order() map[string]any {
+	status := "ready"
+	var authzs []string
+	for i, valid := range f.authzValid {
+		authzs = append(authzs, fmt.Sprintf("%s/authz/%d", f.srv.URL, i))
+		if !valid {
+			status = "pending"
+		}
+	}
+	o := map[string]any{
+		"status":         status,
+		"identifiers":    f.identifier,
+		"authorizations": authzs,
+		"finalize":       f.srv.URL + "/finalize",
+	}
+	if f.issued != nil {
+		o["status"] = "valid"
+		o["certificate"] = f.srv.URL + "/cert"
+	}
+	return o
+}
+
+func (f *fakeACME) authz(i int) map[string]any {
+	status := "pending"
+	if f.authzValid[i] {
+		status = "valid"
+	}
+	var challenges []map[string]string
+	for _, typ := range []string{ChallengeHTTP01, ChallengeDNS01} {
+		challenges = append(challenges, map[string]string{
+			"type":   typ,
+			"url":    fmt.Sprintf("%s/chal/%d/%s", f.srv.URL, i, typ),
+			"token":  fmt.Sprintf("token-%d", i),
+			"status": status,
+		})
+	}
+	return map[string]any{
+		"status":     status,
+		"identifier": f.identifier[i],
+		"challenges": challenges,
+	}
+}
+
+func (f *fakeACME) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+	base := f.srv.URL
+	path := r.URL.Path
+
+	switch {
+	case path == "/directory":
+		f.reply(w, http.StatusOK, map[string]any{
+			"newNonce":   base + "/nonce",
+			"newAccount": base + "/account",
+			"newOrder":   base + "/order",
+			"revokeCert": base + "/revoke",
+			"keyChange":  base + "/key-change",
+			"meta":       map[string]any{"termsOfService": base + "/tos"},
+		})
+	case path == "/nonce":
+		w.WriteHeader(http.StatusOK)
+	case path == "/account":
+		var req struct {
+			TermsAgreed bool `json:"termsOfServiceAgreed"`
+		}
+		require.NoError(f.t, json.Unmarshal(f.payload(r), &req))
+		if !req.TermsAgreed {
+			f.reply(w, http.StatusForbidden, map[string]string{"type": "urn:ietf:params:acme:error:userActionRequired", "detail": "terms not agreed"})
+			return
+		}
+		w.Header().Set("Location", base+"/account/1")
+		status := http.StatusCreated
+		if f.accounts > 0 {
+			status = http.StatusOK
+		}
+		f.accounts++
+		f.reply(w, status, map[string]any{"status": "valid"})
+	case path == "/order":
+		var req struct {
+			Identifiers []map[string]string `json:"identifiers"`
+		}
+		require.NoError(f.t, json.Unmarshal(f.payload(r), &req))
+		f.identifier = req.Identifiers
+		f.authzValid = make([]bool, len(req.Identifiers))
+		w.Header().Set("Location", base+"/order/1")
+		f.reply(w, http.StatusCreated, f.order())
+	case path == "/order/1":
+		w.Header().Set("Location", base+"/order/1")
+		f.reply(w, http.StatusOK, f.order())
+	case strings.HasPrefix(path, "/authz/"):
+		var i int
+		fmt.Sscanf(path, "/authz/%d", &i)
+		f.reply(w, http.StatusOK, f.authz(i))
+	case strings.HasPrefix(path, "/chal/"):
+		var i int
+		var typ string
+		fmt.Sscanf(strings.ReplaceAll(path, "/", " "), " chal %d %s", &i, &typ)
+		f.authzValid[i] = true
+		f.reply(w, http.StatusOK, map[string]string{"type": typ, "url": base + path, "token": fmt.Sprintf("token-%d", i), "status": "valid"})
+	case path == "/finalize":
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		require.NoError(f.t, json.Unmarshal(f.payload(r), &req))
+		der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+		require.NoError(f.t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		require.NoError(f.t, err)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      csr.Subject,
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		leaf, err := x509.CreateCertificate(rand.Reader, tmpl, f.caCert, csr.PublicKey, f.caKey)
+		require.NoError(f.t, err)
+		f.issued = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.caCert.Raw})...)
+		w.Header().Set("Location", base+"/order/1")
+		f.reply(w, http.StatusOK, f.order())
+	case path == "/cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(f.issued)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// recordingSolver records the challenges it is asked to present and clean up.
+type recordingSolver struct {
+	presented []Challenge
+	cleaned   []Challenge
+}
+
+func (s *recordingSolver) Present(ch Challenge) error {
+	s.presented = append(s.presented, ch)
+	return nil
+}
+
+func (s *recordingSolver) CleanUp(ch Challenge) error {
+	s.cleaned = append(s.cleaned, ch)
+	return nil
+}
+
+// newCSR creates a PEM-encoded CSR for the given DNS names.
+func newCSR(t *testing.T, names ...string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: names[0]},
+		DNSNames: names,
+	}, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+// TestClient_Submit tests a complete order with dns-01 challenges.
+func TestClient_Submit(t *testing.T) {
+	ca := newFakeACME(t)
+	accountKey := filepath.Join(t.TempDir(), "account.key")
+	cfg := config.ACMEConfig{
+		DirectoryURL: ca.srv.URL + "/directory",
+		Email:        "admin@example.com",
+		AccountKey:   accountKey,
+		AcceptTOS:    true,
+		Challenge:    ChallengeDNS01,
+	}
+	solver := &recordingSolver{}
+
+	client, err := NewClient(ca.srv.Client(), cfg, config.RetryConfig{}, solver)
+	require.NoError(t, err)
+	bundle, err := client.Submit(context.Background(), newCSR(t, "example.com", "www.example.com"))
+	require.NoError(t, err, "Submit should not return an error")
+
+	assert.Equal(t, "example.com", bundle.Certificate.Subject.CommonName, "Certificate should match the CSR")
+	assert.Equal(t, []string{"example.com", "www.example.com"}, bundle.Certificate.DNSNames)
+	require.Len(t, bundle.Chain, 1, "Expected the issuer in the chain")
+	assert.Equal(t, "Fake ACME Root", bundle.Chain[0].Subject.CommonName)
+
+	require.Len(t, solver.presented, 2, "Expected one challenge per identifier")
+	assert.Equal(t, ChallengeDNS01, solver.presented[0].Type)
+	assert.Equal(t, "example.com", solver.presented[0].Domain)
+	assert.NotEmpty(t, solver.presented[0].Value, "Expected a TXT record value")
+	assert.Equal(t, solver.presented, solver.cleaned, "Every presented challenge should be cleaned up")
+
+	// The account key is created on first use and reused afterwards
+	_, err = os.Stat(accountKey)
+	require.NoError(t, err, "Expected the account key to be saved")
+	_, err = client.Submit(context.Background(), newCSR(t, "example.com"))
+	require.NoError(t, err, "Submit should reuse the existing account")
+	assert.Equal(t, 2, ca.accounts, "Expected the second run to look up the existing account")
+}
+
+// TestClient_Submit_TOSNotAccepted tests that registration fails without accepting the terms.
+func TestClient_Submit_TOSNotAccepted(t *testing.T) {
+	ca := newFakeACME(t)
+	cfg := config.ACMEConfig{
+		DirectoryURL: ca.srv.URL + "/directory",
+		AccountKey:   filepath.Join(t.TempDir(), "account.key"),
+	}
+
+	client, err := NewClient(ca.srv.Client(), cfg, config.RetryConfig{}, &recordingSolver{})
+	require.NoError(t, err)
+	_, err = client.Submit(context.Background(), newCSR(t, "example.com"))
+	require.Error(t, err, "Submit should fail when the terms are not accepted")
+	assert.Contains(t, err.Error(), "failed to register ACME account")
+}
+
+// TestRetryBackoff tests bounding the ACME client's retries by the retry policy.
+func TestRetryBackoff(t *testing.T) {
+	c := &Client{retry: config.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Second}}
+	assert.Positive(t, c.retryBackoff(1, nil, nil))
+	assert.Positive(t, c.retryBackoff(2, nil, nil))
+	assert.Negative(t, c.retryBackoff(3, nil, nil), "Expected no retry after the third attempt")
+
+	c = &Client{}
+	assert.Positive(t, c.retryBackoff(1, nil, nil), "A rejected nonce should always get one retry")
+	assert.Negative(t, c.retryBackoff(2, nil, nil))
+}
+
+// TestWebrootSolver tests writing and removing http-01 responses.
+func TestWebrootSolver(t *testing.T) {
+	dir := t.TempDir()
+	solver, err := NewSolver(config.ACMEConfig{Webroot: dir})
+	require.NoError(t, err)
+
+	ch := Challenge{Type: ChallengeHTTP01, Domain: "example.com", Token: "abc", Value: "abc.thumbprint"}
+	require.NoError(t, solver.Present(ch))
+	data, err := os.ReadFile(filepath.Join(dir, ".well-known", "acme-challenge", "abc"))
+	require.NoError(t, err)
+	assert.Equal(t, "abc.thumbprint", string(data))
+
+	require.NoError(t, solver.CleanUp(ch))
+	_, err = os.Stat(filepath.Join(dir, ".well-known", "acme-challenge", "abc"))
+	assert.True(t, os.IsNotExist(err), "Expected the response to be removed")
+
+	assert.Error(t, solver.Present(Challenge{Type: ChallengeDNS01}), "Webroot should not solve dns-01")
+
+	for _, token := range []string{"../../etc/cron.d/x", "a/b", "a.b", ""} {
+		err := solver.Present(Challenge{Type: ChallengeHTTP01, Token: token, Value: "x"})
+		assert.EqualError(t, err, fmt.Sprintf("invalid challenge token %q", token))
+	}
+	assert.NoDirExists(t, filepath.Join(dir, "etc"), "Nothing should be written outside the challenge directory")
+}
+
+// TestHookSolver tests that the hook receives the action and challenge details.
+func TestHookSolver(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "calls")
+	hook := filepath.Join(dir, "hook.sh")
+	require.NoError(t, os.WriteFile(hook, []byte("#!/bin/sh\necho \"$@\" >> "+out+"\n"), 0755))
+
+	solver, err := NewSolver(config.ACMEConfig{Hook: hook, Challenge: ChallengeDNS01})
+	require.NoError(t, err)
+
+	ch := Challenge{Type: ChallengeDNS01, Domain: "example.com", Token: "abc", Value: "txt-value"}
+	require.NoError(t, solver.Present(ch))
+	require.NoError(t, solver.CleanUp(ch))
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "present dns-01 example.com abc txt-value\ncleanup dns-01 example.com abc txt-value\n", string(data))
+}
+
+// TestNewSolver_None tests that a solver must be configured.
+func TestNewSolver_None(t *testing.T) {
+	_, err := NewSolver(config.ACMEConfig{Challenge: ChallengeDNS01, Webroot: "/srv/www"})
+	assert.Error(t, err, "Webroot cannot solve dns-01")
+}
@@ -0,0 +1,110 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+)
+
+// Supported ACME challenge types.
+const (
+	ChallengeHTTP01 = "http-01"
+	ChallengeDNS01  = "dns-01"
+)
+
+// Challenge describes a challenge to be fulfilled for one identifier.
+type Challenge struct {
+	Type   string // http-01 or dns-01
+	Domain string // Identifier being validated
+	Token  string // Challenge token
+	Value  string // Key authorization for http-01, TXT record value for dns-01
+}
+
+// Solver makes challenge responses available to the ACME server.
+type Solver interface {
+	Present(ch Challenge) error
+	CleanUp(ch Challenge) error
+}
+
+// NewSolver builds the Solver described by the ACME configuration. A hook takes
+// precedence over a webroot.
+func NewSolver(cfg config.ACMEConfig) (Solver, error) {
+	if cfg.Hook != "" {
+		return &HookSolver{Command: cfg.Hook}, nil
+	}
+	if cfg.Webroot != "" && (cfg.Challenge == "" || cfg.Challenge == ChallengeHTTP01) {
+		return &WebrootSolver{Dir: cfg.Webroot}, nil
+	}
+	return nil, errors.New("no ACME challenge solver configured: set acme.hook, or acme.webroot for http-01")
+}
+
+// WebrootSolver serves http-01 responses by writing them below
+// <Dir>/.well-known/acme-challenge for an existing web server.
+type WebrootSolver struct {
+	Dir string
+}
+
+// validToken matches the base64url alphabet RFC 8555 section 8.1 requires of
+// tokens, so a token cannot name a path outside the webroot.
+var validToken = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func (s *WebrootSolver) path(ch Challenge) (string, error) {
+	if !validToken.MatchString(ch.Token) {
+		return "", fmt.Errorf("invalid challenge token %q", ch.Token)
+	}
+	return filepath.Join(s.Dir, ".well-known", "acme-challenge", ch.Token), nil
+}
+
+func (s *WebrootSolver) Present(ch Challenge) error {
+	if ch.Type != ChallengeHTTP01 {
+		return fmt.Errorf("webroot cannot solve %s challenges", ch.Type)
+	}
+	path, err := s.path(ch)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(ch.Value), 0644)
+}
+
+func (s *WebrootSolver) CleanUp(ch Challenge) error {
+	path, err := s.path(ch)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// HookSolver runs an external command to present and clean up challenges, for
+// example to update a DNS zone. It is invoked as
+//
+//	<Command> present|cleanup <type> <domain> <token> <value>
+//
+// For dns-01 the TXT record belongs at _acme-challenge.<domain>.
+type HookSolver struct {
+	Command string
+}
+
+func (s *HookSolver) run(action string, ch Challenge) error {
+	cmd := exec.Command(s.Command, action, ch.Type, ch.Domain, ch.Token, ch.Value)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("hook %s failed: %w: %s", action, err, out)
+	}
+	return nil
+}
+
+func (s *HookSolver) Present(ch Challenge) error {
+	return s.run("present", ch)
+}
+
+func (s *HookSolver) CleanUp(ch Challenge) error {
+	return s.run("cleanup", ch)
+}
@@ -0,0 +1,152 @@
+// Package builtins registers the implementations that ship with hephaestus.
+// Import it for its side effects:
+//
+//	import _ "github.com/dstout-devops/hephaestus/internal/builtins"
+package builtins
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dstout-devops/hephaestus/internal/acme"
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/dstout-devops/hephaestus/internal/csr"
+	"github.com/dstout-devops/hephaestus/internal/esf"
+	"github.com/dstout-devops/hephaestus/internal/est"
+	"github.com/dstout-devops/hephaestus/internal/hsm"
+	"github.com/dstout-devops/hephaestus/internal/keys"
+	"github.com/dstout-devops/hephaestus/internal/registry"
+	"github.com/dstout-devops/hephaestus/internal/scep"
+	"github.com/dstout-devops/hephaestus/internal/secret"
+	"github.com/dstout-devops/hephaestus/internal/transport"
+	"github.com/dstout-devops/hephaestus/internal/vault"
+)
+
+func init() {
+	registry.RegisterKeyGenerator("rsa", func(cfg config.KeyConfig) (crypto.PrivateKey, error) {
+		return keys.GenerateRSAKey(cfg.Size)
+	})
+	registry.RegisterKeyGenerator("ecdsa", func(cfg config.KeyConfig) (crypto.PrivateKey, error) {
+		return keys.GenerateECDSAKey(cfg.Curve)
+	})
+	registry.RegisterKeyGenerator("ed25519", func(config.KeyConfig) (crypto.PrivateKey, error) {
+		return keys.GenerateEd25519Key()
+	})
+	registry.RegisterKeyGenerator("pkcs11", hsm.GenerateKey)
+	registry.RegisterKeyLoader(hsm.Scheme, hsm.Load)
+
+	registry.RegisterCSRBuilder("pkcs10", func(key crypto.PrivateKey, cfg config.CSRConfig) ([]byte, error) {
+		return csr.GenerateCSR(key, cfg)
+	})
+
+	registry.RegisterSubmitter("esf", esfSubmitter{})
+	registry.RegisterSubmitter("acme", registry.SubmitterFunc(func(ctx context.Context, cfg config.Config, csrPEM []byte) (*certs.Bundle, error) {
+		// The ACME client retries with a fresh nonce itself
+		noRetry := cfg.Retry
+		noRetry.MaxAttempts = 1
+		httpClient, err := transport.NewHTTPClient(cfg.TLS, noRetry)
+		if err != nil {
+			return nil, err
+		}
+		client, err := acme.NewClient(httpClient, cfg.ACME, cfg.Retry, nil)
+		if err != nil {
+			return nil, err
+		}
+		return client.Submit(ctx, csrPEM)
+	}))
+	registry.RegisterSubmitter("est", estSubmitter{})
+	registry.RegisterSubmitter("scep", registry.SubmitterFunc(func(ctx context.Context, cfg config.Config, csrPEM []byte) (*certs.Bundle, error) {
+		httpClient, err := transport.NewHTTPClient(cfg.TLS, cfg.Retry)
+		if err != nil {
+			return nil, err
+		}
+		return scep.NewClient(httpClient, cfg.SCEP).Submit(ctx, csrPEM)
+	}))
+	registry.RegisterSubmitter("vault", registry.SubmitterFunc(func(ctx context.Context, cfg config.Config, csrPEM []byte) (*certs.Bundle, error) {
+		httpClient, err := transport.NewHTTPClient(cfg.TLS, cfg.Retry)
+		if err != nil {
+			return nil, err
+		}
+		return vault.NewClient(httpClient, cfg.Vault).Submit(ctx, csrPEM)
+	}))
+
+	registry.RegisterWriter("pem", func(out registry.Output) ([]byte, os.FileMode, error) {
+		return out.Bundle.PEM(), 0644, nil
+	})
+	registry.RegisterWriter("pkcs12", writePKCS12)
+}
+
+// esfSubmitter submits to the ESF endpoint and supports fetching by request ID.
+type esfSubmitter struct{}
+
+func (esfSubmitter) Submit(ctx context.Context, cfg config.Config, csrPEM []byte) (*certs.Bundle, error) {
+	httpClient, err := transport.NewHTTPClient(cfg.TLS, cfg.Retry)
+	if err != nil {
+		return nil, err
+	}
+	return esf.NewClient(httpClient, cfg.Endpoint).Submit(ctx, cfg.ESF, csrPEM)
+}
+
+func (esfSubmitter) Fetch(ctx context.Context, cfg config.Config, requestID string) (*certs.Bundle, error) {
+	httpClient, err := transport.NewHTTPClient(cfg.TLS, cfg.Retry)
+	if err != nil {
+		return nil, err
+	}
+	return esf.NewClient(httpClient, cfg.Endpoint).Fetch(ctx, requestID)
+}
+
+// estSubmitter enrolls with the EST server and checks on pending enrollments
+// by sending the CSR saved at csr.output again.
+type estSubmitter struct{}
+
+func (estSubmitter) Submit(ctx context.Context, cfg config.Config, csrPEM []byte) (*certs.Bundle, error) {
+	client, err := newESTClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return client.Submit(ctx, csrPEM)
+}
+
+func (estSubmitter) Fetch(ctx context.Context, cfg config.Config, requestID string) (*certs.Bundle, error) {
+	csrPEM, err := os.ReadFile(cfg.CSR.Output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the pending CSR: %w", err)
+	}
+	client, err := newESTClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return client.Fetch(ctx, requestID, csrPEM)
+}
+
+func newESTClient(cfg config.Config) (*est.Client, error) {
+	httpClient, err := transport.NewHTTPClient(cfg.TLS, cfg.Retry)
+	if err != nil {
+		return nil, err
+	}
+	return est.NewClient(httpClient, cfg.EST)
+}
+
+// writePKCS12 bundles the private key and certificate chain, readable by the owner only.
+func writePKCS12(out registry.Output) ([]byte, os.FileMode, error) {
+	if out.Key == nil {
+		return nil, 0, errors.New("PKCS#12 output requires the private key")
+	}
+	key, err := out.Key()
+	if err != nil {
+		return nil, 0, err
+	}
+	password, err := secret.Resolve(out.Config.Password)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read PKCS#12 password: %w", err)
+	}
+	data, err := out.Bundle.EncodePKCS12(key, password, out.Config.PKCS12Profile)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, 0600, nil
+}
@@ -0,0 +1,114 @@
+package builtins
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/dstout-devops/hephaestus/internal/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegistered tests that every built-in name is registered.
+func TestRegistered(t *testing.T) {
+	assert.Empty(t, registry.Missing(config.Config{Key: config.KeyConfig{Type: "rsa"}}), "Defaults should be registered")
+
+	for _, name := range []string{"esf", "acme", "est", "scep", "vault"} {
+		_, err := registry.LookupSubmitter(name)
+		assert.NoError(t, err, "Expected backend %s", name)
+	}
+	for _, name := range []string{"pem", "pkcs12"} {
+		_, err := registry.LookupWriter(name)
+		assert.NoError(t, err, "Expected certificate format %s", name)
+	}
+
+	_, err := registry.LookupKeyLoader("pkcs11")
+	assert.NoError(t, err, "Expected pkcs11 key loader")
+
+	for _, name := range []string{"esf", "est"} {
+		submitter, err := registry.LookupSubmitter(name)
+		require.NoError(t, err)
+		assert.Implements(t, (*registry.Fetcher)(nil), submitter, "%s should support fetch", name)
+	}
+}
+
+// TestKeyGenerators tests that each built-in key type produces the expected key.
+func TestKeyGenerators(t *testing.T) {
+	tests := map[string]struct {
+		cfg   config.KeyConfig
+		check func(t *testing.T, key interface{})
+	}{
+		"rsa": {config.KeyConfig{Type: "rsa", Size: 2048}, func(t *testing.T, key interface{}) {
+			require.IsType(t, &rsa.PrivateKey{}, key)
+			assert.Equal(t, 2048, key.(*rsa.PrivateKey).N.BitLen())
+		}},
+		"ecdsa": {config.KeyConfig{Type: "ecdsa", Curve: "P-384"}, func(t *testing.T, key interface{}) {
+			require.IsType(t, &ecdsa.PrivateKey{}, key)
+			assert.Equal(t, elliptic.P384(), key.(*ecdsa.PrivateKey).Curve)
+		}},
+		"ed25519": {config.KeyConfig{Type: "ed25519"}, func(t *testing.T, key interface{}) {
+			assert.IsType(t, ed25519.PrivateKey{}, key)
+		}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			gen, err := registry.LookupKeyGenerator(name)
+			require.NoError(t, err)
+			key, err := gen(tt.cfg)
+			require.NoError(t, err)
+			tt.check(t, key)
+		})
+	}
+}
+
+// TestWriters tests the pem and pkcs12 output writers.
+func TestWriters(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	bundle := &certs.Bundle{Certificate: cert}
+
+	write, err := registry.LookupWriter("pem")
+	require.NoError(t, err)
+	data, perm, err := write(registry.Output{Bundle: bundle})
+	require.NoError(t, err)
+	block, _ := pem.Decode(data)
+	require.NotNil(t, block)
+	assert.Equal(t, cert.Raw, block.Bytes)
+	assert.EqualValues(t, 0644, perm)
+
+	t.Setenv("TEST_P12_PASSWORD", "changeit")
+	write, err = registry.LookupWriter("pkcs12")
+	require.NoError(t, err)
+	data, perm, err = write(registry.Output{
+		Bundle: bundle,
+		Config: config.CertificateConfig{Password: config.PassphraseConfig{Env: "TEST_P12_PASSWORD"}},
+		Key:    func() (crypto.PrivateKey, error) { return key, nil },
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 0600, perm, "PKCS#12 output holds the key and should be private")
+	_, decoded, err := certs.DecodePKCS12(data, "changeit")
+	require.NoError(t, err)
+	assert.True(t, cert.Equal(decoded.Certificate))
+}
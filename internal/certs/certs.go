@@ -0,0 +1,91 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Bundle holds an issued leaf certificate and its issuing chain.
+type Bundle struct {
+	Certificate *x509.Certificate   // Leaf certificate
+	Chain       []*x509.Certificate // Intermediate and root certificates, leaf excluded
+}
+
+// ParsePEM parses one or more PEM-encoded certificates. The first certificate is
+// treated as the leaf and any following certificates as the chain.
+func ParsePEM(pemData []byte) (*Bundle, error) {
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate found in PEM data")
+	}
+	return &Bundle{Certificate: chain[0], Chain: chain[1:]}, nil
+}
+
+// ForKey builds a bundle from certificates returned by a CA. The certificate
+// whose public key matches pub is the leaf; the remaining certificates, then
+// any caCerts not already included, form the chain.
+func ForKey(pub crypto.PublicKey, issued, caCerts []*x509.Certificate) (*Bundle, error) {
+	key, ok := pub.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	b := &Bundle{}
+	for _, cert := range issued {
+		if b.Certificate == nil && key.Equal(cert.PublicKey) {
+			b.Certificate = cert
+		} else {
+			b.Chain = append(b.Chain, cert)
+		}
+	}
+	if b.Certificate == nil {
+		return nil, errors.New("response contains no certificate for the CSR key")
+	}
+
+	for _, ca := range caCerts {
+		if !contains(b.Chain, ca) {
+			b.Chain = append(b.Chain, ca)
+		}
+	}
+	return b, nil
+}
+
+// contains reports whether list holds cert.
+func contains(list []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range list {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// PEM encodes the leaf certificate followed by the chain as PEM.
+func (b *Bundle) PEM() []byte {
+	var out []byte
+	for _, cert := range append([]*x509.Certificate{b.Certificate}, b.Chain...) {
+		out = append(out, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		})...)
+	}
+	return out
+}
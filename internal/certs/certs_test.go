@@ -0,0 +1,112 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// selfSigned creates a self-signed certificate with the given common name for testing.
+func selfSigned(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	cert, _ := selfSignedWithKey(t, cn)
+	return cert
+}
+
+// selfSignedWithKey creates a self-signed certificate and returns it with its key.
+func selfSignedWithKey(t *testing.T, cn string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate key")
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err, "failed to create certificate")
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err, "failed to parse certificate")
+	return cert, key
+}
+
+// TestParsePEM tests parsing a leaf and chain and encoding them back to PEM.
+func TestParsePEM(t *testing.T) {
+	leaf := selfSigned(t, "leaf")
+	root := selfSigned(t, "root")
+
+	var pemData []byte
+	pemData = append(pemData, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})...)
+	pemData = append(pemData, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("ignored")})...)
+	pemData = append(pemData, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})...)
+
+	bundle, err := ParsePEM(pemData)
+	require.NoError(t, err, "ParsePEM should not return an error")
+	assert.Equal(t, "leaf", bundle.Certificate.Subject.CommonName, "First certificate should be the leaf")
+	require.Len(t, bundle.Chain, 1, "Expected one chain certificate")
+	assert.Equal(t, "root", bundle.Chain[0].Subject.CommonName, "Second certificate should be in the chain")
+
+	// Round trip drops non-certificate blocks
+	again, err := ParsePEM(bundle.PEM())
+	require.NoError(t, err, "ParsePEM should parse encoded bundle")
+	assert.True(t, leaf.Equal(again.Certificate), "Leaf should survive round trip")
+	assert.Len(t, again.Chain, 1, "Chain should survive round trip")
+}
+
+// TestParsePEM_Empty tests that ParsePEM fails without any certificate.
+func TestParsePEM_Empty(t *testing.T) {
+	_, err := ParsePEM([]byte("not pem"))
+	assert.EqualError(t, err, "no certificate found in PEM data", "Expected specific error message")
+}
+
+// TestForKey tests picking the leaf by public key and appending CA certificates once.
+func TestForKey(t *testing.T) {
+	leaf, key := selfSignedWithKey(t, "leaf")
+	intermediate := selfSigned(t, "intermediate")
+	root := selfSigned(t, "root")
+
+	bundle, err := ForKey(&key.PublicKey, []*x509.Certificate{intermediate, leaf}, []*x509.Certificate{intermediate, root})
+	require.NoError(t, err, "ForKey should not return an error")
+	assert.True(t, leaf.Equal(bundle.Certificate), "Certificate matching the key should be the leaf")
+	require.Len(t, bundle.Chain, 2, "Duplicate CA certificates should be skipped")
+	assert.Equal(t, "intermediate", bundle.Chain[0].Subject.CommonName)
+	assert.Equal(t, "root", bundle.Chain[1].Subject.CommonName)
+
+	_, other := selfSignedWithKey(t, "other")
+	_, err = ForKey(&other.PublicKey, []*x509.Certificate{leaf}, nil)
+	assert.EqualError(t, err, "response contains no certificate for the CSR key")
+}
+
+// TestEncodePKCS12 tests encoding a bundle with each profile and decoding it back.
+func TestEncodePKCS12(t *testing.T) {
+	leaf, key := selfSignedWithKey(t, "leaf")
+	bundle := &Bundle{Certificate: leaf, Chain: []*x509.Certificate{selfSigned(t, "root")}}
+
+	for _, profile := range []string{"", "modern", "legacy"} {
+		p12, err := bundle.EncodePKCS12(key, "changeit", profile)
+		require.NoError(t, err, "EncodePKCS12 should not return an error for profile %q", profile)
+
+		gotKey, gotCert, gotChain, err := pkcs12.DecodeChain(p12, "changeit")
+		require.NoError(t, err, "failed to decode PKCS#12 for profile %q", profile)
+		assert.True(t, key.Equal(gotKey), "Key should survive round trip")
+		assert.True(t, leaf.Equal(gotCert), "Leaf should survive round trip")
+		assert.Len(t, gotChain, 1, "Chain should survive round trip")
+	}
+
+	_, err := bundle.EncodePKCS12(key, "", "")
+	assert.EqualError(t, err, "PKCS#12 output requires a password", "Expected specific error message")
+
+	_, err = bundle.EncodePKCS12(key, "changeit", "rc2")
+	assert.EqualError(t, err, "unsupported PKCS#12 profile: rc2", "Expected specific error message")
+}
@@ -0,0 +1,31 @@
+package certs
+
+import (
+	"fmt"
+	"time"
+)
+
+// PendingError reports that the CA accepted a request but has not issued the
+// certificate yet, for example while it waits for approval.
+type PendingError struct {
+	RequestID  string        // Identifier to fetch the certificate with later
+	RetryAfter time.Duration // Wait suggested by the CA, zero when none was given
+}
+
+func (e *PendingError) Error() string {
+	return fmt.Sprintf("request %s is pending approval", e.RequestID)
+}
+
+// RejectedError reports that the CA will never issue the certificate for an
+// earlier request, because it was rejected or the CA does not know it.
+type RejectedError struct {
+	RequestID string
+	Reason    string // What the CA said, when anything
+}
+
+func (e *RejectedError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("request %s was rejected", e.RequestID)
+	}
+	return fmt.Sprintf("request %s was rejected: %s", e.RequestID, e.Reason)
+}
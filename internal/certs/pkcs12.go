@@ -0,0 +1,39 @@
+package certs
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// EncodePKCS12 encodes the private key, leaf certificate and chain as a
+// password-protected PKCS#12 bundle. The "modern" profile uses AES-256 and
+// SHA-256; the "legacy" profile uses 3DES for older Java and Windows consumers.
+func (b *Bundle) EncodePKCS12(key crypto.PrivateKey, password, profile string) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("PKCS#12 output requires a password")
+	}
+
+	var enc *pkcs12.Encoder
+	switch profile {
+	case "", "modern":
+		enc = pkcs12.Modern
+	case "legacy":
+		enc = pkcs12.Legacy
+	default:
+		return nil, fmt.Errorf("unsupported PKCS#12 profile: %s", profile)
+	}
+	return enc.Encode(key, b.Certificate, b.Chain, password)
+}
+
+// DecodePKCS12 decodes a password-protected PKCS#12 bundle into its private key
+// and certificate chain.
+func DecodePKCS12(data []byte, password string) (crypto.PrivateKey, *Bundle, error) {
+	key, cert, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, &Bundle{Certificate: cert, Chain: chain}, nil
+}
@@ -0,0 +1,169 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+// KeyUsages lists the key usage bits by name, in the order of RFC 5280.
+var KeyUsages = []struct {
+	Usage x509.KeyUsage
+	Name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digital_signature"},
+	{x509.KeyUsageContentCommitment, "content_commitment"},
+	{x509.KeyUsageKeyEncipherment, "key_encipherment"},
+	{x509.KeyUsageDataEncipherment, "data_encipherment"},
+	{x509.KeyUsageKeyAgreement, "key_agreement"},
+	{x509.KeyUsageCertSign, "cert_sign"},
+	{x509.KeyUsageCRLSign, "crl_sign"},
+	{x509.KeyUsageEncipherOnly, "encipher_only"},
+	{x509.KeyUsageDecipherOnly, "decipher_only"},
+}
+
+// ExtKeyUsages lists the extended key usages of RFC 5280 by name and OID.
+var ExtKeyUsages = []struct {
+	Usage x509.ExtKeyUsage
+	OID   asn1.ObjectIdentifier
+	Name  string
+}{
+	{x509.ExtKeyUsageAny, asn1.ObjectIdentifier{2, 5, 29, 37, 0}, "any"},
+	{x509.ExtKeyUsageServerAuth, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}, "server_auth"},
+	{x509.ExtKeyUsageClientAuth, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}, "client_auth"},
+	{x509.ExtKeyUsageCodeSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}, "code_signing"},
+	{x509.ExtKeyUsageEmailProtection, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}, "email_protection"},
+	{x509.ExtKeyUsageTimeStamping, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}, "time_stamping"},
+	{x509.ExtKeyUsageOCSPSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 9}, "ocsp_signing"},
+}
+
+// KeyUsageNames returns the names of the bits set in ku.
+func KeyUsageNames(ku x509.KeyUsage) []string {
+	var names []string
+	for _, u := range KeyUsages {
+		if ku&u.Usage != 0 {
+			names = append(names, u.Name)
+		}
+	}
+	return names
+}
+
+// ExtKeyUsageName returns the name of the extended key usage with the given
+// OID, or the dotted OID when it is not listed in ExtKeyUsages.
+func ExtKeyUsageName(oid asn1.ObjectIdentifier) string {
+	for _, u := range ExtKeyUsages {
+		if u.OID.Equal(oid) {
+			return u.Name
+		}
+	}
+	return oid.String()
+}
+
+// algorithmKeyUsages holds the key usage bits each key algorithm can serve
+// in an end-entity certificate, following RFC 8813 and RFC 8410.
+var algorithmKeyUsages = map[string]x509.KeyUsage{
+	"rsa": x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment |
+		x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment,
+	"ecdsa": x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment |
+		x509.KeyUsageKeyAgreement | x509.KeyUsageEncipherOnly | x509.KeyUsageDecipherOnly,
+	"ed25519": x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+}
+
+// KeyAlgorithm returns the key type name of pub: rsa, ecdsa or ed25519, or
+// an empty string for other keys.
+func KeyAlgorithm(pub crypto.PublicKey) string {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return "rsa"
+	case *ecdsa.PublicKey:
+		return "ecdsa"
+	case ed25519.PublicKey:
+		return "ed25519"
+	}
+	return ""
+}
+
+// ParseKeyUsage returns the key usage bits named in names.
+func ParseKeyUsage(names []string) (x509.KeyUsage, error) {
+	var ku x509.KeyUsage
+	for _, name := range names {
+		bit, ok := keyUsageByName(name)
+		if !ok {
+			return 0, fmt.Errorf("unknown key usage: %s", name)
+		}
+		ku |= bit
+	}
+	return ku, nil
+}
+
+func keyUsageByName(name string) (x509.KeyUsage, bool) {
+	for _, u := range KeyUsages {
+		if u.Name == name {
+			return u.Usage, true
+		}
+	}
+	return 0, false
+}
+
+// ParseExtKeyUsage returns the OIDs of the extended key usages in names. Each
+// is a name from ExtKeyUsages or a dotted OID.
+func ParseExtKeyUsage(names []string) ([]asn1.ObjectIdentifier, error) {
+	oids := make([]asn1.ObjectIdentifier, 0, len(names))
+	for _, name := range names {
+		oid, err := extKeyUsageOID(name)
+		if err != nil {
+			return nil, err
+		}
+		oids = append(oids, oid)
+	}
+	return oids, nil
+}
+
+func extKeyUsageOID(name string) (asn1.ObjectIdentifier, error) {
+	for _, u := range ExtKeyUsages {
+		if u.Name == name {
+			return u.OID, nil
+		}
+	}
+	oid, err := ParseOID(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown extended key usage: %s", name)
+	}
+	return oid, nil
+}
+
+// CheckKeyUsage reports whether ku suits an end-entity certificate for a key
+// of the given algorithm, as named by KeyAlgorithm. An empty algorithm skips
+// the algorithm-specific checks.
+func CheckKeyUsage(ku x509.KeyUsage, algorithm string) error {
+	for _, u := range KeyUsages {
+		if ku&u.Usage == 0 {
+			continue
+		}
+		if u.Usage == x509.KeyUsageCertSign || u.Usage == x509.KeyUsageCRLSign {
+			return fmt.Errorf("%s is only for CA certificates", u.Name)
+		}
+		if allowed, ok := algorithmKeyUsages[algorithm]; ok && allowed&u.Usage == 0 {
+			return fmt.Errorf("%s does not apply to %s keys", u.Name, algorithm)
+		}
+		if u.Usage&(x509.KeyUsageEncipherOnly|x509.KeyUsageDecipherOnly) != 0 && ku&x509.KeyUsageKeyAgreement == 0 {
+			return fmt.Errorf("%s requires key_agreement", u.Name)
+		}
+	}
+	// The certificate must be usable for TLS, as verify checks
+	switch {
+	case ku&x509.KeyUsageDigitalSignature != 0:
+	case algorithm == "rsa" || algorithm == "":
+		if ku&x509.KeyUsageKeyEncipherment == 0 {
+			return errors.New("must include digital_signature or key_encipherment")
+		}
+	default:
+		return errors.New("must include digital_signature")
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package certs
+
+import (
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PKCS9Attributes maps the PKCS#9 attribute names that may be used in place
+// of an OID to their OIDs.
+var PKCS9Attributes = map[string]asn1.ObjectIdentifier{
+	"email_address":        {1, 2, 840, 113549, 1, 9, 1},
+	"unstructured_name":    {1, 2, 840, 113549, 1, 9, 2},
+	"challenge_password":   {1, 2, 840, 113549, 1, 9, 7},
+	"unstructured_address": {1, 2, 840, 113549, 1, 9, 8},
+}
+
+// ParseOID parses a dotted object identifier such as 1.3.6.1.4.1.99999.1.
+func ParseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || (i == 0 && n > 2) {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
+
+// ParseAttributeOID returns the OID of a CSR attribute given as a name from
+// PKCS9Attributes or a dotted OID.
+func ParseAttributeOID(s string) (asn1.ObjectIdentifier, error) {
+	if oid, ok := PKCS9Attributes[s]; ok {
+		return oid, nil
+	}
+	return ParseOID(s)
+}
+
+// MarshalValue encodes a configured extension or attribute value as the ASN.1
+// type named by typ: utf8 (the default), ia5, printable, or der for
+// hex-encoded DER that is used as is.
+func MarshalValue(typ, value string) ([]byte, error) {
+	if value == "" {
+		return nil, errors.New("value must not be empty")
+	}
+	switch typ {
+	case "", "utf8", "ia5", "printable":
+		if typ == "" {
+			typ = "utf8"
+		}
+		der, err := asn1.MarshalWithParams(value, typ)
+		if err != nil {
+			return nil, fmt.Errorf("value is not a valid %s string", typ)
+		}
+		return der, nil
+	case "der":
+		der, err := hex.DecodeString(strings.NewReplacer(":", "", " ", "").Replace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex: %w", err)
+		}
+		var raw asn1.RawValue
+		if rest, err := asn1.Unmarshal(der, &raw); err != nil || len(rest) > 0 {
+			return nil, errors.New("value is not a single DER element")
+		}
+		return der, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %q", typ)
+	}
+}
@@ -1,29 +1,62 @@
 package command
 
 import (
+	"context"
 	"crypto"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/dstout-devops/hephaestus/internal/certs"
 	"github.com/dstout-devops/hephaestus/internal/config"
-	"github.com/dstout-devops/hephaestus/internal/csr"
 	"github.com/dstout-devops/hephaestus/internal/keys"
 	"github.com/dstout-devops/hephaestus/internal/logger"
+	"github.com/dstout-devops/hephaestus/internal/pending"
+	"github.com/dstout-devops/hephaestus/internal/registry"
+	"github.com/dstout-devops/hephaestus/internal/renew"
+	"github.com/dstout-devops/hephaestus/internal/secret"
+	"github.com/dstout-devops/hephaestus/internal/verify"
 )
 
+// ErrConfig is returned when the configuration cannot be loaded.
+var ErrConfig = errors.New("configuration loading failed")
+
+// ErrPending is returned when the CA accepted the request but has not issued
+// the certificate yet. The request is saved to pending.file so a later run or
+// fetch can pick it up.
+var ErrPending = errors.New("certificate not issued yet")
+
+// defaultPollInterval is the wait between checks on a pending request when
+// neither the config nor the CA gives one.
+const defaultPollInterval = time.Minute
+
 // Command represents the application, holding state and dependencies.
 type Command struct {
 	log          logger.Logger       // Logger for troubleshooting
 	cfg          config.Config       // Loaded configuration
 	privKey      interface{}         // Generated private key
+	keyPath      string              // Where the private key was loaded from or saved to
 	csr          []byte              // Generated CSR data
+	csrPath      string              // Where the CSR was loaded from or saved to
+	cert         *certs.Bundle       // Issued certificate and chain
+	secrets      secretCache         // Key passphrases already read
 	keyGen       KeyGenerator        // Dependency for key generation
 	configLoader config.ConfigLoader // Dependency for config loading
 	fileWriter   FileWriter          // Dependency for file writing
+	submitter    Submitter           // Dependency for CA submission
+	sections     config.Section      // Configuration sections checked by LoadConfig
 }
 
+// secretCache holds passphrases already read, by their source.
+type secretCache map[config.PassphraseConfig]string
+
 // NewCommand creates a new Command instance with injected dependencies.
-func NewCommand(log logger.Logger, keyGen KeyGenerator, configLoader config.ConfigLoader, fileWriter FileWriter) *Command {
+func NewCommand(log logger.Logger, keyGen KeyGenerator, configLoader config.ConfigLoader, fileWriter FileWriter, submitter Submitter) *Command {
 	if log == nil {
 		log = logger.NewLogger()
 	}
@@ -31,61 +64,181 @@ func NewCommand(log logger.Logger, keyGen KeyGenerator, configLoader config.Conf
 		keyGen = &DefaultKeyGenerator{}
 	}
 	if configLoader == nil {
-		configLoader = &config.ViperConfigLoader{}
+		configLoader = config.NewViperConfigLoader()
 	}
 	if fileWriter == nil {
 		fileWriter = &DefaultFileWriter{}
 	}
+	if submitter == nil {
+		submitter = &DefaultSubmitter{}
+	}
 	return &Command{
 		log:          log,
 		keyGen:       keyGen,
 		fileWriter:   fileWriter,
 		configLoader: configLoader,
+		submitter:    submitter,
+		sections:     config.AllSections,
+	}
+}
+
+// Run executes the main logic of the application. Cancelling ctx stops it
+// before the next step, or during submission.
+func (c *Command) Run(ctx context.Context) error {
+	if err := c.LoadConfig(ctx); err != nil {
+		return err
 	}
+	return c.Issue(ctx)
 }
 
-// Run executes the main logic of the application.
-func (c *Command) Run() error {
-	if err := c.LoadConfig(); err != nil {
+// Issue prepares the key, generates and saves the CSR, and submits it when an
+// endpoint is configured. When an earlier request is still pending, it checks
+// on that request instead, and makes a new request only if the CA rejected it.
+// The configuration must already be loaded.
+func (c *Command) Issue(ctx context.Context) error {
+	req, err := c.Pending()
+	if err != nil {
 		return err
 	}
-	if err := c.GenerateKey(); err != nil {
+	if req != nil {
+		err := c.Resume(ctx, req, false)
+		var rerr *certs.RejectedError
+		if !errors.As(err, &rerr) {
+			return err
+		}
+		c.log.Info("Requesting a new certificate")
+		c.reset()
+	}
+
+	if !c.hasCA() {
+		if err := c.PrepareKey(ctx); err != nil {
+			return err
+		}
+	} else if err := c.StageKey(ctx); err != nil {
 		return err
 	}
-	if err := c.GenerateCSR(); err != nil {
+	if err := c.GenerateCSR(ctx); err != nil {
 		return err
 	}
-	return nil
+	if err := c.WriteCSRToFile(ctx, ""); err != nil {
+		return err
+	}
+	if !c.hasCA() {
+		c.log.Info("No endpoint configured, skipping CSR submission")
+		return nil
+	}
+	if err := c.SubmitCSR(ctx); err != nil {
+		return err
+	}
+	if err := c.VerifyCertificate(ctx); err != nil {
+		return err
+	}
+	return c.WriteCertificateToFile(ctx, "")
 }
 
 // LoadConfig loads the application configuration.
-func (c *Command) LoadConfig() error {
+func (c *Command) LoadConfig(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	c.log.Info("Loading configuration...")
 	cfg, err := c.configLoader.LoadConfig()
 	if err != nil {
 		c.log.Error("Failed to load config", "error", err)
-		return errors.New("configuration loading failed")
+		return fmt.Errorf("%w: %w", ErrConfig, err)
+	}
+	if err := ValidateConfig(cfg, c.sections); err != nil {
+		c.log.Error("Invalid config", "error", err)
+		return fmt.Errorf("%w: %w", ErrConfig, err)
 	}
 	c.cfg = cfg
 	c.log.Info("Configuration loaded successfully")
-	return fmt.Errorf("configuration loading failed: %w", err)
+	c.log.Debug("Using configuration", "key_type", cfg.Key.Type, "key_input", cfg.Key.Input, "common_name", cfg.CSR.CommonName, "endpoint", cfg.Endpoint)
+	return nil
 }
 
-// GenerateKey generates the private key and stores it in memory.
-func (c *Command) GenerateKey() error {
-	c.log.Info("Generating private key...")
-	var privKey crypto.PrivateKey
-	var err error
+// Require limits the checks made by LoadConfig to the configuration sections
+// a command uses. All sections are checked by default.
+func (c *Command) Require(sections config.Section) {
+	c.sections = sections
+}
 
-	switch c.cfg.Key.Type {
-	case "rsa":
-		privKey, err = c.keyGen.GenerateRSAKey(c.cfg.Key.Size)
-	case "ed25519":
-		privKey, err = c.keyGen.GenerateEd25519Key()
-	default:
-		return fmt.Errorf("unsupported key type: %s", c.cfg.Key.Type)
+// ValidateConfig checks the given sections of cfg and that every
+// implementation they select by name is registered, reporting all problems in
+// one *config.ValidationError.
+func ValidateConfig(cfg config.Config, sections config.Section) error {
+	var found []config.FieldError
+	if err := cfg.Validate(); err != nil {
+		var verr *config.ValidationError
+		if !errors.As(err, &verr) {
+			return err
+		}
+		found = verr.Errors
+	}
+	found = append(found, registry.Missing(cfg)...)
+	var errs []config.FieldError
+	for _, fe := range found {
+		if sections.Covers(fe.Path) {
+			errs = append(errs, fe)
+		}
+	}
+	if len(errs) > 0 {
+		return &config.ValidationError{Errors: errs}
 	}
+	return nil
+}
+
+// Config returns the loaded configuration.
+func (c *Command) Config() config.Config {
+	return c.cfg
+}
+
+// PrepareKey loads the key configured in key.input, or generates a new key and
+// saves it to key.output so it is not lost once the command exits.
+func (c *Command) PrepareKey(ctx context.Context) error {
+	if c.cfg.Key.Input != "" {
+		return c.LoadKey(ctx, c.cfg.Key.Input)
+	}
+	if err := c.GenerateKey(ctx); err != nil {
+		return err
+	}
+	return c.WriteKeyToFile(ctx, "")
+}
+
+// StageKey prepares the key like PrepareKey, but saves a new key next to
+// key.output instead of over it. WriteCertificateToFile moves it into place
+// together with the certificate, so a failed or pending request leaves the
+// key in use matching its certificate.
+func (c *Command) StageKey(ctx context.Context) error {
+	if c.cfg.Key.Input != "" {
+		return c.LoadKey(ctx, c.cfg.Key.Input)
+	}
+	if err := c.GenerateKey(ctx); err != nil {
+		return err
+	}
+	return c.WriteKeyToFile(ctx, stagedPath(c.keyOutput()))
+}
+
+// stagedPath returns where a new file is written until it replaces path.
+func stagedPath(path string) string {
+	return path + ".new"
+}
+
+// keyOutput returns key.output, or the default key path when it is not set.
+func (c *Command) keyOutput() string {
+	if c.cfg.Key.Output != "" {
+		return c.cfg.Key.Output
+	}
+	return "private.key"
+}
 
+// GenerateKey generates the private key and stores it in memory.
+func (c *Command) GenerateKey(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.log.Info("Generating private key...", "type", c.cfg.Key.Type)
+	privKey, err := c.keyGen.GenerateKey(ctx, c.cfg.Key)
 	if err != nil {
 		c.log.Error("Failed to generate private key", "error", err)
 		return errors.New("private key generation failed")
@@ -93,66 +246,684 @@ func (c *Command) GenerateKey() error {
 
 	c.privKey = privKey
 	c.log.Info("Private key generated successfully")
-	return fmt.Errorf("private key generation failed: %w", err)
+	return nil
+}
+
+// LoadKey reads an existing PEM private key or saved key reference from path
+// and stores it in memory. Encrypted keys are decrypted with key.passphrase,
+// or else with key.encryption.passphrase.
+func (c *Command) LoadKey(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.log.Info("Loading private key...", "path", path)
+	pemKey, err := os.ReadFile(path)
+	if err != nil {
+		c.log.Error("Failed to read private key", "error", err, "path", path)
+		return fmt.Errorf("private key loading failed: %w", err)
+	}
+
+	var privKey crypto.PrivateKey
+	if scheme, ok := keys.ReferenceScheme(pemKey); ok {
+		privKey, err = c.loadReference(scheme, pemKey)
+	} else {
+		var passphrase string
+		if keys.IsEncrypted(pemKey) {
+			src := c.cfg.Key.Passphrase
+			if !src.IsSet() {
+				src = c.cfg.Key.Encryption.Passphrase
+			}
+			passphrase, err = c.passphrase(src)
+		}
+		if err == nil {
+			privKey, err = keys.ParsePrivateKey(pemKey, passphrase)
+		}
+	}
+	if err != nil {
+		c.log.Error("Failed to parse private key", "error", err, "path", path)
+		return fmt.Errorf("private key loading failed: %w", err)
+	}
+
+	c.privKey, c.keyPath = privKey, path
+	c.log.Info("Private key loaded successfully", "path", path)
+	return nil
+}
+
+// loadReference opens the key named by a saved reference such as a pkcs11 URI.
+func (c *Command) loadReference(scheme string, data []byte) (crypto.PrivateKey, error) {
+	load, err := registry.LookupKeyLoader(scheme)
+	if err != nil {
+		return nil, err
+	}
+	return load(strings.TrimSpace(string(data)), c.cfg.Key)
 }
 
 // GenerateCSR generates the CSR and stores it in memory.
-func (c *Command) GenerateCSR() error {
+func (c *Command) GenerateCSR(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	c.log.Info("Generating CSR...")
-	csrPem, err := csr.GenerateCSR(c.privKey, c.cfg.CSR)
+	build, err := registry.LookupCSRBuilder(c.cfg.CSR.Builder)
+	if err != nil {
+		c.log.Error("Failed to generate CSR", "error", err)
+		return fmt.Errorf("CSR generation failed: %w", err)
+	}
+	csrPem, err := build(c.privKey, c.cfg.CSR)
 	if err != nil {
 		c.log.Error("Failed to generate CSR", "error", err)
 		return errors.New("CSR generation failed")
 	}
 	c.csr = csrPem
 	c.log.Info("CSR generated successfully")
-	return fmt.Errorf("CSR generation failed: %w", err)
+	return nil
 }
 
 // WriteKeyToFile optionally saves the private key to a file.
-func (c *Command) WriteKeyToFile(path string) error {
+func (c *Command) WriteKeyToFile(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if c.privKey == nil {
 		return errors.New("no private key available to write")
 	}
 
 	if path == "" {
-		if c.cfg.Key.Output != "" {
-			path = c.cfg.Key.Output // Use config path if available
-		} else {
-			path = "private.key" // Default path
-		}
+		path = c.keyOutput()
 	}
 
-	pemKey, err := keys.SerializePrivateKey(c.privKey, "")
-	if err != nil {
-		c.log.Error("Failed to serialize private key", "error", err)
-		return fmt.Errorf("private key serialization failed: %w", err)
+	var pemKey []byte
+	if ref, ok := c.privKey.(keys.Reference); ok {
+		// The key stays in its token, only the reference is saved
+		pemKey = []byte(ref.URI() + "\n")
+	} else {
+		passphrase, err := c.encryptionPassphrase()
+		if err != nil {
+			c.log.Error("Failed to read key encryption passphrase", "error", err)
+			return fmt.Errorf("private key serialization failed: %w", err)
+		}
+		pemKey, err = keys.EncodePrivateKey(c.privKey, c.cfg.Key.Format, passphrase, c.encryptionOptions())
+		if err != nil {
+			c.log.Error("Failed to serialize private key", "error", err)
+			return fmt.Errorf("private key serialization failed: %w", err)
+		}
 	}
 
-	err = c.fileWriter.WriteFile(path, pemKey, 0600)
-	if err != nil {
+	if err := c.fileWriter.WriteFile(path, pemKey, 0600); err != nil {
 		c.log.Error("Failed to save private key", "error", err, "path", path)
 		return fmt.Errorf("private key saving failed: %w", err)
 	}
+	c.keyPath = path
 	c.log.Info("Private key saved successfully", "path", path)
 	return nil
 }
 
+// encryptionPassphrase returns the key.encryption.passphrase secret, or an
+// empty string when none is configured.
+func (c *Command) encryptionPassphrase() (string, error) {
+	return c.passphrase(c.cfg.Key.Encryption.Passphrase)
+}
+
+// passphrase returns the secret from src, or an empty string when src is not
+// set. Each source is read once so a prompt is not repeated on every renewal.
+func (c *Command) passphrase(src config.PassphraseConfig) (string, error) {
+	if !src.IsSet() {
+		return "", nil
+	}
+	if value, ok := c.secrets[src]; ok {
+		return value, nil
+	}
+	value, err := secret.Resolve(src)
+	if err != nil {
+		return "", err
+	}
+	if c.secrets == nil {
+		c.secrets = make(secretCache)
+	}
+	c.secrets[src] = value
+	return value, nil
+}
+
+// encryptionOptions returns the PBES2 settings from key.encryption.
+func (c *Command) encryptionOptions() keys.EncryptionOptions {
+	e := c.cfg.Key.Encryption
+	return keys.EncryptionOptions{
+		Cipher:     e.Cipher,
+		KDF:        e.KDF,
+		Iterations: e.Iterations,
+		ScryptN:    e.Scrypt.N,
+		ScryptR:    e.Scrypt.R,
+		ScryptP:    e.Scrypt.P,
+	}
+}
+
 // WriteCSRToFile optionally saves the CSR to a file.
-func (c *Command) WriteCSRToFile(path string) error {
+func (c *Command) WriteCSRToFile(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if c.csr == nil {
 		return errors.New("no CSR available to write")
 	}
 
 	if path == "" {
-		path = "host.csr" // Default path
+		if c.cfg.CSR.Output != "" {
+			path = c.cfg.CSR.Output // Use config path if available
+		} else {
+			path = "host.csr" // Default path
+		}
 	}
 
 	err := c.fileWriter.WriteFile(path, c.csr, 0644)
 	if err != nil {
 		c.log.Error("Failed to save CSR", "error", err, "path", path)
-		return errors.New("CSR saving failed")
+		return fmt.Errorf("CSR saving failed: %w", err)
 	}
+	c.csrPath = path
 	c.log.Info("CSR saved successfully", "path", path)
-	return fmt.Errorf("CSR saving failed: %w", err)
+	return nil
+}
+
+// hasCA reports whether a CA is configured for the selected backend.
+func (c *Command) hasCA() bool {
+	switch c.cfg.Backend {
+	case "", "esf":
+		return c.cfg.Endpoint != ""
+	default:
+		return true
+	}
+}
+
+// LoadCSR reads an existing PEM CSR from path and stores it in memory.
+func (c *Command) LoadCSR(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.log.Info("Loading CSR...", "path", path)
+	csrPem, err := os.ReadFile(path)
+	if err != nil {
+		c.log.Error("Failed to read CSR", "error", err, "path", path)
+		return fmt.Errorf("CSR loading failed: %w", err)
+	}
+
+	block, _ := pem.Decode(csrPem)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		c.log.Error("Failed to decode CSR", "path", path)
+		return errors.New("CSR loading failed: no CERTIFICATE REQUEST PEM block found")
+	}
+	if _, err := x509.ParseCertificateRequest(block.Bytes); err != nil {
+		c.log.Error("Failed to parse CSR", "error", err, "path", path)
+		return fmt.Errorf("CSR loading failed: %w", err)
+	}
+
+	c.csr, c.csrPath = csrPem, path
+	c.log.Info("CSR loaded successfully", "path", path)
+	return nil
+}
+
+// SubmitCSR submits the CSR to the configured endpoint and stores the issued
+// certificate in memory. The submission, retries included, is bounded by
+// retry.timeout when it is set. A request the CA accepts without issuing a
+// certificate is saved to pending.file and reported as ErrPending.
+func (c *Command) SubmitCSR(ctx context.Context) error {
+	if c.csr == nil {
+		return errors.New("no CSR available to submit")
+	}
+
+	ctx, cancel := c.withDeadline(ctx)
+	defer cancel()
+	c.log.Info("Submitting CSR...", "backend", c.cfg.Backend, "endpoint", c.cfg.Endpoint)
+	bundle, err := c.submitter.Submit(ctx, c.cfg, c.csr)
+	var perr *certs.PendingError
+	if errors.As(err, &perr) {
+		return c.savePending(perr)
+	}
+	if err != nil {
+		c.log.Error("Failed to submit CSR", "error", err, "backend", c.cfg.Backend)
+		return fmt.Errorf("CSR submission failed: %w", err)
+	}
+	c.cert = bundle
+	c.log.Info("Certificate issued successfully", "subject", bundle.Certificate.Subject.String(), "serial", bundle.Certificate.SerialNumber.String())
+	return nil
+}
+
+// LoadCertificate reads the certificate at path, in the configured certificate
+// format, and stores it in memory.
+func (c *Command) LoadCertificate(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("certificate loading failed: %w", err)
+	}
+
+	switch c.cfg.Certificate.Format {
+	case "", "pem":
+		bundle, err := certs.ParsePEM(data)
+		if err != nil {
+			return fmt.Errorf("certificate loading failed: %w", err)
+		}
+		c.cert = bundle
+	case "pkcs12":
+		password, err := secret.Resolve(c.cfg.Certificate.Password)
+		if err != nil {
+			return fmt.Errorf("failed to read PKCS#12 password: %w", err)
+		}
+		_, bundle, err := certs.DecodePKCS12(data, password)
+		if err != nil {
+			return fmt.Errorf("certificate loading failed: %w", err)
+		}
+		c.cert = bundle
+	default:
+		return fmt.Errorf("unsupported certificate format: %s", c.cfg.Certificate.Format)
+	}
+	return nil
+}
+
+// FetchCertificate retrieves a previously requested certificate and stores it
+// in memory. Like SubmitCSR, it is bounded by retry.timeout when it is set.
+func (c *Command) FetchCertificate(ctx context.Context, requestID string) error {
+	ctx, cancel := c.withDeadline(ctx)
+	defer cancel()
+	c.log.Info("Fetching certificate...", "endpoint", c.cfg.Endpoint, "request_id", requestID)
+	bundle, err := c.submitter.Fetch(ctx, c.cfg, requestID)
+	var perr *certs.PendingError
+	if errors.As(err, &perr) {
+		c.log.Info("Certificate request still pending", "request_id", requestID)
+		return fmt.Errorf("%w: %w", ErrPending, perr)
+	}
+	if err != nil {
+		c.log.Error("Failed to fetch certificate", "error", err, "request_id", requestID)
+		return fmt.Errorf("certificate fetch failed: %w", err)
+	}
+	c.cert = bundle
+	c.log.Info("Certificate fetched successfully", "subject", bundle.Certificate.Subject.String(), "serial", bundle.Certificate.SerialNumber.String())
+	return nil
+}
+
+// VerifyCertificate checks the certificate in memory before it is saved: it
+// must be for the private key, carry the subject and SANs of the CSR in memory,
+// chain to verify.trust_bundles when set, be currently valid and be an
+// end-entity certificate. It does nothing when verify.disabled is set.
+func (c *Command) VerifyCertificate(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.cert == nil {
+		return errors.New("no certificate available to verify")
+	}
+	if c.cfg.Verify.Disabled {
+		c.log.Warn("Certificate verification disabled")
+		return nil
+	}
+
+	var req *x509.CertificateRequest
+	var err error
+	if block, _ := pem.Decode(c.csr); block != nil {
+		if req, err = x509.ParseCertificateRequest(block.Bytes); err != nil {
+			return fmt.Errorf("certificate verification failed: %w", err)
+		}
+	} else {
+		c.log.Debug("No CSR in memory, skipping subject and SAN checks")
+	}
+	pub, err := c.publicKey(ctx, req)
+	if err != nil {
+		return fmt.Errorf("certificate verification failed: %w", err)
+	}
+	opts := verify.Options{Now: time.Now(), ClockSkew: c.cfg.Verify.ClockSkew, Subject: c.subjectCheck()}
+	if len(c.cfg.Verify.TrustBundles) > 0 {
+		if opts.Roots, err = verify.Roots(c.cfg.Verify.TrustBundles); err != nil {
+			c.log.Error("Failed to load trust bundles", "error", err)
+			return fmt.Errorf("certificate verification failed: %w", err)
+		}
+	}
+
+	if err := verify.Certificate(c.cert, pub, req, opts); err != nil {
+		c.log.Error("Issued certificate failed verification", "error", err, "serial", c.cert.Certificate.SerialNumber.String())
+		return fmt.Errorf("certificate verification failed: %w", err)
+	}
+	c.log.Info("Certificate verified successfully", "serial", c.cert.Certificate.SerialNumber.String())
+	return nil
+}
+
+// publicKey returns the public key the certificate must be for: that of the
+// private key in memory, else that of req, else that of the key loaded as
+// currentKey does.
+func (c *Command) publicKey(ctx context.Context, req *x509.CertificateRequest) (crypto.PublicKey, error) {
+	if c.privKey == nil && req != nil {
+		return req.PublicKey, nil
+	}
+	key, err := c.currentKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer.Public(), nil
+}
+
+// WriteCertificateToFile saves the issued certificate and chain to a file, as
+// PEM or as a PKCS#12 bundle together with the private key. A key staged by
+// StageKey is renamed into place with the certificate. Once it is saved, any
+// pending request is complete and removed.
+func (c *Command) WriteCertificateToFile(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.cert == nil {
+		return errors.New("no certificate available to write")
+	}
+
+	if path == "" {
+		if c.cfg.Certificate.Output != "" {
+			path = c.cfg.Certificate.Output // Use config path if available
+		} else {
+			path = "certificate.pem" // Default path
+		}
+	}
+
+	write, err := registry.LookupWriter(c.cfg.Certificate.Format)
+	if err != nil {
+		return fmt.Errorf("certificate saving failed: %w", err)
+	}
+	data, perm, err := write(registry.Output{Bundle: c.cert, Config: c.cfg.Certificate, Key: func() (crypto.PrivateKey, error) { return c.currentKey(ctx) }})
+	if err != nil {
+		c.log.Error("Failed to encode certificate", "error", err, "format", c.cfg.Certificate.Format)
+		return fmt.Errorf("certificate saving failed: %w", err)
+	}
+
+	if c.keyPath == stagedPath(c.keyOutput()) {
+		err = c.replaceKeyAndCertificate(path, data, perm)
+	} else {
+		err = c.fileWriter.WriteFile(path, data, perm)
+	}
+	if err != nil {
+		c.log.Error("Failed to save certificate", "error", err, "path", path)
+		return fmt.Errorf("certificate saving failed: %w", err)
+	}
+	c.log.Info("Certificate saved successfully", "path", path, "format", c.cfg.Certificate.Format)
+	if c.cfg.Pending.File != "" {
+		if err := pending.Remove(c.cfg.Pending.File); err != nil {
+			c.log.Warn("Failed to remove completed pending request", "error", err, "path", c.cfg.Pending.File)
+		}
+	}
+	return nil
+}
+
+// replaceKeyAndCertificate writes the certificate next to path, then renames
+// the staged key and the certificate over the ones in use, one right after
+// the other.
+func (c *Command) replaceKeyAndCertificate(path string, data []byte, perm os.FileMode) error {
+	staged := stagedPath(path)
+	if err := c.fileWriter.WriteFile(staged, data, perm); err != nil {
+		return err
+	}
+	keyPath := c.keyOutput()
+	if err := c.fileWriter.Rename(c.keyPath, keyPath); err != nil {
+		return fmt.Errorf("failed to move the new private key into place: %w", err)
+	}
+	c.keyPath = keyPath
+	c.log.Info("Private key replaced", "path", keyPath)
+	return c.fileWriter.Rename(staged, path)
+}
+
+// currentKey returns the private key for output formats that include it. When
+// no key is in memory, as after fetch, the key is loaded from key.input or key.output.
+func (c *Command) currentKey(ctx context.Context) (crypto.PrivateKey, error) {
+	if c.privKey == nil {
+		if err := c.LoadKey(ctx, c.keyFile()); err != nil {
+			return nil, err
+		}
+	}
+	return c.privKey, nil
+}
+
+// keyFile returns where the private key was loaded from or saved to, falling
+// back to key.input or key.output.
+func (c *Command) keyFile() string {
+	switch {
+	case c.keyPath != "":
+		return c.keyPath
+	case c.cfg.Key.Input != "":
+		return c.cfg.Key.Input
+	default:
+		return c.cfg.Key.Output
+	}
+}
+
+// backend returns the configured backend, or the default when none is set.
+func (c *Command) backend() string {
+	if c.cfg.Backend == "" {
+		return registry.DefaultBackend
+	}
+	return c.cfg.Backend
+}
+
+// subjectCheck returns the configured verify.subject mode. ACME CAs keep only
+// the common name and Vault roles set the subject themselves, so those
+// backends check the common name alone by default.
+func (c *Command) subjectCheck() string {
+	if c.cfg.Verify.Subject != "" {
+		return c.cfg.Verify.Subject
+	}
+	switch c.backend() {
+	case "acme", "vault":
+		return verify.SubjectCN
+	}
+	return verify.SubjectStrict
+}
+
+// Pending returns the request saved at pending.file, or nil when no request is
+// pending for the configured backend.
+func (c *Command) Pending() (*pending.Request, error) {
+	if c.cfg.Pending.File == "" {
+		return nil, nil
+	}
+	req, err := pending.Load(c.cfg.Pending.File)
+	if err != nil {
+		c.log.Error("Failed to load pending request", "error", err, "path", c.cfg.Pending.File)
+		return nil, fmt.Errorf("pending request loading failed: %w", err)
+	}
+	if req != nil && req.Backend != c.backend() {
+		c.log.Warn("Ignoring pending request for another backend", "request_id", req.RequestID, "backend", req.Backend, "path", c.cfg.Pending.File)
+		return nil, nil
+	}
+	return req, nil
+}
+
+// savePending saves a request the CA accepted without issuing a certificate,
+// with the paths of its key and CSR, and returns ErrPending.
+func (c *Command) savePending(perr *certs.PendingError) error {
+	path := c.cfg.Pending.File
+	c.log.Info("Certificate request pending approval", "request_id", perr.RequestID, "path", path)
+	if path == "" {
+		return fmt.Errorf("%w: %w", ErrPending, perr)
+	}
+
+	req := &pending.Request{
+		Backend:   c.backend(),
+		RequestID: perr.RequestID,
+		Key:       c.keyFile(),
+		CSR:       c.csrPath,
+		Submitted: time.Now().UTC(),
+	}
+	data, err := req.Encode()
+	if err == nil {
+		err = c.fileWriter.WriteFile(path, data, 0600)
+	}
+	if err != nil {
+		c.log.Error("Failed to save pending request", "error", err, "path", path, "request_id", perr.RequestID)
+		return fmt.Errorf("pending request saving failed: %w", err)
+	}
+	return fmt.Errorf("%w: %w", ErrPending, perr)
+}
+
+// Resume continues a pending request: it loads the key and CSR the request was
+// made with, fetches the certificate and saves it. With poll, it keeps checking
+// while the request is pending, as PollCertificate does. A request the CA
+// rejected is removed from pending.file so it is not checked again.
+func (c *Command) Resume(ctx context.Context, req *pending.Request, poll bool) error {
+	c.log.Info("Resuming pending request", "request_id", req.RequestID, "submitted", req.Submitted)
+	if err := c.LoadKey(ctx, req.Key); err != nil {
+		return err
+	}
+	if err := c.LoadCSR(ctx, req.CSR); err != nil {
+		return err
+	}
+	fetch := c.FetchCertificate
+	if poll {
+		fetch = c.PollCertificate
+	}
+	if err := fetch(ctx, req.RequestID); err != nil {
+		var rerr *certs.RejectedError
+		if errors.As(err, &rerr) {
+			c.log.Warn("Pending request was rejected, removing it", "request_id", req.RequestID, "reason", rerr.Reason, "path", c.cfg.Pending.File)
+			if err := pending.Remove(c.cfg.Pending.File); err != nil {
+				c.log.Error("Failed to remove rejected pending request", "error", err, "path", c.cfg.Pending.File)
+				return fmt.Errorf("pending request removal failed: %w", err)
+			}
+		}
+		return err
+	}
+	if err := c.VerifyCertificate(ctx); err != nil {
+		return err
+	}
+	return c.WriteCertificateToFile(ctx, "")
+}
+
+// PollCertificate fetches a certificate like FetchCertificate, checking again
+// every pending.poll_interval, or when the CA asks, while the request is
+// pending. It returns ErrPending once pending.poll_timeout has passed.
+func (c *Command) PollCertificate(ctx context.Context, requestID string) error {
+	deadline := time.Now().Add(c.cfg.Pending.PollTimeout)
+	for {
+		err := c.FetchCertificate(ctx, requestID)
+		var perr *certs.PendingError
+		if !errors.As(err, &perr) {
+			return err
+		}
+
+		wait := c.cfg.Pending.PollInterval
+		if perr.RetryAfter > 0 {
+			wait = perr.RetryAfter
+		} else if wait <= 0 {
+			wait = defaultPollInterval
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return err
+		}
+		c.log.Info("Waiting for the certificate", "request_id", requestID, "next_check", time.Now().Add(wait))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// withDeadline bounds ctx by retry.timeout when it is set.
+func (c *Command) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.cfg.Retry.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.cfg.Retry.Timeout)
+}
+
+// Watch runs until ctx is cancelled, re-reading the certificate at
+// certificate.output and re-issuing it whenever it is missing or due for
+// renewal. The configuration is reloaded on every check so edits take effect
+// without a restart; when a reload fails, the last good configuration is kept
+// and the reload is tried again on the next check. Only a configuration that
+// cannot be loaded at startup is returned as an error. Cancellation is a clean
+// shutdown and returns nil.
+func (c *Command) Watch(ctx context.Context) error {
+	var serial string
+	var jitter time.Duration
+	loaded := false
+
+	for {
+		if err := c.LoadConfig(ctx); err != nil {
+			if ctx.Err() != nil {
+				c.log.Info("Stopping renewal watch")
+				return nil
+			}
+			if !loaded {
+				return err
+			}
+			c.log.Warn("Keeping the last good configuration", "error", err)
+		}
+		loaded = true
+		interval := c.cfg.Renew.CheckInterval
+		if interval <= 0 {
+			interval = time.Hour
+		}
+
+		wait := interval
+		path := c.cfg.Certificate.Output
+		if err := c.LoadCertificate(ctx, path); err != nil {
+			c.log.Warn("No usable certificate, renewing now", "error", err, "path", path)
+			wait = c.renewNow(ctx, interval)
+		} else {
+			cert := c.cert.Certificate
+			if s := cert.SerialNumber.String(); s != serial {
+				// Draw jitter once per certificate so the schedule is stable between checks
+				serial, jitter = s, renew.Jitter(c.cfg.Renew.Jitter)
+			}
+			renewAt := renew.RenewAt(cert, c.cfg.Renew).Add(-jitter)
+			if !time.Now().Before(renewAt) {
+				c.log.Info("Certificate due for renewal", "serial", serial, "not_after", cert.NotAfter, "renew_at", renewAt)
+				wait = c.renewNow(ctx, interval)
+			} else {
+				if until := time.Until(renewAt); until < wait {
+					wait = until
+				}
+				c.log.Info("Certificate not yet due for renewal", "serial", serial, "not_after", cert.NotAfter, "renew_at", renewAt, "next_check", time.Now().Add(wait))
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			c.log.Info("Stopping renewal watch")
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// reset forgets the key, CSR and certificate of an earlier request.
+func (c *Command) reset() {
+	if closer, ok := c.privKey.(io.Closer); ok {
+		closer.Close()
+	}
+	c.privKey, c.keyPath, c.csr, c.csrPath, c.cert = nil, "", nil, "", nil
+}
+
+// renewNow issues a new certificate and returns how long to wait before the next check.
+func (c *Command) renewNow(ctx context.Context, interval time.Duration) time.Duration {
+	c.reset()
+	if err := c.Issue(ctx); err != nil {
+		if errors.Is(err, ErrPending) {
+			wait := c.cfg.Pending.PollInterval
+			if wait <= 0 || wait > interval {
+				wait = interval
+			}
+			c.log.Info("Certificate request pending, checking again later", "retry_in", wait)
+			return wait
+		}
+		c.log.Error("Renewal failed, retrying later", "error", err, "retry_in", interval)
+		return interval
+	}
+	if c.cert == nil {
+		c.log.Warn("No certificate was issued, retrying later", "retry_in", interval)
+		return interval
+	}
+	c.log.Info("Renewal completed", "serial", c.cert.Certificate.SerialNumber.String())
+	return 0
 }
@@ -0,0 +1,1117 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/dstout-devops/hephaestus/internal/builtins"
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/dstout-devops/hephaestus/internal/esf"
+	"github.com/dstout-devops/hephaestus/internal/keys"
+	"github.com/dstout-devops/hephaestus/internal/pending"
+	"github.com/dstout-devops/hephaestus/internal/registry"
+	"github.com/dstout-devops/hephaestus/internal/verify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// staticConfigLoader returns a fixed configuration for testing.
+type staticConfigLoader struct {
+	cfg config.Config
+}
+
+func (l *staticConfigLoader) LoadConfig() (config.Config, error) {
+	return l.cfg, nil
+}
+
+// memFileWriter records written files in memory for testing.
+type memFileWriter struct {
+	files map[string][]byte
+}
+
+func (w *memFileWriter) WriteFile(filename string, data []byte, _ os.FileMode) error {
+	if w.files == nil {
+		w.files = make(map[string][]byte)
+	}
+	w.files[filename] = data
+	return nil
+}
+
+func (w *memFileWriter) Rename(oldpath, newpath string) error {
+	data, ok := w.files[oldpath]
+	if !ok {
+		return os.ErrNotExist
+	}
+	delete(w.files, oldpath)
+	w.files[newpath] = data
+	return nil
+}
+
+// esfIDs are placeholder ESF identifiers that satisfy config validation.
+var esfIDs = config.ESFConfig{ProgramID: "1", ServiceID: "1", ApplicationID: "1"}
+
+// TestRun_GeneratesKey tests that Run generates a new key and CSR from config.
+func TestRun_GeneratesKey(t *testing.T) {
+	cfg := config.Config{
+		Key: config.KeyConfig{Type: "ecdsa", Curve: "P-256"},
+		CSR: config.CSRConfig{CommonName: "test.com"},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, nil)
+
+	require.NoError(t, cmd.Run(context.Background()), "Run should not return an error")
+	assert.NotNil(t, cmd.privKey, "Expected a generated private key")
+	assert.NotEmpty(t, cmd.csr, "Expected a generated CSR")
+	assert.Contains(t, writer.files, "private.key", "Expected the generated key to be written")
+	assert.Equal(t, cmd.csr, writer.files["host.csr"], "Expected the CSR to be written")
+}
+
+// TestRun_KeyInput tests that Run reuses an existing encrypted key when key.input is set.
+func TestRun_KeyInput(t *testing.T) {
+	privKey, err := keys.GenerateECDSAKey("P-256")
+	require.NoError(t, err, "Failed to generate key for testing")
+	pemKey, err := keys.SerializePrivateKey(privKey, "secret")
+	require.NoError(t, err, "Failed to serialize key for testing")
+
+	keyPath := filepath.Join(t.TempDir(), "existing.key")
+	require.NoError(t, os.WriteFile(keyPath, pemKey, 0600))
+	t.Setenv("TEST_INPUT_PASSPHRASE", "secret")
+
+	cfg := config.Config{
+		Key: config.KeyConfig{Input: keyPath, Passphrase: config.PassphraseConfig{Env: "TEST_INPUT_PASSPHRASE"}},
+		CSR: config.CSRConfig{CommonName: "test.com"},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, nil)
+
+	require.NoError(t, cmd.Run(context.Background()), "Run should not return an error")
+	assert.True(t, privKey.Equal(cmd.privKey), "Expected the loaded key to match the input key")
+	assert.NotContains(t, writer.files, "private.key", "An input key should not be rewritten")
+
+	// The CSR must carry the public key of the input key
+	block, _ := pem.Decode(cmd.csr)
+	require.NotNil(t, block, "PEM decoding should return a non-nil block")
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err, "failed to parse CSR")
+	assert.True(t, privKey.PublicKey.Equal(csr.PublicKey), "CSR public key should match the input key")
+}
+
+// TestRun_KeyInputWrongPassphrase tests that Run fails when the input key cannot be decrypted.
+func TestRun_KeyInputWrongPassphrase(t *testing.T) {
+	privKey, err := keys.GenerateEd25519Key()
+	require.NoError(t, err, "Failed to generate key for testing")
+	pemKey, err := keys.SerializePrivateKey(privKey, "secret")
+	require.NoError(t, err, "Failed to serialize key for testing")
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "existing.key")
+	require.NoError(t, os.WriteFile(keyPath, pemKey, 0600))
+	passPath := filepath.Join(dir, "passphrase")
+	require.NoError(t, os.WriteFile(passPath, []byte("wrong\n"), 0600))
+
+	cfg := config.Config{
+		Key: config.KeyConfig{Input: keyPath, Passphrase: config.PassphraseConfig{File: passPath}},
+		CSR: config.CSRConfig{CommonName: "test.com"},
+	}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, &memFileWriter{}, nil)
+
+	err = cmd.Run(context.Background())
+	require.Error(t, err, "Run should fail with the wrong passphrase")
+	assert.Contains(t, err.Error(), "private key loading failed", "Expected key loading error")
+}
+
+// TestRun_KeyEncryption tests that key.output is encrypted with the
+// key.encryption passphrase and read back with it.
+func TestRun_KeyEncryption(t *testing.T) {
+	t.Setenv("TEST_KEY_PASSPHRASE", "secret")
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "private.key")
+	cfg := config.Config{
+		Key: config.KeyConfig{
+			Type:   "ecdsa",
+			Output: keyPath,
+			Encryption: config.KeyEncryptionConfig{
+				Passphrase: config.PassphraseConfig{Env: "TEST_KEY_PASSPHRASE"},
+				Cipher:     "aes-128-gcm",
+				KDF:        "scrypt",
+				Scrypt:     config.ScryptConfig{N: 1024, R: 8, P: 1},
+			},
+		},
+		CSR: config.CSRConfig{CommonName: "test.com", Output: filepath.Join(dir, "host.csr")},
+	}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, &DefaultFileWriter{}, nil)
+	require.NoError(t, cmd.Run(context.Background()), "Run should not return an error")
+
+	pemKey, err := os.ReadFile(keyPath)
+	require.NoError(t, err)
+	assert.True(t, keys.IsEncrypted(pemKey), "Expected an encrypted key")
+	saved, err := keys.ParsePrivateKey(pemKey, "secret")
+	require.NoError(t, err, "Expected the key to decrypt with the configured passphrase")
+	assert.True(t, saved.(*ecdsa.PrivateKey).Equal(cmd.privKey), "Expected the generated key")
+
+	// A fresh run loads the saved key with the same passphrase
+	cmd = NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, &memFileWriter{}, nil)
+	require.NoError(t, cmd.LoadConfig(context.Background()))
+	require.NoError(t, cmd.LoadKey(context.Background(), keyPath), "Expected the encrypted key to load")
+	assert.True(t, saved.(*ecdsa.PrivateKey).Equal(cmd.privKey), "Expected the saved key")
+}
+
+// TestRun_KeyEncryptionEmptyPassphrase tests that an empty passphrase
+// variable fails the run instead of saving the key unencrypted.
+func TestRun_KeyEncryptionEmptyPassphrase(t *testing.T) {
+	t.Setenv("TEST_KEY_PASSPHRASE", "")
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "private.key")
+	cfg := config.Config{
+		Key: config.KeyConfig{
+			Type:       "ecdsa",
+			Output:     keyPath,
+			Encryption: config.KeyEncryptionConfig{Passphrase: config.PassphraseConfig{Env: "TEST_KEY_PASSPHRASE"}},
+		},
+		CSR: config.CSRConfig{CommonName: "test.com", Output: filepath.Join(dir, "host.csr")},
+	}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, &DefaultFileWriter{}, nil)
+	err := cmd.Run(context.Background())
+	require.Error(t, err, "Run should fail with an empty passphrase")
+	assert.Contains(t, err.Error(), "environment variable TEST_KEY_PASSPHRASE is empty")
+	assert.NoFileExists(t, keyPath, "No key should be written")
+}
+
+// refKey is a non-exportable key that is saved as a test-ref URI.
+type refKey struct {
+	*ecdsa.PrivateKey
+	name string
+}
+
+func (k refKey) URI() string {
+	return "test-ref:" + k.name
+}
+
+// TestRun_KeyReference tests that a key implementing keys.Reference is saved
+// as its URI and loaded back through the key loader for its scheme.
+func TestRun_KeyReference(t *testing.T) {
+	tokenKey, err := keys.GenerateECDSAKey("P-256")
+	require.NoError(t, err, "Failed to generate key for testing")
+	registry.RegisterKeyGenerator("test-reference", func(cfg config.KeyConfig) (crypto.PrivateKey, error) {
+		return refKey{tokenKey, "web"}, nil
+	})
+	var loaded string
+	registry.RegisterKeyLoader("test-ref", func(uri string, cfg config.KeyConfig) (crypto.PrivateKey, error) {
+		loaded = uri
+		return refKey{tokenKey, strings.TrimPrefix(uri, "test-ref:")}, nil
+	})
+
+	cfg := config.Config{
+		Key: config.KeyConfig{Type: "test-reference"},
+		CSR: config.CSRConfig{CommonName: "test.com"},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, nil)
+	require.NoError(t, cmd.Run(context.Background()), "Run should not return an error")
+	assert.Equal(t, "test-ref:web\n", string(writer.files["private.key"]), "Expected only the key reference to be written")
+
+	keyPath := filepath.Join(t.TempDir(), "private.key")
+	require.NoError(t, os.WriteFile(keyPath, writer.files["private.key"], 0600))
+	cfg.Key = config.KeyConfig{Input: keyPath}
+	cmd = NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, &memFileWriter{}, nil)
+	require.NoError(t, cmd.Run(context.Background()), "Run should not return an error")
+	assert.Equal(t, "test-ref:web", loaded, "Expected the reference to reach the key loader")
+	assert.IsType(t, refKey{}, cmd.privKey, "Expected the loaded key reference")
+}
+
+// newFakeCA starts an httptest server that signs submitted CSRs with a throwaway CA key.
+func newFakeCA(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(newCAHandler(t))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newCAHandler returns an ESF handler that signs submitted CSRs with a throwaway CA key.
+func newCAHandler(t *testing.T) http.Handler {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate CA key")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req esf.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		block, _ := pem.Decode([]byte(req.CSR))
+		if block == nil {
+			http.Error(w, "invalid CSR", http.StatusBadRequest)
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      csr.Subject,
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, csr.PublicKey, caKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(esf.Response{
+			Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		})
+	})
+}
+
+// TestRun_Submit tests that Run submits the CSR and writes the issued certificate.
+func TestRun_Submit(t *testing.T) {
+	srv := newFakeCA(t)
+
+	cfg := config.Config{
+		Key:         config.KeyConfig{Type: "ed25519"},
+		CSR:         config.CSRConfig{CommonName: "test.com"},
+		Endpoint:    srv.URL,
+		ESF:         esfIDs,
+		Certificate: config.CertificateConfig{Output: "issued.pem"},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, nil)
+
+	require.NoError(t, cmd.Run(context.Background()), "Run should not return an error")
+	require.Contains(t, writer.files, "issued.pem", "Expected certificate to be written to certificate.output")
+
+	block, _ := pem.Decode(writer.files["issued.pem"])
+	require.NotNil(t, block, "PEM decoding should return a non-nil block")
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err, "failed to parse certificate")
+	assert.Equal(t, "test.com", cert.Subject.CommonName, "Certificate subject should match CSR")
+}
+
+// renamingSubmitter issues certificates for the submitted key under another common name.
+type renamingSubmitter struct{}
+
+func (renamingSubmitter) Submit(_ context.Context, _ config.Config, csrPEM []byte) (*certs.Bundle, error) {
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "other.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, csr.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return certs.ParsePEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func (renamingSubmitter) Fetch(context.Context, config.Config, string) (*certs.Bundle, error) {
+	return nil, errors.New("not supported")
+}
+
+// TestRun_VerifyMismatch tests that a certificate not matching the request is
+// not written unless verification is disabled.
+func TestRun_VerifyMismatch(t *testing.T) {
+	cfg := config.Config{
+		Key:         config.KeyConfig{Type: "ecdsa"},
+		CSR:         config.CSRConfig{CommonName: "test.com"},
+		Endpoint:    "https://ca.example.com",
+		ESF:         esfIDs,
+		Certificate: config.CertificateConfig{Output: "issued.pem"},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, renamingSubmitter{})
+
+	err := cmd.Run(context.Background())
+	require.Error(t, err, "Run should fail when the certificate does not match")
+	assert.Contains(t, err.Error(), "certificate verification failed")
+	assert.Contains(t, err.Error(), `subject.common_name: want "test.com", got "other.com"`, "Expected the mismatch to be reported")
+	assert.NotContains(t, writer.files, "issued.pem", "No certificate should be written")
+
+	cfg.Verify.Disabled = true
+	writer = &memFileWriter{}
+	cmd = NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, renamingSubmitter{})
+	require.NoError(t, cmd.Run(context.Background()), "Run should not verify when disabled")
+	assert.Contains(t, writer.files, "issued.pem")
+}
+
+// TestRun_VerifySubject tests that verify.subject limits the subject check.
+func TestRun_VerifySubject(t *testing.T) {
+	cfg := config.Config{
+		Key:         config.KeyConfig{Type: "ecdsa"},
+		CSR:         config.CSRConfig{CommonName: "other.com", Organization: "Example"},
+		Endpoint:    "https://ca.example.com",
+		ESF:         esfIDs,
+		Certificate: config.CertificateConfig{Output: "issued.pem"},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, renamingSubmitter{})
+	err := cmd.Run(context.Background())
+	require.Error(t, err, "The organization should be checked by default")
+	assert.Contains(t, err.Error(), "subject.organization: want [Example], got none")
+
+	cfg.Verify.Subject = "cn"
+	writer = &memFileWriter{}
+	cmd = NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, renamingSubmitter{})
+	require.NoError(t, cmd.Run(context.Background()), "Only the common name should be checked")
+	assert.Contains(t, writer.files, "issued.pem")
+}
+
+// TestSubjectCheck tests the default subject check of each backend.
+func TestSubjectCheck(t *testing.T) {
+	tests := map[string]struct {
+		backend, subject, want string
+	}{
+		"default":  {"", "", verify.SubjectStrict},
+		"esf":      {"esf", "", verify.SubjectStrict},
+		"est":      {"est", "", verify.SubjectStrict},
+		"scep":     {"scep", "", verify.SubjectStrict},
+		"acme":     {"acme", "", verify.SubjectCN},
+		"vault":    {"vault", "", verify.SubjectCN},
+		"override": {"acme", "strict", verify.SubjectStrict},
+		"none":     {"esf", "none", verify.SubjectNone},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmd := &Command{cfg: config.Config{Backend: tt.backend, Verify: config.VerifyConfig{Subject: tt.subject}}}
+			assert.Equal(t, tt.want, cmd.subjectCheck())
+		})
+	}
+}
+
+// TestRun_VerifyTrustBundle tests that a certificate must chain to verify.trust_bundles.
+func TestRun_VerifyTrustBundle(t *testing.T) {
+	srv := newFakeCA(t)
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "roots.pem")
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Other Root"}, NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+
+	cfg := config.Config{
+		Key:         config.KeyConfig{Type: "ed25519"},
+		CSR:         config.CSRConfig{CommonName: "test.com"},
+		Endpoint:    srv.URL,
+		ESF:         esfIDs,
+		Certificate: config.CertificateConfig{Output: "issued.pem"},
+		Verify:      config.VerifyConfig{TrustBundles: []string{bundle}},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, nil)
+
+	err = cmd.Run(context.Background())
+	require.Error(t, err, "Run should fail for a certificate from an untrusted CA")
+	assert.Contains(t, err.Error(), "chain: want a path to the trust bundle")
+	assert.NotContains(t, writer.files, "issued.pem", "No certificate should be written")
+}
+
+// TestRun_SubmitFailure tests that Run reports a CA error.
+func TestRun_SubmitFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cfg := config.Config{
+		Key:      config.KeyConfig{Type: "ed25519"},
+		CSR:      config.CSRConfig{CommonName: "test.com"},
+		Endpoint: srv.URL,
+		ESF:      esfIDs,
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, nil)
+
+	err := cmd.Run(context.Background())
+	require.Error(t, err, "Run should fail when the CA rejects the request")
+	assert.Contains(t, err.Error(), "CSR submission failed", "Expected submission error")
+	assert.NotContains(t, writer.files, "certificate.pem", "No certificate should be written")
+}
+
+// TestRun_SubmitFailureKeepsKey tests that a failed renewal leaves the key
+// and certificate in use untouched, and that a successful one replaces both.
+func TestRun_SubmitFailureKeepsKey(t *testing.T) {
+	var down atomic.Bool
+	issue := newCAHandler(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "rejected", http.StatusBadRequest)
+			return
+		}
+		issue.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := config.Config{
+		Key:         config.KeyConfig{Type: "ecdsa", Output: filepath.Join(dir, "private.key")},
+		CSR:         config.CSRConfig{CommonName: "test.com", Output: filepath.Join(dir, "host.csr")},
+		Endpoint:    srv.URL,
+		ESF:         esfIDs,
+		Certificate: config.CertificateConfig{Output: filepath.Join(dir, "certificate.pem")},
+	}
+	require.NoError(t, NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil).Run(context.Background()))
+	keyPEM, err := os.ReadFile(cfg.Key.Output)
+	require.NoError(t, err)
+	certPEM, err := os.ReadFile(cfg.Certificate.Output)
+	require.NoError(t, err)
+
+	down.Store(true)
+	err = NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil).Run(context.Background())
+	require.Error(t, err, "Run should fail when the CA rejects the request")
+	assertFile(t, cfg.Key.Output, keyPEM, "The key in use should not be replaced")
+	assertFile(t, cfg.Certificate.Output, certPEM, "The certificate in use should not be replaced")
+
+	down.Store(false)
+	require.NoError(t, NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil).Run(context.Background()))
+	newKey, err := os.ReadFile(cfg.Key.Output)
+	require.NoError(t, err)
+	assert.NotEqual(t, keyPEM, newKey, "Expected the key to be replaced with the certificate")
+	key, err := keys.ParsePrivateKey(newKey, "")
+	require.NoError(t, err)
+	data, err := os.ReadFile(cfg.Certificate.Output)
+	require.NoError(t, err)
+	bundle, err := certs.ParsePEM(data)
+	require.NoError(t, err)
+	assert.True(t, key.(*ecdsa.PrivateKey).PublicKey.Equal(bundle.Certificate.PublicKey), "The certificate should be for the key in place")
+	assert.NoFileExists(t, cfg.Key.Output+".new")
+	assert.NoFileExists(t, cfg.Certificate.Output+".new")
+}
+
+// assertFile asserts that the file at path holds want.
+func assertFile(t *testing.T, path string, want []byte, msg string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, want, got, msg)
+}
+
+// reenrollSubmitter stands in for the EST backend: once est.client_cert
+// exists it loads the client certificate and key, as the TLS client does, and
+// records the certificate presented.
+type reenrollSubmitter struct {
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+	peer  *x509.Certificate // Client certificate of the last submission
+}
+
+func (s *reenrollSubmitter) Submit(_ context.Context, cfg config.Config, csrPEM []byte) (*certs.Bundle, error) {
+	s.peer = nil
+	if _, err := os.Stat(cfg.EST.ClientCert); err == nil {
+		pair, err := tls.LoadX509KeyPair(cfg.EST.ClientCert, cfg.EST.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		if s.peer, err = x509.ParseCertificate(pair.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.ca, csr.PublicKey, s.caKey)
+	if err != nil {
+		return nil, err
+	}
+	return certs.ParsePEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func (s *reenrollSubmitter) Fetch(context.Context, config.Config, string) (*certs.Bundle, error) {
+	return nil, errors.New("not supported")
+}
+
+// TestRun_ReenrollWithKeyOutput tests that est.client_key may be key.output:
+// the current key authenticates the re-enrollment and is replaced only after
+// the new certificate is saved.
+func TestRun_ReenrollWithKeyOutput(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Test CA"}, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	submitter := &reenrollSubmitter{ca: ca, caKey: caKey}
+
+	dir := t.TempDir()
+	keyPath, certPath := filepath.Join(dir, "private.key"), filepath.Join(dir, "certificate.pem")
+	cfg := config.Config{
+		Backend:     "est",
+		Key:         config.KeyConfig{Type: "ecdsa", Output: keyPath},
+		CSR:         config.CSRConfig{CommonName: "test.com", Output: filepath.Join(dir, "host.csr")},
+		EST:         config.ESTConfig{URL: "https://est.example.com", ClientCert: certPath, ClientKey: keyPath},
+		Certificate: config.CertificateConfig{Output: certPath},
+	}
+	require.NoError(t, NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, submitter).Run(context.Background()), "Initial enrollment should succeed")
+	assert.Nil(t, submitter.peer, "Initial enrollment should not present a client certificate")
+	first, err := tls.LoadX509KeyPair(certPath, keyPath)
+	require.NoError(t, err, "Expected a matching key and certificate")
+
+	require.NoError(t, NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, submitter).Run(context.Background()), "Re-enrollment should succeed")
+	require.NotNil(t, submitter.peer, "Expected the current certificate for client auth")
+	assert.Equal(t, first.Certificate[0], submitter.peer.Raw, "Expected the first certificate for client auth")
+	second, err := tls.LoadX509KeyPair(certPath, keyPath)
+	require.NoError(t, err, "Expected the new key and certificate to match")
+	assert.NotEqual(t, first.Certificate[0], second.Certificate[0], "Expected a new certificate")
+	assert.NoFileExists(t, keyPath+".new", "No staged key should remain")
+}
+
+// TestRun_SubmitRetries tests that Run retries while the CA is down for maintenance.
+func TestRun_SubmitRetries(t *testing.T) {
+	issue := newCAHandler(t)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		issue.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	cfg := config.Config{
+		Key:      config.KeyConfig{Type: "ed25519"},
+		CSR:      config.CSRConfig{CommonName: "test.com"},
+		Endpoint: srv.URL,
+		ESF:      esfIDs,
+		Retry:    config.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Hour},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, nil)
+
+	require.NoError(t, cmd.Run(context.Background()), "Run should succeed once the CA is back")
+	assert.Equal(t, int32(3), requests.Load(), "Expected two retries")
+	assert.Contains(t, writer.files, "certificate.pem")
+}
+
+// TestRun_SubmitTimeout tests that retry.timeout bounds the whole submission.
+func TestRun_SubmitTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done() // Never answer
+	}))
+	defer srv.Close()
+
+	cfg := config.Config{
+		Key:      config.KeyConfig{Type: "ed25519"},
+		CSR:      config.CSRConfig{CommonName: "test.com"},
+		Endpoint: srv.URL,
+		ESF:      esfIDs,
+		Retry:    config.RetryConfig{MaxAttempts: 5, Timeout: 100 * time.Millisecond},
+	}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, &memFileWriter{}, nil)
+
+	err := cmd.Run(context.Background())
+	require.Error(t, err, "Run should fail at the deadline")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// TestRun_Cancelled tests that Run stops when its context is cancelled.
+func TestRun_Cancelled(t *testing.T) {
+	cfg := config.Config{
+		Key: config.KeyConfig{Type: "ed25519"},
+		CSR: config.CSRConfig{CommonName: "test.com"},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, cmd.Run(ctx), context.Canceled)
+	assert.Empty(t, writer.files, "Nothing should be written after cancellation")
+}
+
+// pendingCA is an ESF server that holds requests for approval.
+type pendingCA struct {
+	*httptest.Server
+	mu       sync.Mutex
+	csr      string // CSR of the held request
+	approved bool
+	rejected bool
+	submits  int
+	fetches  int
+}
+
+// newPendingCA starts an ESF server that answers submissions with request ID
+// REQ-1 and issues the certificate on fetch once approved.
+func newPendingCA(t *testing.T) *pendingCA {
+	t.Helper()
+	issue := newCAHandler(t)
+	ca := &pendingCA{}
+	ca.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ca.mu.Lock()
+		defer ca.mu.Unlock()
+		if r.Method == http.MethodPost {
+			var req esf.Request
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			ca.csr, ca.submits = req.CSR, ca.submits+1
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(esf.Response{RequestID: "REQ-1"})
+			return
+		}
+		ca.fetches++
+		if ca.rejected {
+			http.Error(w, "request denied", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("request_id") != "REQ-1" {
+			http.Error(w, "unknown request", http.StatusNotFound)
+			return
+		}
+		if !ca.approved {
+			_ = json.NewEncoder(w).Encode(esf.Response{RequestID: "REQ-1"})
+			return
+		}
+		body, _ := json.Marshal(esf.Request{CSR: ca.csr})
+		issue.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	}))
+	t.Cleanup(ca.Close)
+	return ca
+}
+
+// approve lets the held request be issued.
+func (ca *pendingCA) approve() {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.approved = true
+}
+
+// pendingConfig returns a config that submits to ca and keeps every file in dir.
+func pendingConfig(ca *pendingCA, dir string) config.Config {
+	return config.Config{
+		Key:         config.KeyConfig{Type: "ecdsa", Curve: "P-256", Output: filepath.Join(dir, "private.key")},
+		CSR:         config.CSRConfig{CommonName: "test.com", Output: filepath.Join(dir, "host.csr")},
+		Endpoint:    ca.URL,
+		ESF:         esfIDs,
+		Certificate: config.CertificateConfig{Output: filepath.Join(dir, "certificate.pem")},
+		Pending:     config.PendingConfig{File: filepath.Join(dir, "pending.json")},
+	}
+}
+
+// TestRun_PendingResume tests that a pending request is saved and a later run
+// fetches its certificate instead of generating a new key and CSR.
+func TestRun_PendingResume(t *testing.T) {
+	ca := newPendingCA(t)
+	dir := t.TempDir()
+	cfg := pendingConfig(ca, dir)
+
+	err := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil).Run(context.Background())
+	require.ErrorIs(t, err, ErrPending, "Run should report the pending request")
+	req, err := pending.Load(cfg.Pending.File)
+	require.NoError(t, err)
+	require.NotNil(t, req, "Expected the pending request to be saved")
+	staged := cfg.Key.Output + ".new"
+	assert.Equal(t, pending.Request{Backend: "esf", RequestID: "REQ-1", Key: staged, CSR: cfg.CSR.Output, Submitted: req.Submitted}, *req)
+	keyPEM, err := os.ReadFile(staged)
+	require.NoError(t, err)
+	assert.NoFileExists(t, cfg.Key.Output, "The new key should not be in place before the certificate")
+	assert.NoFileExists(t, cfg.Certificate.Output)
+
+	err = NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil).Run(context.Background())
+	require.ErrorIs(t, err, ErrPending, "A run before approval should still be pending")
+
+	ca.approve()
+	require.NoError(t, NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil).Run(context.Background()))
+	assert.Equal(t, 1, ca.submits, "The CSR should be submitted only once")
+	assert.Equal(t, 2, ca.fetches)
+	assert.NoFileExists(t, cfg.Pending.File, "The completed request should be removed")
+
+	after, err := os.ReadFile(cfg.Key.Output)
+	require.NoError(t, err)
+	assert.Equal(t, keyPEM, after, "The staged key should be moved into place")
+	assert.NoFileExists(t, staged)
+	key, err := keys.ParsePrivateKey(keyPEM, "")
+	require.NoError(t, err)
+	data, err := os.ReadFile(cfg.Certificate.Output)
+	require.NoError(t, err)
+	bundle, err := certs.ParsePEM(data)
+	require.NoError(t, err)
+	assert.True(t, key.(*ecdsa.PrivateKey).PublicKey.Equal(bundle.Certificate.PublicKey), "The certificate should be for the original key")
+}
+
+// TestRun_PendingRejected tests that a rejected pending request is removed,
+// by a run that then makes a new request and by fetch.
+func TestRun_PendingRejected(t *testing.T) {
+	ca := newPendingCA(t)
+	dir := t.TempDir()
+	cfg := pendingConfig(ca, dir)
+	require.ErrorIs(t, NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil).Run(context.Background()), ErrPending)
+	first, err := os.ReadFile(cfg.CSR.Output)
+	require.NoError(t, err)
+
+	ca.mu.Lock()
+	ca.rejected = true
+	ca.mu.Unlock()
+	err = NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil).Run(context.Background())
+	require.ErrorIs(t, err, ErrPending, "Run should make a new request")
+	assert.Equal(t, 2, ca.submits, "Expected a new submission after the rejection")
+	second, err := os.ReadFile(cfg.CSR.Output)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second, "Expected a new key and CSR")
+
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil)
+	require.NoError(t, cmd.LoadConfig(context.Background()))
+	req, err := cmd.Pending()
+	require.NoError(t, err)
+	require.NotNil(t, req, "Expected the new request to be pending")
+	err = cmd.Resume(context.Background(), req, true)
+	var rerr *certs.RejectedError
+	require.ErrorAs(t, err, &rerr, "fetch should report the rejection")
+	assert.NoFileExists(t, cfg.Pending.File, "The rejected request should be removed")
+}
+
+// TestRun_PendingOtherBackend tests that a request pending with another backend is ignored.
+func TestRun_PendingOtherBackend(t *testing.T) {
+	srv := newFakeCA(t)
+	dir := t.TempDir()
+	cfg := pendingConfig(&pendingCA{Server: srv}, dir)
+	data, err := (&pending.Request{Backend: "est", RequestID: "REQ-9"}).Encode()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(cfg.Pending.File, data, 0600))
+
+	require.NoError(t, NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil).Run(context.Background()))
+	assert.FileExists(t, cfg.Certificate.Output, "Expected a new certificate from the configured backend")
+}
+
+// TestPollCertificate tests waiting for approval and giving up at the poll timeout.
+func TestPollCertificate(t *testing.T) {
+	ca := newPendingCA(t)
+	dir := t.TempDir()
+	cfg := pendingConfig(ca, dir)
+	require.ErrorIs(t, NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil).Run(context.Background()), ErrPending)
+
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil)
+	require.NoError(t, cmd.LoadConfig(context.Background()))
+	assert.ErrorIs(t, cmd.PollCertificate(context.Background(), "REQ-1"), ErrPending, "No poll timeout should check once")
+	assert.Equal(t, 1, ca.fetches)
+
+	cfg.Pending.PollInterval = 10 * time.Millisecond
+	cfg.Pending.PollTimeout = time.Minute
+	cmd = NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil)
+	require.NoError(t, cmd.LoadConfig(context.Background()))
+	req, err := cmd.Pending()
+	require.NoError(t, err)
+	require.NotNil(t, req)
+	time.AfterFunc(50*time.Millisecond, ca.approve)
+	require.NoError(t, cmd.Resume(context.Background(), req, true), "Resume should wait for approval")
+	assert.Greater(t, ca.fetches, 2, "Expected the request to be polled")
+	assert.FileExists(t, cfg.Certificate.Output)
+}
+
+// TestRun_SubmitPKCS12 tests that Run writes a password-protected PKCS#12 bundle.
+func TestRun_SubmitPKCS12(t *testing.T) {
+	srv := newFakeCA(t)
+	t.Setenv("TEST_P12_PASSWORD", "changeit")
+
+	cfg := config.Config{
+		Key:      config.KeyConfig{Type: "ecdsa"},
+		CSR:      config.CSRConfig{CommonName: "test.com"},
+		Endpoint: srv.URL,
+		ESF:      esfIDs,
+		Certificate: config.CertificateConfig{
+			Output:   "bundle.p12",
+			Format:   "pkcs12",
+			Password: config.PassphraseConfig{Env: "TEST_P12_PASSWORD"},
+		},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, nil)
+
+	require.NoError(t, cmd.Run(context.Background()), "Run should not return an error")
+	require.Contains(t, writer.files, "bundle.p12", "Expected bundle to be written to certificate.output")
+
+	key, cert, _, err := pkcs12.DecodeChain(writer.files["bundle.p12"], "changeit")
+	require.NoError(t, err, "failed to decode PKCS#12 bundle")
+	assert.Equal(t, "test.com", cert.Subject.CommonName, "Bundle certificate should match CSR")
+	assert.Equal(t, cmd.privKey, key, "Bundle key should match the generated key")
+}
+
+// TestRun_SubmitPKCS12NoPassword tests that a PKCS#12 bundle is not written without a password.
+func TestRun_SubmitPKCS12NoPassword(t *testing.T) {
+	srv := newFakeCA(t)
+
+	cfg := config.Config{
+		Key:         config.KeyConfig{Type: "ecdsa"},
+		CSR:         config.CSRConfig{CommonName: "test.com"},
+		Endpoint:    srv.URL,
+		ESF:         esfIDs,
+		Certificate: config.CertificateConfig{Output: "bundle.p12", Format: "pkcs12"},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, nil)
+
+	err := cmd.Run(context.Background())
+	require.Error(t, err, "Run should fail without a PKCS#12 password")
+	assert.ErrorIs(t, err, ErrConfig, "Expected a configuration error")
+	assert.Contains(t, err.Error(), "certificate.password", "Expected password field to be reported")
+	assert.NotContains(t, writer.files, "bundle.p12", "No bundle should be written")
+}
+
+// TestWatch tests that Watch issues a missing certificate and stops cleanly on cancellation.
+func TestWatch(t *testing.T) {
+	srv := newFakeCA(t)
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "certificate.pem")
+
+	cfg := config.Config{
+		Key:         config.KeyConfig{Type: "ed25519", Output: filepath.Join(dir, "private.key")},
+		CSR:         config.CSRConfig{CommonName: "test.com", Output: filepath.Join(dir, "host.csr")},
+		Endpoint:    srv.URL,
+		ESF:         esfIDs,
+		Certificate: config.CertificateConfig{Output: certPath},
+		Renew:       config.RenewConfig{CheckInterval: 10 * time.Millisecond},
+	}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cmd.Watch(ctx) }()
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(certPath)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond, "Expected Watch to issue the missing certificate")
+	first, err := os.ReadFile(certPath)
+	require.NoError(t, err)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err, "Watch should stop cleanly on cancellation")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch did not stop after cancellation")
+	}
+
+	// The fresh certificate is not due, so it must not have been replaced
+	second, err := os.ReadFile(certPath)
+	require.NoError(t, err)
+	assert.Equal(t, first, second, "Certificate should not be renewed before it is due")
+}
+
+// TestWatch_SubmitFailureKeepsKey tests that failed renewals in watch mode
+// leave the key and certificate in use untouched.
+func TestWatch_SubmitFailureKeepsKey(t *testing.T) {
+	var down atomic.Bool
+	var rejected atomic.Int32
+	issue := newCAHandler(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			rejected.Add(1)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		issue.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := config.Config{
+		Key:         config.KeyConfig{Type: "ecdsa", Output: filepath.Join(dir, "private.key")},
+		CSR:         config.CSRConfig{CommonName: "test.com", Output: filepath.Join(dir, "host.csr")},
+		Endpoint:    srv.URL,
+		ESF:         esfIDs,
+		Certificate: config.CertificateConfig{Output: filepath.Join(dir, "certificate.pem")},
+		Retry:       config.RetryConfig{MaxAttempts: 1},
+		Renew:       config.RenewConfig{Fraction: 0.0001, CheckInterval: 10 * time.Millisecond},
+	}
+	require.NoError(t, NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil).Run(context.Background()))
+	keyPEM, err := os.ReadFile(cfg.Key.Output)
+	require.NoError(t, err)
+	certPEM, err := os.ReadFile(cfg.Certificate.Output)
+	require.NoError(t, err)
+
+	down.Store(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil).Watch(ctx) }()
+	require.Eventually(t, func() bool { return rejected.Load() >= 3 }, 5*time.Second, 10*time.Millisecond, "Expected Watch to retry the renewal")
+	cancel()
+	require.NoError(t, <-done)
+
+	assertFile(t, cfg.Key.Output, keyPEM, "The key in use should not be replaced")
+	assertFile(t, cfg.Certificate.Output, certPEM, "The certificate in use should not be replaced")
+}
+
+// flakyConfigLoader returns cfg on the first load and an error after that.
+type flakyConfigLoader struct {
+	cfg   config.Config
+	loads atomic.Int32
+}
+
+func (l *flakyConfigLoader) LoadConfig() (config.Config, error) {
+	if l.loads.Add(1) > 1 {
+		return config.Config{}, errors.New("config.yml: yaml: line 3: mapping values are not allowed here")
+	}
+	return l.cfg, nil
+}
+
+// TestWatch_ConfigReloadFailure tests that Watch keeps running on the last
+// good configuration when a reload fails, but not when the first load does.
+func TestWatch_ConfigReloadFailure(t *testing.T) {
+	srv := newFakeCA(t)
+	dir := t.TempDir()
+	cfg := config.Config{
+		Key:         config.KeyConfig{Type: "ed25519", Output: filepath.Join(dir, "private.key")},
+		CSR:         config.CSRConfig{CommonName: "test.com", Output: filepath.Join(dir, "host.csr")},
+		Endpoint:    srv.URL,
+		ESF:         esfIDs,
+		Certificate: config.CertificateConfig{Output: filepath.Join(dir, "certificate.pem")},
+		Renew:       config.RenewConfig{CheckInterval: 10 * time.Millisecond},
+	}
+	loader := &flakyConfigLoader{cfg: cfg}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- NewCommand(nil, nil, loader, nil, nil).Watch(ctx) }()
+
+	require.Eventually(t, func() bool { return loader.loads.Load() >= 3 }, 5*time.Second, 10*time.Millisecond, "Expected Watch to keep checking")
+	select {
+	case err := <-done:
+		t.Fatalf("Watch stopped on a failed reload: %v", err)
+	default:
+	}
+	cancel()
+	require.NoError(t, <-done)
+	assert.FileExists(t, cfg.Certificate.Output, "Expected the certificate from the first configuration")
+
+	loader = &flakyConfigLoader{}
+	loader.loads.Store(1)
+	err := NewCommand(nil, nil, loader, nil, nil).Watch(context.Background())
+	assert.ErrorIs(t, err, ErrConfig, "A configuration that cannot be loaded at startup should be reported")
+}
+
+// TestRun_InvalidConfig tests that Run rejects an invalid configuration before generating anything.
+func TestRun_InvalidConfig(t *testing.T) {
+	cfg := config.Config{
+		Key: config.KeyConfig{Type: "rsa", Size: 1024},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, nil)
+
+	err := cmd.Run(context.Background())
+	require.Error(t, err, "Run should fail with an invalid configuration")
+	assert.ErrorIs(t, err, ErrConfig, "Expected a configuration error")
+	assert.Nil(t, cmd.privKey, "No key should be generated")
+	assert.Empty(t, writer.files, "Nothing should be written")
+}
+
+// TestLoadConfig_Require tests that only the required sections are checked,
+// so keygen and fetch work without the settings they never read.
+func TestLoadConfig_Require(t *testing.T) {
+	cfg := config.Config{
+		Key:     config.KeyConfig{Type: "ecdsa"},
+		Backend: "est",
+	}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil)
+	err := cmd.LoadConfig(context.Background())
+	require.Error(t, err, "All sections should be checked by default")
+	assert.Contains(t, err.Error(), "csr.common_name: must not be empty")
+	assert.Contains(t, err.Error(), "est.url: must be set for the est backend")
+
+	cmd.Require(config.SectionKey)
+	assert.NoError(t, cmd.LoadConfig(context.Background()), "keygen should not need the csr or est sections")
+
+	cmd.Require(config.SectionKey | config.SectionCA)
+	err = cmd.LoadConfig(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "est.url")
+	assert.NotContains(t, err.Error(), "csr.common_name", "fetch should not need the csr section")
+
+	cfg.Key.Type = "dsa"
+	cfg.Log.Level = "loud"
+	cmd = NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, nil, nil)
+	cmd.Require(config.SectionKey)
+	err = cmd.LoadConfig(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `key.type: must be one of`)
+	assert.Contains(t, err.Error(), "log.level", "The log section should always be checked")
+}
+
+// TestRun_RegisteredBackend tests that a submitter registered under a new
+// backend name is selected from the configuration.
+func TestRun_RegisteredBackend(t *testing.T) {
+	var got []byte
+	registry.RegisterSubmitter("test-registered", registry.SubmitterFunc(func(ctx context.Context, cfg config.Config, csrPEM []byte) (*certs.Bundle, error) {
+		got = csrPEM
+		return esf.NewClient(nil, cfg.Endpoint).Submit(ctx, esfIDs, csrPEM)
+	}))
+	srv := newFakeCA(t)
+
+	cfg := config.Config{
+		Key:         config.KeyConfig{Type: "ecdsa"},
+		CSR:         config.CSRConfig{CommonName: "test.com"},
+		Backend:     "test-registered",
+		Endpoint:    srv.URL,
+		Certificate: config.CertificateConfig{Output: "issued.pem"},
+	}
+	writer := &memFileWriter{}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, writer, nil)
+
+	require.NoError(t, cmd.Run(context.Background()), "Run should not return an error")
+	assert.Equal(t, writer.files["host.csr"], got, "Expected the generated CSR to reach the registered submitter")
+	assert.Contains(t, writer.files, "issued.pem", "Expected certificate to be written to certificate.output")
+}
+
+// TestRun_UnregisteredNames tests that names without a registered
+// implementation are reported as configuration errors.
+func TestRun_UnregisteredNames(t *testing.T) {
+	cfg := config.Config{
+		Key:         config.KeyConfig{Type: "dsa"},
+		CSR:         config.CSRConfig{CommonName: "test.com", Builder: "crmf"},
+		Backend:     "carrier-pigeon",
+		Certificate: config.CertificateConfig{Format: "jks"},
+	}
+	cmd := NewCommand(nil, nil, &staticConfigLoader{cfg: cfg}, &memFileWriter{}, nil)
+
+	err := cmd.Run(context.Background())
+	require.ErrorIs(t, err, ErrConfig, "Expected a configuration error")
+	assert.Regexp(t, `key.type: must be one of ecdsa, ed25519, pkcs11, rsa.*, got "dsa"`, err.Error())
+	assert.Contains(t, err.Error(), `csr.builder: must be one of pkcs10, got "crmf"`)
+	assert.Regexp(t, `backend: must be one of acme, esf, est, scep, .*vault, got "carrier-pigeon"`, err.Error())
+	assert.Contains(t, err.Error(), `certificate.format: must be one of pem, pkcs12, got "jks"`)
+}
@@ -5,11 +5,16 @@ import "os"
 // FileWriter defines an interface for writing files.
 type FileWriter interface {
 	WriteFile(filename string, data []byte, perm os.FileMode) error
+	Rename(oldpath, newpath string) error
 }
 
-// DefaultFileWriter implements FileWriter using os.WriteFile.
+// DefaultFileWriter implements FileWriter using os.WriteFile and os.Rename.
 type DefaultFileWriter struct{}
 
 func (d *DefaultFileWriter) WriteFile(filename string, data []byte, perm os.FileMode) error {
 	return os.WriteFile(filename, data, perm)
 }
+
+func (d *DefaultFileWriter) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
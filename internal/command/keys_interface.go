@@ -1,23 +1,25 @@
 package command
 
 import (
-	"crypto/ed25519"
-	"crypto/rsa"
+	"context"
+	"crypto"
 
-	"github.com/dstout-devops/hephaestus/internal/keys"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/dstout-devops/hephaestus/internal/registry"
 )
 
+// KeyGenerator defines an interface for generating private keys.
 type KeyGenerator interface {
-	GenerateEd25519Key() (ed25519.PrivateKey, error)
-	GenerateRSAKey(bits int) (*rsa.PrivateKey, error)
+	GenerateKey(ctx context.Context, cfg config.KeyConfig) (crypto.PrivateKey, error)
 }
 
+// DefaultKeyGenerator implements KeyGenerator with the generator registered for key.type.
 type DefaultKeyGenerator struct{}
 
-func (d *DefaultKeyGenerator) GenerateEd25519Key() (ed25519.PrivateKey, error) {
-	return keys.GenerateEd25519Key()
-}
-
-func (d *DefaultKeyGenerator) GenerateRSAKey(bits int) (*rsa.PrivateKey, error) {
-	return keys.GenerateRSAKey(bits)
+func (d *DefaultKeyGenerator) GenerateKey(_ context.Context, cfg config.KeyConfig) (crypto.PrivateKey, error) {
+	gen, err := registry.LookupKeyGenerator(cfg.Type)
+	if err != nil {
+		return nil, err
+	}
+	return gen(cfg)
 }
@@ -0,0 +1,39 @@
+package command
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/dstout-devops/hephaestus/internal/registry"
+)
+
+// Submitter defines an interface for submitting a CSR to a CA and retrieving the certificate.
+type Submitter interface {
+	Submit(ctx context.Context, cfg config.Config, csrPEM []byte) (*certs.Bundle, error)
+	Fetch(ctx context.Context, cfg config.Config, requestID string) (*certs.Bundle, error)
+}
+
+// DefaultSubmitter implements Submitter with the submitter registered for the configured backend.
+type DefaultSubmitter struct{}
+
+func (d *DefaultSubmitter) Submit(ctx context.Context, cfg config.Config, csrPEM []byte) (*certs.Bundle, error) {
+	submitter, err := registry.LookupSubmitter(cfg.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return submitter.Submit(ctx, cfg, csrPEM)
+}
+
+func (d *DefaultSubmitter) Fetch(ctx context.Context, cfg config.Config, requestID string) (*certs.Bundle, error) {
+	submitter, err := registry.LookupSubmitter(cfg.Backend)
+	if err != nil {
+		return nil, err
+	}
+	fetcher, ok := submitter.(registry.Fetcher)
+	if !ok {
+		return nil, fmt.Errorf("fetch is not supported by the %s backend", cfg.Backend)
+	}
+	return fetcher.Fetch(ctx, cfg, requestID)
+}
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"reflect"
+	"strings"
+	"time"
 
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -14,27 +19,108 @@ type ConfigLoader interface {
 type Config struct {
 	Key         KeyConfig         `mapstructure:"key"`
 	CSR         CSRConfig         `mapstructure:"csr"`
+	Backend     string            `mapstructure:"backend"` // CA backend: esf (default), acme, est, scep or vault
 	Endpoint    string            `mapstructure:"endpoint"`
+	TLS         TLSConfig         `mapstructure:"tls"`
+	Retry       RetryConfig       `mapstructure:"retry"`
 	ESF         ESFConfig         `mapstructure:"esf"`
+	ACME        ACMEConfig        `mapstructure:"acme"`
+	EST         ESTConfig         `mapstructure:"est"`
+	SCEP        SCEPConfig        `mapstructure:"scep"`
+	Vault       VaultConfig       `mapstructure:"vault"`
 	Certificate CertificateConfig `mapstructure:"certificate"`
+	Verify      VerifyConfig      `mapstructure:"verify"`
+	Pending     PendingConfig     `mapstructure:"pending"`
+	Renew       RenewConfig       `mapstructure:"renew"`
+	Log         LogConfig         `mapstructure:"log"`
 }
 
 // KeyConfig holds key-related settings.
 type KeyConfig struct {
-	Type   string `mapstructure:"type"`
-	Size   int    `mapstructure:"bits"`
-	Output string `mapstructure:"output"`
+	Type       string              `mapstructure:"type"`
+	Size       int                 `mapstructure:"bits"`
+	Curve      string              `mapstructure:"curve"`
+	Output     string              `mapstructure:"output"`
+	Format     string              `mapstructure:"format"`     // Encoding of key.output: pkcs8 (default), pkcs1, sec1 or openssh
+	Input      string              `mapstructure:"input"`      // Existing private key or PKCS#11 key reference to reuse instead of generating one
+	Passphrase PassphraseConfig    `mapstructure:"passphrase"` // Passphrase source for an encrypted input key
+	PKCS11     PKCS11Config        `mapstructure:"pkcs11"`     // Token holding the key when type is pkcs11
+	Encryption KeyEncryptionConfig `mapstructure:"encryption"` // Passphrase protection for key.output
+}
+
+// KeyEncryptionConfig encrypts the saved private key as a PBES2 PKCS#8 key.
+type KeyEncryptionConfig struct {
+	Passphrase PassphraseConfig `mapstructure:"passphrase"` // Passphrase source; when unset the key is saved unencrypted
+	Cipher     string           `mapstructure:"cipher"`     // aes-256-cbc (default), aes-192-cbc, aes-128-cbc, aes-256-gcm, aes-192-gcm or aes-128-gcm
+	KDF        string           `mapstructure:"kdf"`        // pbkdf2 (default) or scrypt
+	Iterations int              `mapstructure:"iterations"` // PBKDF2 iteration count
+	Scrypt     ScryptConfig     `mapstructure:"scrypt"`     // scrypt cost parameters
+}
+
+// ScryptConfig holds the scrypt cost parameters.
+type ScryptConfig struct {
+	N int `mapstructure:"n"` // CPU/memory cost, a power of two
+	R int `mapstructure:"r"` // Block size
+	P int `mapstructure:"p"` // Parallelization
+}
+
+// PKCS11Config locates a non-exportable key inside a PKCS#11 token, such as an HSM.
+type PKCS11Config struct {
+	Module     string           `mapstructure:"module"`      // PKCS#11 library, e.g. /usr/lib/softhsm/libsofthsm2.so
+	Slot       *uint            `mapstructure:"slot"`        // Slot ID of the token
+	TokenLabel string           `mapstructure:"token_label"` // Label of the token, instead of or as well as slot
+	Label      string           `mapstructure:"label"`       // Label of the key; an existing key is reused, otherwise one is generated
+	KeyType    string           `mapstructure:"key_type"`    // rsa or ecdsa (default), sized by key.bits or key.curve
+	PIN        PassphraseConfig `mapstructure:"pin"`         // User PIN source
 }
 
 // CSRConfig holds CSR-related settings.
 type CSRConfig struct {
-	CommonName         string `mapstructure:"common_name"`
-	Organization       string `mapstructure:"organization"`
-	OrganizationalUnit string `mapstructure:"organizational_unit"`
-	Country            string `mapstructure:"country"`
-	State              string `mapstructure:"state"`
-	Locality           string `mapstructure:"locality"`
-	IPAddress          string `mapstructure:"ip_address"`
+	CommonName         string           `mapstructure:"common_name"`
+	Organization       string           `mapstructure:"organization"`
+	OrganizationalUnit string           `mapstructure:"organizational_unit"`
+	Country            string           `mapstructure:"country"`
+	State              string           `mapstructure:"state"`
+	Locality           string           `mapstructure:"locality"`
+	IPAddress          string           `mapstructure:"ip_address"`
+	DNSNames           []string         `mapstructure:"dns_names"`          // Subject Alternative Name DNS entries
+	IPAddresses        []string         `mapstructure:"ip_addresses"`       // Subject Alternative Name IP entries
+	EmailAddresses     []string         `mapstructure:"email_addresses"`    // Subject Alternative Name email entries
+	URIs               []string         `mapstructure:"uris"`               // Subject Alternative Name URI entries
+	ChallengePassword  PassphraseConfig `mapstructure:"challenge_password"` // PKCS#9 challenge password source, as SCEP servers expect
+	KeyUsage           []string         `mapstructure:"key_usage"`          // Requested key usages, e.g. digital_signature, key_encipherment
+	ExtendedKeyUsage   []string         `mapstructure:"extended_key_usage"` // Requested extended key usages by name, e.g. server_auth, or dotted OID
+	Extensions         []ValueConfig    `mapstructure:"extensions"`         // Additional requested extensions, e.g. a private OID for the CA
+	Attributes         []ValueConfig    `mapstructure:"attributes"`         // Additional PKCS#9 attributes
+	Builder            string           `mapstructure:"builder"`            // Registered CSR builder, pkcs10 by default
+	Output             string           `mapstructure:"output"`
+}
+
+// ValueConfig describes a custom CSR extension or attribute.
+type ValueConfig struct {
+	OID      string `mapstructure:"oid"`      // Dotted OID; attributes also accept a PKCS#9 name such as unstructured_name
+	Critical bool   `mapstructure:"critical"` // Mark the extension critical; not used for attributes
+	Type     string `mapstructure:"type"`     // utf8 (default), ia5, printable, or der for a hex-encoded DER value
+	Value    string `mapstructure:"value"`
+}
+
+// TLSConfig holds TLS settings for connections to the CA.
+type TLSConfig struct {
+	CABundles  []string `mapstructure:"ca_bundles"`  // PEM files trusted in addition to the system roots
+	ClientCert string   `mapstructure:"client_cert"` // PEM certificate presented for mutual TLS
+	ClientKey  string   `mapstructure:"client_key"`  // Private key for client_cert
+	MinVersion string   `mapstructure:"min_version"` // 1.0, 1.1, 1.2 (default) or 1.3
+	ServerName string   `mapstructure:"server_name"` // Name verified in the server certificate instead of the URL host
+}
+
+// RetryConfig controls how requests to the CA are retried when it is
+// unavailable or rate limiting.
+type RetryConfig struct {
+	MaxAttempts    int           `mapstructure:"max_attempts"`    // Attempts per request, including the first
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"` // Wait before the first retry, doubled for each one after
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`     // Upper bound on the doubled wait and on Retry-After
+	RequestTimeout time.Duration `mapstructure:"request_timeout"` // Bound on each attempt
+	Timeout        time.Duration `mapstructure:"timeout"`         // Bound on a whole submission or fetch, 10m by default; none when 0
 }
 
 // ESFConfig holds ESF identifiers.
@@ -44,27 +130,216 @@ type ESFConfig struct {
 	ApplicationID string `mapstructure:"application_id"`
 }
 
+// ACMEConfig holds settings for the RFC 8555 ACME backend.
+type ACMEConfig struct {
+	DirectoryURL string `mapstructure:"directory_url"`
+	Email        string `mapstructure:"email"`       // Account contact address
+	AccountKey   string `mapstructure:"account_key"` // Account key path, created on first use
+	AcceptTOS    bool   `mapstructure:"accept_tos"`  // Agree to the CA's terms of service
+	Challenge    string `mapstructure:"challenge"`   // http-01 (default) or dns-01
+	Webroot      string `mapstructure:"webroot"`     // Directory served at /.well-known/acme-challenge/ for http-01
+	Hook         string `mapstructure:"hook"`        // Executable that presents and cleans up challenges
+}
+
+// ESTConfig holds settings for the RFC 7030 EST backend.
+type ESTConfig struct {
+	URL        string           `mapstructure:"url"`         // Server base URL, /.well-known/est is appended
+	Label      string           `mapstructure:"label"`       // Optional CA label path segment
+	Username   string           `mapstructure:"username"`    // HTTP basic auth user for initial enrollment
+	Password   PassphraseConfig `mapstructure:"password"`    // HTTP basic auth password source
+	ClientCert string           `mapstructure:"client_cert"` // Existing PEM certificate for TLS client auth; re-enrolls when present
+	ClientKey  string           `mapstructure:"client_key"`  // Private key for client_cert
+}
+
+// SCEPConfig holds settings for the RFC 8894 SCEP backend.
+type SCEPConfig struct {
+	URL          string        `mapstructure:"url"`           // Server URL, the operation is added as a query parameter
+	PollInterval time.Duration `mapstructure:"poll_interval"` // Wait between polls while a request is pending
+	PollTimeout  time.Duration `mapstructure:"poll_timeout"`  // Give up when a request is still pending after this long, at most retry.timeout
+}
+
+// VaultConfig holds settings for the HashiCorp Vault PKI secrets engine backend.
+type VaultConfig struct {
+	Address   string          `mapstructure:"address"`   // Vault server URL
+	Namespace string          `mapstructure:"namespace"` // Vault Enterprise namespace
+	Mount     string          `mapstructure:"mount"`     // PKI secrets engine mount path
+	Role      string          `mapstructure:"role"`      // PKI role used for pki/sign/<role>
+	TTL       time.Duration   `mapstructure:"ttl"`       // Requested certificate lifetime, role default when unset
+	Auth      VaultAuthConfig `mapstructure:"auth"`
+}
+
+// VaultAuthConfig holds how hephaestus authenticates to Vault.
+type VaultAuthConfig struct {
+	Method   string           `mapstructure:"method"`    // token (default), approle or kubernetes
+	Mount    string           `mapstructure:"mount"`     // Auth method mount path, defaults to the method name
+	Token    PassphraseConfig `mapstructure:"token"`     // token: Vault token source
+	RoleID   string           `mapstructure:"role_id"`   // approle: role ID
+	SecretID PassphraseConfig `mapstructure:"secret_id"` // approle: secret ID source
+	Role     string           `mapstructure:"role"`      // kubernetes: Vault role to log in as
+	JWTFile  string           `mapstructure:"jwt_file"`  // kubernetes: service account token path
+}
+
 // CertificateConfig holds certificate-related settings.
 type CertificateConfig struct {
-	Output string `mapstructure:"output"`
+	Output        string           `mapstructure:"output"`
+	Format        string           `mapstructure:"format"`         // pem (default) or pkcs12
+	PKCS12Profile string           `mapstructure:"pkcs12_profile"` // modern (default) or legacy
+	Password      PassphraseConfig `mapstructure:"password"`       // PKCS#12 bundle password source
+}
+
+// VerifyConfig controls the checks made on an issued certificate before it is written.
+type VerifyConfig struct {
+	Disabled     bool          `mapstructure:"disabled"`      // Write the certificate without checking it
+	TrustBundles []string      `mapstructure:"trust_bundles"` // PEM roots the certificate must chain to, not checked when empty
+	ClockSkew    time.Duration `mapstructure:"clock_skew"`    // Tolerance for a not_before slightly in the future
+	Subject      string        `mapstructure:"subject"`       // strict, cn or none; cn for acme and vault by default, strict otherwise
+}
+
+// PendingConfig holds settings for requests the CA accepts without issuing
+// the certificate at once.
+type PendingConfig struct {
+	File         string        `mapstructure:"file"`          // Where a pending request is saved until its certificate is fetched
+	PollInterval time.Duration `mapstructure:"poll_interval"` // Wait between checks while fetching, unless the CA suggests one
+	PollTimeout  time.Duration `mapstructure:"poll_timeout"`  // Stop fetching when still pending after this long, 0 to check once
+}
+
+// RenewConfig holds automatic renewal settings.
+type RenewConfig struct {
+	Fraction      float64       `mapstructure:"fraction"`       // Share of the lifetime after which to renew
+	DaysBefore    int           `mapstructure:"days_before"`    // Renew this many days before expiry, overrides fraction
+	Jitter        time.Duration `mapstructure:"jitter"`         // Maximum random delay subtracted from the renewal time
+	CheckInterval time.Duration `mapstructure:"check_interval"` // How often watch mode re-reads the certificate
+}
+
+// LogConfig holds logging settings.
+type LogConfig struct {
+	Format string `mapstructure:"format"` // text (default) or json
+	Level  string `mapstructure:"level"`  // debug, info (default), warn or error
+	Output string `mapstructure:"output"` // stdout (default), stderr or file
+	File   string `mapstructure:"file"`   // Log file path when output is file
+}
+
+// PassphraseConfig names where a secret is read from, keeping it out of the config file.
+type PassphraseConfig struct {
+	Env     string `mapstructure:"env"`     // Environment variable holding the secret
+	File    string `mapstructure:"file"`    // File holding the secret
+	Command string `mapstructure:"command"` // Command printing the secret, run without a shell
+	Prompt  bool   `mapstructure:"prompt"`  // Ask for the secret on the terminal
+}
+
+// IsSet reports whether any source is configured. A command of only
+// whitespace does not count.
+func (p PassphraseConfig) IsSet() bool {
+	return p.Env != "" || p.File != "" || strings.TrimSpace(p.Command) != "" || p.Prompt
 }
 
 // ViperConfigLoader implements the ConfigLoader interface using Viper.
 type ViperConfigLoader struct {
-	v *viper.Viper
+	v          *viper.Viper
+	configPath string
+	keys       map[string]bool // Every known configuration key, true when it can be overridden
 }
 
+// EnvPrefix prefixes the environment variables that override config values.
+// Nested keys join with underscores, so csr.common_name is read from
+// HEPHAESTUS_CSR_COMMON_NAME. List values are comma separated.
+const EnvPrefix = "HEPHAESTUS"
+
 // NewViperConfigLoader creates a new ViperConfigLoader with default settings.
+// Values are resolved in order of precedence: flags, environment, config file, defaults.
 func NewViperConfigLoader() *ViperConfigLoader {
 	v := viper.New()
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	keys := make(map[string]bool)
+	bindEnvs(v, reflect.TypeOf(Config{}), "", keys)
+
 	v.SetDefault("key.output", "private.key")
+	v.SetDefault("csr.output", "host.csr")
 	v.SetDefault("certificate.output", "certificate.pem")
-	return &ViperConfigLoader{v: v}
+	v.SetDefault("verify.clock_skew", "5m")
+	v.SetDefault("pending.file", "pending.json")
+	v.SetDefault("pending.poll_interval", "1m")
+	v.SetDefault("pending.poll_timeout", "1h")
+	v.SetDefault("renew.check_interval", "1h")
+	v.SetDefault("retry.max_attempts", 5)
+	v.SetDefault("retry.initial_backoff", "1s")
+	v.SetDefault("retry.max_backoff", "1m")
+	v.SetDefault("retry.request_timeout", "30s")
+	v.SetDefault("retry.timeout", "10m")
+	v.SetDefault("acme.account_key", "acme-account.key")
+	v.SetDefault("scep.poll_interval", "1m")
+	v.SetDefault("scep.poll_timeout", "10m")
+	v.SetDefault("vault.mount", "pki")
+	v.SetDefault("vault.auth.method", "token")
+	v.SetDefault("vault.auth.token.env", "VAULT_TOKEN")
+	v.SetDefault("vault.auth.jwt_file", "/var/run/secrets/kubernetes.io/serviceaccount/token")
+	return &ViperConfigLoader{v: v, keys: keys}
+}
+
+// bindEnvs registers an environment variable for every key in t. Viper only
+// consults the environment for keys it knows about, so keys missing from the
+// config file would otherwise never be overridden. Lists of sections, such as
+// csr.extensions, cannot be given as a string and are recorded but not bound.
+func bindEnvs(v *viper.Viper, t reflect.Type, prefix string, keys map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if field.Type.Kind() == reflect.Struct {
+			bindEnvs(v, field.Type, key, keys)
+			continue
+		}
+		if k := field.Type.Kind(); k == reflect.Map || k == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct {
+			keys[key] = false
+			continue
+		}
+		keys[key] = true
+		_ = v.BindEnv(key) // Only fails without a key, which cannot happen here
+	}
+}
+
+// SetConfigFile sets an explicit config file path, taking precedence over CONFIG_PATH.
+func (l *ViperConfigLoader) SetConfigFile(path string) {
+	l.configPath = path
+}
+
+// BindFlag binds a command-line flag to a configuration key. The flag value
+// overrides the config file only when the flag is set on the command line.
+func (l *ViperConfigLoader) BindFlag(key string, flag *pflag.Flag) error {
+	return l.v.BindPFlag(key, flag)
+}
+
+// Override sets a configuration key from a "key=value" string, taking precedence
+// over flags, environment and file. List values are comma separated.
+func (l *ViperConfigLoader) Override(assignment string) error {
+	key, value, ok := strings.Cut(assignment, "=")
+	if !ok {
+		return fmt.Errorf("invalid override %q: expected key=value", assignment)
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	scalar, known := l.keys[key]
+	if !known {
+		return fmt.Errorf("invalid override %q: unknown key %s", assignment, key)
+	}
+	if !scalar {
+		return fmt.Errorf("invalid override %q: %s is a list of sections and can only be set in the config file", assignment, key)
+	}
+	l.v.Set(key, value)
+	return nil
 }
 
 // LoadConfig loads the configuration using the Viper instance.
 func (l *ViperConfigLoader) LoadConfig() (Config, error) {
-	configPath := os.Getenv("CONFIG_PATH")
+	configPath := l.configPath
+	if configPath == "" {
+		configPath = os.Getenv("CONFIG_PATH")
+	}
 	if configPath != "" {
 		l.v.SetConfigFile(configPath)
 	} else {
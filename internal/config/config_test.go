@@ -4,8 +4,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestViperConfigLoader_LoadConfig tests loading a complete config file.
@@ -71,6 +74,8 @@ csr:
 	// Check defaults set by Viper
 	assert.Equal(t, "private.key", cfg.Key.Output)
 	assert.Equal(t, "certificate.pem", cfg.Certificate.Output)
+	assert.Equal(t, RetryConfig{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Minute, RequestTimeout: 30 * time.Second, Timeout: 10 * time.Minute}, cfg.Retry)
+	assert.Equal(t, 5*time.Minute, cfg.Verify.ClockSkew)
 }
 
 // TestViperConfigLoader_LoadConfig_Error tests error when file is missing.
@@ -101,3 +106,125 @@ func TestViperConfigLoader_LoadConfig_Malformed(t *testing.T) {
 	_, err = loader.LoadConfig()
 	assert.Error(t, err)
 }
+
+// TestViperConfigLoader_BindFlag tests that set flags override the config file and unset flags do not.
+func TestViperConfigLoader_BindFlag(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	configData := []byte(`
+key:
+  type: "rsa"
+csr:
+  common_name: "example.com"
+  dns_names: ["example.com"]
+`)
+	require.NoError(t, os.WriteFile(configPath, configData, 0644))
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.String("key-type", "", "")
+	fs.String("cn", "", "")
+	fs.StringSlice("dns", nil, "")
+	require.NoError(t, fs.Parse([]string{"--key-type", "ecdsa", "--dns", "a.example.com", "--dns", "b.example.com"}))
+
+	loader := NewViperConfigLoader()
+	loader.SetConfigFile(configPath)
+	require.NoError(t, loader.BindFlag("key.type", fs.Lookup("key-type")))
+	require.NoError(t, loader.BindFlag("csr.common_name", fs.Lookup("cn")))
+	require.NoError(t, loader.BindFlag("csr.dns_names", fs.Lookup("dns")))
+
+	cfg, err := loader.LoadConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, "ecdsa", cfg.Key.Type, "Set flag should override the config file")
+	assert.Equal(t, "example.com", cfg.CSR.CommonName, "Unset flag should not override the config file")
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, cfg.CSR.DNSNames, "Slice flag should override the config file")
+	assert.Equal(t, "host.csr", cfg.CSR.Output, "Expected default CSR output")
+}
+
+// TestViperConfigLoader_Env tests that environment variables override the file and flags override both.
+func TestViperConfigLoader_Env(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	configData := []byte(`
+csr:
+  common_name: "file.example.com"
+  organization: "File Org"
+esf:
+  application_id: "1"
+`)
+	require.NoError(t, os.WriteFile(configPath, configData, 0644))
+
+	t.Setenv("HEPHAESTUS_CSR_COMMON_NAME", "env.example.com")
+	t.Setenv("HEPHAESTUS_CSR_ORGANIZATION", "Env Org")
+	t.Setenv("HEPHAESTUS_ESF_APPLICATION_ID", "42")
+	t.Setenv("HEPHAESTUS_CSR_DNS_NAMES", "a.example.com,b.example.com")
+	t.Setenv("HEPHAESTUS_CERTIFICATE_PASSWORD_ENV", "P12_PASSWORD")
+	t.Setenv("HEPHAESTUS_RENEW_JITTER", "30m")
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.String("cn", "", "")
+	fs.String("org", "", "")
+	require.NoError(t, fs.Parse([]string{"--cn", "flag.example.com"}))
+
+	loader := NewViperConfigLoader()
+	loader.SetConfigFile(configPath)
+	require.NoError(t, loader.BindFlag("csr.common_name", fs.Lookup("cn")))
+	require.NoError(t, loader.BindFlag("csr.organization", fs.Lookup("org")))
+
+	cfg, err := loader.LoadConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, "flag.example.com", cfg.CSR.CommonName, "Set flag should override env and file")
+	assert.Equal(t, "Env Org", cfg.CSR.Organization, "Env should override file when the flag is unset")
+	assert.Equal(t, "42", cfg.ESF.ApplicationID, "Env should override file")
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, cfg.CSR.DNSNames, "Env should set keys absent from the file")
+	assert.Equal(t, "P12_PASSWORD", cfg.Certificate.Password.Env, "Env should reach nested sections")
+	assert.Equal(t, 30*time.Minute, cfg.Renew.Jitter, "Env durations should be decoded")
+	assert.Equal(t, "private.key", cfg.Key.Output, "Defaults should apply when nothing overrides them")
+}
+
+// TestViperConfigLoader_Override tests key=value overrides.
+func TestViperConfigLoader_Override(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+csr:
+  common_name: "file.example.com"
+`), 0644))
+	t.Setenv("HEPHAESTUS_CSR_COMMON_NAME", "env.example.com")
+
+	loader := NewViperConfigLoader()
+	loader.SetConfigFile(configPath)
+	require.NoError(t, loader.Override("csr.common_name=set.example.com"))
+	require.NoError(t, loader.Override("csr.uris=spiffe://a,spiffe://b"))
+	require.NoError(t, loader.Override("ESF.Program_ID=7"))
+
+	cfg, err := loader.LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "set.example.com", cfg.CSR.CommonName, "Override should take precedence over env")
+	assert.Equal(t, []string{"spiffe://a", "spiffe://b"}, cfg.CSR.URIs, "List overrides should be comma separated")
+	assert.Equal(t, "7", cfg.ESF.ProgramID, "Override keys should be case-insensitive")
+
+	assert.EqualError(t, loader.Override("csr.common_name"), `invalid override "csr.common_name": expected key=value`)
+	assert.EqualError(t, loader.Override("csr.nope=1"), `invalid override "csr.nope=1": unknown key csr.nope`)
+	assert.EqualError(t, loader.Override("csr.extensions=1.2.3"), `invalid override "csr.extensions=1.2.3": csr.extensions is a list of sections and can only be set in the config file`)
+}
+
+// TestViperConfigLoader_SectionListsIgnoreEnv tests that lists of sections are
+// read from the config file only, as a string cannot describe them.
+func TestViperConfigLoader_SectionListsIgnoreEnv(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+csr:
+  extensions:
+    - oid: "1.3.6.1.4.1.99999.1"
+      value: "app"
+`), 0644))
+	t.Setenv("HEPHAESTUS_CSR_EXTENSIONS", "1.3.6.1.4.1.99999.2")
+	t.Setenv("HEPHAESTUS_CSR_ATTRIBUTES", "unstructured_name")
+
+	loader := NewViperConfigLoader()
+	loader.SetConfigFile(configPath)
+	cfg, err := loader.LoadConfig()
+	require.NoError(t, err, "The environment should not be decoded into lists of sections")
+	require.Len(t, cfg.CSR.Extensions, 1)
+	assert.Equal(t, "1.3.6.1.4.1.99999.1", cfg.CSR.Extensions[0].OID)
+	assert.Empty(t, cfg.CSR.Attributes)
+}
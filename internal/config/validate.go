@@ -0,0 +1,696 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"golang.org/x/net/idna"
+)
+
+// FieldError describes a problem with a single configuration field.
+type FieldError struct {
+	Path    string // YAML path of the field, e.g. "csr.dns_names[1]"
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError collects every problem found by Validate.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+	for _, fe := range e.Errors {
+		b.WriteString("\n  ")
+		b.WriteString(fe.Error())
+	}
+	return b.String()
+}
+
+// Section is a set of configuration sections a command uses, so it is not
+// refused for settings it never reads.
+type Section uint
+
+const (
+	SectionKey   Section = 1 << iota // key
+	SectionCSR                       // csr
+	SectionCA                        // backend, endpoint, the backend sections, tls, retry, certificate, verify and pending
+	SectionRenew                     // renew
+	AllSections  = SectionKey | SectionCSR | SectionCA | SectionRenew
+)
+
+// Covers reports whether the field at path belongs to one of the sections in
+// s. The log section is used by every command and is always covered.
+func (s Section) Covers(path string) bool {
+	root, _, _ := strings.Cut(path, ".")
+	root, _, _ = strings.Cut(root, "[")
+	switch root {
+	case "log":
+		return true
+	case "key":
+		return s&SectionKey != 0
+	case "csr":
+		return s&SectionCSR != 0
+	case "renew":
+		return s&SectionRenew != 0
+	}
+	return s&SectionCA != 0
+}
+
+// validator accumulates field errors.
+type validator struct {
+	errs []FieldError
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	v.errs = append(v.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks every section of the configuration and returns a
+// *ValidationError listing all problems, or nil if the configuration is valid.
+func (c Config) Validate() error {
+	v := &validator{}
+	c.Key.validate(v)
+	c.validatePassphrases(v)
+	c.CSR.validate(v)
+	c.validateKeyUsage(v)
+	c.validateBackend(v)
+	c.TLS.validate(v)
+	c.Retry.validate(v)
+	c.Certificate.validate(v)
+	if c.Key.Type == "pkcs11" && c.Key.Input == "" && c.Certificate.Format == "pkcs12" {
+		v.add("certificate.format", "pkcs12 cannot include a non-exportable pkcs11 key")
+	}
+	c.Verify.validate(v)
+	c.Pending.validate(v)
+	c.Renew.validate(v)
+	c.Log.validate(v)
+	if len(v.errs) > 0 {
+		return &ValidationError{Errors: v.errs}
+	}
+	return nil
+}
+
+func (k KeyConfig) validate(v *validator) {
+	k.Encryption.validate(v)
+	k.validateFormat(v)
+	if k.Input != "" {
+		// The type and parameters come from the existing key
+		return
+	}
+
+	switch k.Type {
+	case "rsa":
+		if k.Size < 2048 {
+			v.add("key.bits", "must be at least 2048 for rsa keys, got %d", k.Size)
+		}
+	case "ecdsa", "ed25519":
+		if k.Size != 0 {
+			v.add("key.bits", "only applies to rsa keys")
+		}
+	case "pkcs11":
+		k.validatePKCS11(v)
+		return
+	case "":
+		v.add("key.type", "must be set unless key.input is given")
+	}
+	// Other key types are checked against the registered key generators
+
+	switch {
+	case k.Type == "ecdsa":
+		switch k.Curve {
+		case "", "P-256", "P-384", "P-521":
+		default:
+			v.add("key.curve", "must be one of P-256, P-384, P-521, got %q", k.Curve)
+		}
+	case (k.Type == "rsa" || k.Type == "ed25519") && k.Curve != "":
+		v.add("key.curve", "only applies to ecdsa keys")
+	}
+}
+
+// validateFormat checks key.format against the key type and encryption.
+func (k KeyConfig) validateFormat(v *validator) {
+	switch k.Format {
+	case "", "pkcs8":
+		return
+	case "pkcs1", "sec1", "openssh":
+	default:
+		v.add("key.format", "must be one of pkcs8, pkcs1, sec1, openssh, got %q", k.Format)
+		return
+	}
+
+	if k.Input == "" {
+		switch {
+		case k.Type == "pkcs11":
+			v.add("key.format", "does not apply to pkcs11 keys, which are saved as a key reference")
+		case k.Format == "pkcs1" && k.Type != "rsa":
+			v.add("key.format", "pkcs1 only applies to rsa keys, got %q", k.Type)
+		case k.Format == "sec1" && k.Type != "ecdsa":
+			v.add("key.format", "sec1 only applies to ecdsa keys, got %q", k.Type)
+		}
+	}
+
+	e := k.Encryption
+	switch {
+	case k.Format != "openssh" && e.Passphrase.IsSet():
+		v.add("key.encryption", "%s keys cannot be encrypted, use pkcs8 or openssh", k.Format)
+	case e.Cipher != "" || e.KDF != "" || e.Iterations != 0 || e.Scrypt != (ScryptConfig{}):
+		v.add("key.encryption", "cipher and kdf only apply to pkcs8 keys, openssh keys use bcrypt with aes256-ctr")
+	}
+}
+
+func (k KeyConfig) validatePKCS11(v *validator) {
+	p := k.PKCS11
+	if p.Module == "" {
+		v.add("key.pkcs11.module", "must be set for pkcs11 keys")
+	}
+	if p.Label == "" {
+		v.add("key.pkcs11.label", "must be set for pkcs11 keys")
+	}
+	if !p.PIN.IsSet() {
+		v.add("key.pkcs11.pin", "must name a source for pkcs11 keys")
+	}
+	if k.Encryption.Passphrase.IsSet() {
+		v.add("key.encryption.passphrase", "does not apply to pkcs11 keys, which stay in the token")
+	}
+	switch p.KeyType {
+	case "rsa":
+		if k.Size < 2048 {
+			v.add("key.bits", "must be at least 2048 for rsa keys, got %d", k.Size)
+		}
+		if k.Curve != "" {
+			v.add("key.curve", "only applies to ecdsa keys")
+		}
+	case "", "ecdsa":
+		if k.Size != 0 {
+			v.add("key.bits", "only applies to rsa keys")
+		}
+		switch k.Curve {
+		case "", "P-256", "P-384", "P-521":
+		default:
+			v.add("key.curve", "must be one of P-256, P-384, P-521, got %q", k.Curve)
+		}
+	default:
+		v.add("key.pkcs11.key_type", "must be one of rsa, ecdsa, got %q", p.KeyType)
+	}
+}
+
+// validatePassphrases rejects passphrase commands of only whitespace, which
+// IsSet does not count as a source.
+func (c Config) validatePassphrases(v *validator) {
+	sources := []struct {
+		path string
+		src  PassphraseConfig
+	}{
+		{"key.passphrase", c.Key.Passphrase},
+		{"key.encryption.passphrase", c.Key.Encryption.Passphrase},
+		{"key.pkcs11.pin", c.Key.PKCS11.PIN},
+		{"csr.challenge_password", c.CSR.ChallengePassword},
+		{"est.password", c.EST.Password},
+		{"vault.auth.token", c.Vault.Auth.Token},
+		{"vault.auth.secret_id", c.Vault.Auth.SecretID},
+		{"certificate.password", c.Certificate.Password},
+	}
+	for _, s := range sources {
+		if s.src.Command != "" && strings.TrimSpace(s.src.Command) == "" {
+			v.add(s.path+".command", "must not be empty")
+		}
+	}
+}
+
+func (e KeyEncryptionConfig) validate(v *validator) {
+	configured := e.Cipher != "" || e.KDF != "" || e.Iterations != 0 || e.Scrypt != (ScryptConfig{})
+	if configured && !e.Passphrase.IsSet() {
+		v.add("key.encryption.passphrase", "must name a source when key.encryption is configured")
+	}
+	switch e.Cipher {
+	case "", "aes-128-cbc", "aes-192-cbc", "aes-256-cbc", "aes-128-gcm", "aes-192-gcm", "aes-256-gcm":
+	default:
+		v.add("key.encryption.cipher", "must be one of aes-128-cbc, aes-192-cbc, aes-256-cbc, aes-128-gcm, aes-192-gcm, aes-256-gcm, got %q", e.Cipher)
+	}
+
+	switch e.KDF {
+	case "", "pbkdf2":
+		if e.Iterations != 0 && e.Iterations < 1000 {
+			v.add("key.encryption.iterations", "must be at least 1000, got %d", e.Iterations)
+		}
+		if e.Scrypt != (ScryptConfig{}) {
+			v.add("key.encryption.scrypt", "only applies to the scrypt kdf")
+		}
+	case "scrypt":
+		if e.Iterations != 0 {
+			v.add("key.encryption.iterations", "only applies to the pbkdf2 kdf")
+		}
+		if n := e.Scrypt.N; n != 0 && (n < 2 || n&(n-1) != 0) {
+			v.add("key.encryption.scrypt.n", "must be a power of two greater than 1, got %d", n)
+		}
+		if e.Scrypt.R < 0 {
+			v.add("key.encryption.scrypt.r", "must not be negative, got %d", e.Scrypt.R)
+		}
+		if e.Scrypt.P < 0 {
+			v.add("key.encryption.scrypt.p", "must not be negative, got %d", e.Scrypt.P)
+		}
+	default:
+		v.add("key.encryption.kdf", "must be one of pbkdf2, scrypt, got %q", e.KDF)
+	}
+}
+
+func (c CSRConfig) validate(v *validator) {
+	if c.CommonName == "" {
+		v.add("csr.common_name", "must not be empty")
+	}
+	if c.Country != "" && !isCountryCode(c.Country) {
+		v.add("csr.country", "must be a two-letter ISO 3166-1 country code, got %q", c.Country)
+	}
+	if c.IPAddress != "" && net.ParseIP(c.IPAddress) == nil {
+		v.add("csr.ip_address", "invalid IP address %q", c.IPAddress)
+	}
+	for i, name := range c.DNSNames {
+		host := strings.TrimPrefix(name, "*.")
+		if ascii, err := idna.Lookup.ToASCII(host); err != nil || ascii == "" {
+			v.add(fmt.Sprintf("csr.dns_names[%d]", i), "invalid DNS name %q", name)
+		}
+	}
+	for i, addr := range c.IPAddresses {
+		if net.ParseIP(addr) == nil {
+			v.add(fmt.Sprintf("csr.ip_addresses[%d]", i), "invalid IP address %q", addr)
+		}
+	}
+	for i, addr := range c.EmailAddresses {
+		if parsed, err := mail.ParseAddress(addr); err != nil || parsed.Address != addr {
+			v.add(fmt.Sprintf("csr.email_addresses[%d]", i), "invalid email address %q", addr)
+		}
+	}
+	for i, raw := range c.URIs {
+		if u, err := url.Parse(raw); err != nil || !u.IsAbs() {
+			v.add(fmt.Sprintf("csr.uris[%d]", i), "invalid URI %q", raw)
+		}
+	}
+	validateUsageNames(v, "csr.key_usage", c.KeyUsage, func(name string) error {
+		_, err := certs.ParseKeyUsage([]string{name})
+		return err
+	})
+	validateUsageNames(v, "csr.extended_key_usage", c.ExtendedKeyUsage, func(name string) error {
+		_, err := certs.ParseExtKeyUsage([]string{name})
+		return err
+	})
+	c.validateExtensions(v)
+	c.validateAttributes(v)
+}
+
+// validateExtensions checks csr.extensions. Extensions that hephaestus
+// builds from other csr settings cannot be given again.
+func (c CSRConfig) validateExtensions(v *validator) {
+	reserved := map[string]string{"2.5.29.17": "csr.dns_names, csr.ip_addresses, csr.email_addresses and csr.uris"}
+	if len(c.KeyUsage) > 0 {
+		reserved["2.5.29.15"] = "csr.key_usage"
+	}
+	if len(c.ExtendedKeyUsage) > 0 {
+		reserved["2.5.29.37"] = "csr.extended_key_usage"
+	}
+	seen := make(map[string]bool)
+	for i, ext := range c.Extensions {
+		path := fmt.Sprintf("csr.extensions[%d]", i)
+		oid, err := certs.ParseOID(ext.OID)
+		if err != nil {
+			v.add(path+".oid", "must be a dotted OID, got %q", ext.OID)
+		} else if from, ok := reserved[oid.String()]; ok {
+			v.add(path+".oid", "extension %s is set by %s", oid, from)
+		} else if seen[oid.String()] {
+			v.add(path+".oid", "duplicate extension %s", oid)
+		} else {
+			seen[oid.String()] = true
+		}
+		validateValue(v, path, ext)
+	}
+}
+
+// validateAttributes checks csr.attributes.
+func (c CSRConfig) validateAttributes(v *validator) {
+	reserved := map[string]string{"1.2.840.113549.1.9.14": "csr.extensions"}
+	if c.ChallengePassword.IsSet() {
+		reserved["1.2.840.113549.1.9.7"] = "csr.challenge_password"
+	}
+	seen := make(map[string]bool)
+	for i, attr := range c.Attributes {
+		path := fmt.Sprintf("csr.attributes[%d]", i)
+		oid, err := certs.ParseAttributeOID(attr.OID)
+		if err != nil {
+			v.add(path+".oid", "must be a dotted OID or PKCS#9 attribute name, got %q", attr.OID)
+		} else if from, ok := reserved[oid.String()]; ok {
+			v.add(path+".oid", "attribute %s is set by %s", oid, from)
+		} else if seen[oid.String()] {
+			v.add(path+".oid", "duplicate attribute %s", oid)
+		} else {
+			seen[oid.String()] = true
+		}
+		if attr.Critical {
+			v.add(path+".critical", "only applies to extensions")
+		}
+		validateValue(v, path, attr)
+	}
+}
+
+// validateValue checks that the value of a custom extension or attribute
+// encodes as its type.
+func validateValue(v *validator, path string, val ValueConfig) {
+	switch val.Type {
+	case "", "utf8", "ia5", "printable", "der":
+	default:
+		v.add(path+".type", "must be one of utf8, ia5, printable, der, got %q", val.Type)
+		return
+	}
+	if _, err := certs.MarshalValue(val.Type, val.Value); err != nil {
+		v.add(path+".value", "%v", err)
+	}
+}
+
+// validateUsageNames checks each entry of a key usage list with parse and
+// rejects duplicates.
+func validateUsageNames(v *validator, path string, names []string, parse func(string) error) {
+	seen := make(map[string]bool)
+	for i, name := range names {
+		switch {
+		case parse(name) != nil:
+			v.add(fmt.Sprintf("%s[%d]", path, i), "unknown usage %q", name)
+		case seen[name]:
+			v.add(fmt.Sprintf("%s[%d]", path, i), "duplicate usage %q", name)
+		}
+		seen[name] = true
+	}
+}
+
+// validateKeyUsage checks csr.key_usage against the algorithm of the key
+// that will sign the request. For key.input the algorithm is not known yet
+// and is checked when the CSR is built.
+func (c Config) validateKeyUsage(v *validator) {
+	if len(c.CSR.KeyUsage) == 0 {
+		return
+	}
+	ku, err := certs.ParseKeyUsage(c.CSR.KeyUsage)
+	if err != nil {
+		return // Reported by CSRConfig.validate
+	}
+	var algorithm string
+	switch {
+	case c.Key.Input != "":
+	case c.Key.Type == "pkcs11":
+		algorithm = c.Key.PKCS11.KeyType
+		if algorithm == "" {
+			algorithm = "ecdsa"
+		}
+	case c.Key.Type == "rsa", c.Key.Type == "ecdsa", c.Key.Type == "ed25519":
+		algorithm = c.Key.Type
+	}
+	if err := certs.CheckKeyUsage(ku, algorithm); err != nil {
+		v.add("csr.key_usage", "%v", err)
+	}
+}
+
+func (c Config) validateBackend(v *validator) {
+	switch c.Backend {
+	case "", "esf":
+		c.validateEndpoint(v)
+	case "acme":
+		c.ACME.validate(v)
+	case "est":
+		c.EST.validate(v)
+	case "scep":
+		c.SCEP.validate(v)
+		if c.Retry.Timeout > 0 && c.SCEP.PollTimeout > c.Retry.Timeout {
+			v.add("scep.poll_timeout", "must not exceed retry.timeout (%s), which bounds polling, got %s", c.Retry.Timeout, c.SCEP.PollTimeout)
+		}
+	case "vault":
+		c.Vault.validate(v)
+	}
+	// Other backends are checked against the registered submitters
+}
+
+func (c Config) validateEndpoint(v *validator) {
+	if c.Endpoint == "" {
+		return
+	}
+	validateURL(v, "endpoint", c.Endpoint)
+
+	if c.ESF.ProgramID == "" {
+		v.add("esf.program_id", "must be set when endpoint is set")
+	}
+	if c.ESF.ServiceID == "" {
+		v.add("esf.service_id", "must be set when endpoint is set")
+	}
+	if c.ESF.ApplicationID == "" {
+		v.add("esf.application_id", "must be set when endpoint is set")
+	}
+}
+
+func (a ACMEConfig) validate(v *validator) {
+	if a.DirectoryURL == "" {
+		v.add("acme.directory_url", "must be set for the acme backend")
+	} else {
+		validateURL(v, "acme.directory_url", a.DirectoryURL)
+	}
+	if a.AccountKey == "" {
+		v.add("acme.account_key", "must not be empty")
+	}
+	switch a.Challenge {
+	case "", "http-01":
+		if a.Webroot == "" && a.Hook == "" {
+			v.add("acme.webroot", "either acme.webroot or acme.hook must be set for http-01")
+		}
+	case "dns-01":
+		if a.Hook == "" {
+			v.add("acme.hook", "must be set for dns-01")
+		}
+	default:
+		v.add("acme.challenge", "must be one of http-01, dns-01, got %q", a.Challenge)
+	}
+}
+
+// validate checks the est section: an https URL, basic auth credentials and
+// the client certificate used for re-enrollment.
+func (e ESTConfig) validate(v *validator) {
+	if e.URL == "" {
+		v.add("est.url", "must be set for the est backend")
+	} else if u, err := url.Parse(e.URL); err == nil && u.Scheme != "https" {
+		v.add("est.url", "must use the https scheme, got %q", e.URL)
+	} else {
+		validateURL(v, "est.url", e.URL)
+	}
+	if e.Password.IsSet() && e.Username == "" {
+		v.add("est.username", "must be set when est.password is set")
+	}
+	if (e.ClientCert == "") != (e.ClientKey == "") {
+		v.add("est.client_key", "est.client_cert and est.client_key must be set together")
+	}
+}
+
+func (s SCEPConfig) validate(v *validator) {
+	if s.URL == "" {
+		v.add("scep.url", "must be set for the scep backend")
+	} else {
+		validateURL(v, "scep.url", s.URL)
+	}
+	if s.PollInterval < 0 {
+		v.add("scep.poll_interval", "must not be negative, got %s", s.PollInterval)
+	}
+	if s.PollTimeout < 0 {
+		v.add("scep.poll_timeout", "must not be negative, got %s", s.PollTimeout)
+	}
+}
+
+func (c VaultConfig) validate(v *validator) {
+	if c.Address == "" {
+		v.add("vault.address", "must be set for the vault backend")
+	} else {
+		validateURL(v, "vault.address", c.Address)
+	}
+	if c.Mount == "" {
+		v.add("vault.mount", "must not be empty")
+	}
+	if c.Role == "" {
+		v.add("vault.role", "must be set for the vault backend")
+	}
+	if c.TTL < 0 {
+		v.add("vault.ttl", "must not be negative, got %s", c.TTL)
+	}
+
+	a := c.Auth
+	switch a.Method {
+	case "", "token":
+		if !a.Token.IsSet() {
+			v.add("vault.auth.token", "must name a source for token auth")
+		}
+	case "approle":
+		if a.RoleID == "" {
+			v.add("vault.auth.role_id", "must be set for approle auth")
+		}
+		if !a.SecretID.IsSet() {
+			v.add("vault.auth.secret_id", "must name a source for approle auth")
+		}
+	case "kubernetes":
+		if a.Role == "" {
+			v.add("vault.auth.role", "must be set for kubernetes auth")
+		}
+		if a.JWTFile == "" {
+			v.add("vault.auth.jwt_file", "must be set for kubernetes auth")
+		}
+	default:
+		v.add("vault.auth.method", "must be one of token, approle, kubernetes, got %q", a.Method)
+	}
+}
+
+func (t TLSConfig) validate(v *validator) {
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		v.add("tls.client_key", "tls.client_cert and tls.client_key must be set together")
+	}
+	switch t.MinVersion {
+	case "", "1.0", "1.1", "1.2", "1.3":
+	default:
+		v.add("tls.min_version", "must be one of 1.0, 1.1, 1.2, 1.3, got %q", t.MinVersion)
+	}
+}
+
+func (c VerifyConfig) validate(v *validator) {
+	for i, path := range c.TrustBundles {
+		if path == "" {
+			v.add(fmt.Sprintf("verify.trust_bundles[%d]", i), "must not be empty")
+		}
+	}
+	if c.ClockSkew < 0 {
+		v.add("verify.clock_skew", "must not be negative, got %s", c.ClockSkew)
+	}
+	switch c.Subject {
+	case "", "strict", "cn", "none":
+	default:
+		v.add("verify.subject", "must be one of strict, cn, none, got %q", c.Subject)
+	}
+}
+
+func (p PendingConfig) validate(v *validator) {
+	if p.PollInterval < 0 {
+		v.add("pending.poll_interval", "must not be negative, got %s", p.PollInterval)
+	}
+	if p.PollTimeout < 0 {
+		v.add("pending.poll_timeout", "must not be negative, got %s", p.PollTimeout)
+	}
+}
+
+func (r RetryConfig) validate(v *validator) {
+	if r.MaxAttempts < 0 {
+		v.add("retry.max_attempts", "must not be negative, got %d", r.MaxAttempts)
+	}
+	for _, d := range []struct {
+		path  string
+		value time.Duration
+	}{
+		{"retry.initial_backoff", r.InitialBackoff},
+		{"retry.max_backoff", r.MaxBackoff},
+		{"retry.request_timeout", r.RequestTimeout},
+		{"retry.timeout", r.Timeout},
+	} {
+		if d.value < 0 {
+			v.add(d.path, "must not be negative, got %s", d.value)
+		}
+	}
+	if r.MaxBackoff > 0 && r.InitialBackoff > r.MaxBackoff {
+		v.add("retry.initial_backoff", "must not exceed retry.max_backoff (%s), got %s", r.MaxBackoff, r.InitialBackoff)
+	}
+}
+
+// validateURL checks that raw is an absolute http or https URL.
+func validateURL(v *validator, path, raw string) {
+	u, err := url.Parse(raw)
+	switch {
+	case err != nil:
+		v.add(path, "invalid URL: %v", err)
+	case u.Scheme != "https" && u.Scheme != "http":
+		v.add(path, "must use the https or http scheme, got %q", raw)
+	case u.Host == "":
+		v.add(path, "must include a host, got %q", raw)
+	}
+}
+
+func (c CertificateConfig) validate(v *validator) {
+	switch c.Format {
+	case "", "pem":
+	case "pkcs12":
+		if !c.Password.IsSet() {
+			v.add("certificate.password", "must name a source for pkcs12 output")
+		}
+		switch c.PKCS12Profile {
+		case "", "modern", "legacy":
+		default:
+			v.add("certificate.pkcs12_profile", "must be one of modern, legacy, got %q", c.PKCS12Profile)
+		}
+	}
+	// Other formats are checked against the registered writers
+}
+
+func (r RenewConfig) validate(v *validator) {
+	if r.Fraction < 0 || r.Fraction >= 1 {
+		v.add("renew.fraction", "must be between 0 and 1, got %v", r.Fraction)
+	}
+	if r.DaysBefore < 0 {
+		v.add("renew.days_before", "must not be negative, got %d", r.DaysBefore)
+	}
+	if r.Jitter < 0 {
+		v.add("renew.jitter", "must not be negative, got %s", r.Jitter)
+	}
+	if r.CheckInterval < 0 {
+		v.add("renew.check_interval", "must not be negative, got %s", r.CheckInterval)
+	}
+}
+
+func (l LogConfig) validate(v *validator) {
+	switch l.Format {
+	case "", "text", "json":
+	default:
+		v.add("log.format", "must be one of text, json, got %q", l.Format)
+	}
+	switch l.Level {
+	case "", "debug", "info", "warn", "error":
+	default:
+		v.add("log.level", "must be one of debug, info, warn, error, got %q", l.Level)
+	}
+	switch l.Output {
+	case "", "stdout", "stderr":
+	case "file":
+		if l.File == "" {
+			v.add("log.file", "must be set when log.output is file")
+		}
+	default:
+		v.add("log.output", "must be one of stdout, stderr, file, got %q", l.Output)
+	}
+}
+
+// isCountryCode reports whether code is an assigned ISO 3166-1 alpha-2 code.
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	return strings.Contains(countryCodes, " "+code+" ")
+}
+
+// countryCodes lists the assigned ISO 3166-1 alpha-2 codes, space separated.
+const countryCodes = " AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ" +
+	" BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ" +
+	" CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ" +
+	" DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR" +
+	" GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY" +
+	" HK HM HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO JP" +
+	" KE KG KH KI KM KN KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY" +
+	" MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ" +
+	" NA NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM PN PR PS PT PW PY" +
+	" QA RE RO RS RU RW SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ" +
+	" TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ UA UG UM US UY UZ" +
+	" VA VC VE VG VI VN VU WF WS YE YT ZA ZM ZW "
@@ -0,0 +1,497 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validConfig returns a configuration that passes validation.
+func validConfig() Config {
+	return Config{
+		Key: KeyConfig{Type: "ecdsa", Curve: "P-384", Output: "private.key"},
+		CSR: CSRConfig{
+			CommonName: "example.com",
+			Country:    "US",
+			DNSNames:   []string{"example.com", "*.example.com"},
+		},
+		Endpoint:    "https://ca.example.com/submit",
+		ESF:         ESFConfig{ProgramID: "1", ServiceID: "2", ApplicationID: "3"},
+		Certificate: CertificateConfig{Output: "certificate.pem"},
+		Renew:       RenewConfig{Fraction: 0.5, CheckInterval: time.Hour},
+	}
+}
+
+// TestValidate_Valid tests that a complete configuration passes.
+func TestValidate_Valid(t *testing.T) {
+	assert.NoError(t, validConfig().Validate())
+
+	// An input key makes the key type irrelevant
+	cfg := validConfig()
+	cfg.Key = KeyConfig{Input: "existing.key"}
+	assert.NoError(t, cfg.Validate())
+}
+
+// TestValidate_AllErrors tests that every problem is reported with its YAML path.
+func TestValidate_AllErrors(t *testing.T) {
+	cfg := Config{
+		Key: KeyConfig{Type: "rsa", Size: 0, Curve: "P-256"},
+		CSR: CSRConfig{
+			Country:     "USA",
+			IPAddresses: []string{"10.0.0.1", "nope"},
+			URIs:        []string{"relative"},
+		},
+		Endpoint:    "ftp://ca.example.com",
+		ESF:         ESFConfig{ProgramID: "1"},
+		Certificate: CertificateConfig{Format: "pkcs12", PKCS12Profile: "rc2"},
+		Renew:       RenewConfig{Fraction: 1.2, DaysBefore: -1},
+	}
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr), "Expected a *ValidationError")
+
+	var paths []string
+	for _, fe := range verr.Errors {
+		paths = append(paths, fe.Path)
+	}
+	assert.Equal(t, []string{
+		"key.bits",
+		"key.curve",
+		"csr.common_name",
+		"csr.country",
+		"csr.ip_addresses[1]",
+		"csr.uris[0]",
+		"endpoint",
+		"esf.service_id",
+		"esf.application_id",
+		"certificate.password",
+		"certificate.pkcs12_profile",
+		"renew.fraction",
+		"renew.days_before",
+	}, paths)
+	assert.Contains(t, err.Error(), "key.bits: must be at least 2048 for rsa keys, got 0")
+	assert.Contains(t, err.Error(), `csr.country: must be a two-letter ISO 3166-1 country code, got "USA"`)
+}
+
+// TestValidate_KeyTypes tests key type and parameter compatibility.
+func TestValidate_KeyTypes(t *testing.T) {
+	tests := map[string]struct {
+		key     KeyConfig
+		wantErr string
+	}{
+		"missing type":      {KeyConfig{}, `key.type: must be set unless key.input is given`},
+		"bits on ed25519":   {KeyConfig{Type: "ed25519", Size: 2048}, `key.bits: only applies to rsa keys`},
+		"unsupported curve": {KeyConfig{Type: "ecdsa", Curve: "P-224"}, `key.curve: must be one of P-256, P-384, P-521, got "P-224"`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Key = tt.key
+			err := cfg.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestValidate_PKCS11 tests the pkcs11 key settings.
+func TestValidate_PKCS11(t *testing.T) {
+	token := PKCS11Config{Module: "/usr/lib/softhsm/libsofthsm2.so", Label: "web", PIN: PassphraseConfig{Env: "HSM_PIN"}}
+	withType := func(keyType string) PKCS11Config {
+		p := token
+		p.KeyType = keyType
+		return p
+	}
+	tests := map[string]struct {
+		key     KeyConfig
+		format  string
+		wantErr string
+	}{
+		"ecdsa":          {KeyConfig{Type: "pkcs11", Curve: "P-384", PKCS11: token}, "", ""},
+		"rsa":            {KeyConfig{Type: "pkcs11", Size: 3072, PKCS11: withType("rsa")}, "", ""},
+		"missing module": {KeyConfig{Type: "pkcs11", PKCS11: PKCS11Config{Label: "web", PIN: token.PIN}}, "", `key.pkcs11.module: must be set for pkcs11 keys`},
+		"missing label":  {KeyConfig{Type: "pkcs11", PKCS11: PKCS11Config{Module: token.Module, PIN: token.PIN}}, "", `key.pkcs11.label: must be set for pkcs11 keys`},
+		"missing pin":    {KeyConfig{Type: "pkcs11", PKCS11: PKCS11Config{Module: token.Module, Label: "web"}}, "", `key.pkcs11.pin: must name a source for pkcs11 keys`},
+		"small rsa":      {KeyConfig{Type: "pkcs11", Size: 1024, PKCS11: withType("rsa")}, "", `key.bits: must be at least 2048 for rsa keys, got 1024`},
+		"bits on ecdsa":  {KeyConfig{Type: "pkcs11", Size: 2048, PKCS11: token}, "", `key.bits: only applies to rsa keys`},
+		"bad key type":   {KeyConfig{Type: "pkcs11", PKCS11: withType("ed25519")}, "", `key.pkcs11.key_type: must be one of rsa, ecdsa, got "ed25519"`},
+		"pkcs12":         {KeyConfig{Type: "pkcs11", PKCS11: token}, "pkcs12", `certificate.format: pkcs12 cannot include a non-exportable pkcs11 key`},
+		"encrypted":      {KeyConfig{Type: "pkcs11", PKCS11: token, Encryption: KeyEncryptionConfig{Passphrase: token.PIN}}, "", `key.encryption.passphrase: does not apply to pkcs11 keys`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Key = tt.key
+			if tt.format != "" {
+				cfg.Certificate.Format = tt.format
+				cfg.Certificate.Password = PassphraseConfig{Env: "P12_PASSWORD"}
+			}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestValidate_KeyEncryption tests the key.encryption settings.
+func TestValidate_KeyEncryption(t *testing.T) {
+	pass := PassphraseConfig{Env: "KEY_PASSPHRASE"}
+	tests := map[string]struct {
+		enc     KeyEncryptionConfig
+		wantErr string
+	}{
+		"unencrypted":       {KeyEncryptionConfig{}, ""},
+		"defaults":          {KeyEncryptionConfig{Passphrase: pass}, ""},
+		"pbkdf2":            {KeyEncryptionConfig{Passphrase: pass, Cipher: "aes-128-gcm", KDF: "pbkdf2", Iterations: 100000}, ""},
+		"scrypt":            {KeyEncryptionConfig{Passphrase: pass, KDF: "scrypt", Scrypt: ScryptConfig{N: 1 << 16, R: 8, P: 1}}, ""},
+		"no passphrase":     {KeyEncryptionConfig{Cipher: "aes-256-cbc"}, `key.encryption.passphrase: must name a source when key.encryption is configured`},
+		"blank command":     {KeyEncryptionConfig{Passphrase: PassphraseConfig{Command: "  "}}, `key.encryption.passphrase.command: must not be empty`},
+		"blank with cipher": {KeyEncryptionConfig{Passphrase: PassphraseConfig{Command: "\t"}, Cipher: "aes-256-gcm"}, `key.encryption.passphrase: must name a source when key.encryption is configured`},
+		"bad cipher":        {KeyEncryptionConfig{Passphrase: pass, Cipher: "des-ede3-cbc"}, `key.encryption.cipher: must be one of aes-128-cbc`},
+		"bad kdf":           {KeyEncryptionConfig{Passphrase: pass, KDF: "argon2"}, `key.encryption.kdf: must be one of pbkdf2, scrypt, got "argon2"`},
+		"few iterations":    {KeyEncryptionConfig{Passphrase: pass, Iterations: 100}, `key.encryption.iterations: must be at least 1000, got 100`},
+		"scrypt on pbkdf2":  {KeyEncryptionConfig{Passphrase: pass, Scrypt: ScryptConfig{N: 1024}}, `key.encryption.scrypt: only applies to the scrypt kdf`},
+		"iterations scrypt": {KeyEncryptionConfig{Passphrase: pass, KDF: "scrypt", Iterations: 10000}, `key.encryption.iterations: only applies to the pbkdf2 kdf`},
+		"scrypt n":          {KeyEncryptionConfig{Passphrase: pass, KDF: "scrypt", Scrypt: ScryptConfig{N: 1000}}, `key.encryption.scrypt.n: must be a power of two greater than 1, got 1000`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Key.Encryption = tt.enc
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestValidate_KeyFormat tests key.format against the key type and encryption.
+func TestValidate_KeyFormat(t *testing.T) {
+	pass := PassphraseConfig{Env: "KEY_PASSPHRASE"}
+	tests := map[string]struct {
+		key     KeyConfig
+		wantErr string
+	}{
+		"pkcs1 rsa":        {KeyConfig{Type: "rsa", Size: 2048, Format: "pkcs1"}, ""},
+		"sec1 ecdsa":       {KeyConfig{Type: "ecdsa", Format: "sec1"}, ""},
+		"openssh ed25519":  {KeyConfig{Type: "ed25519", Format: "openssh", Encryption: KeyEncryptionConfig{Passphrase: pass}}, ""},
+		"input":            {KeyConfig{Input: "existing.key", Format: "sec1"}, ""},
+		"unknown":          {KeyConfig{Type: "rsa", Size: 2048, Format: "jwk"}, `key.format: must be one of pkcs8, pkcs1, sec1, openssh, got "jwk"`},
+		"pkcs1 ecdsa":      {KeyConfig{Type: "ecdsa", Format: "pkcs1"}, `key.format: pkcs1 only applies to rsa keys, got "ecdsa"`},
+		"sec1 ed25519":     {KeyConfig{Type: "ed25519", Format: "sec1"}, `key.format: sec1 only applies to ecdsa keys, got "ed25519"`},
+		"sec1 encrypted":   {KeyConfig{Type: "ecdsa", Format: "sec1", Encryption: KeyEncryptionConfig{Passphrase: pass}}, `key.encryption: sec1 keys cannot be encrypted, use pkcs8 or openssh`},
+		"openssh scrypt":   {KeyConfig{Type: "ecdsa", Format: "openssh", Encryption: KeyEncryptionConfig{Passphrase: pass, KDF: "scrypt"}}, `key.encryption: cipher and kdf only apply to pkcs8 keys`},
+		"pkcs11 reference": {KeyConfig{Type: "pkcs11", Format: "openssh", PKCS11: PKCS11Config{Module: "/lib/p11.so", Label: "web", PIN: pass}}, `key.format: does not apply to pkcs11 keys`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Key = tt.key
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestValidate_KeyUsage tests csr.key_usage and csr.extended_key_usage.
+func TestValidate_KeyUsage(t *testing.T) {
+	tests := map[string]struct {
+		key     KeyConfig
+		ku, eku []string
+		wantErr string
+	}{
+		"server rsa":     {KeyConfig{Type: "rsa", Size: 2048}, []string{"digital_signature", "key_encipherment"}, []string{"server_auth"}, ""},
+		"client ecdsa":   {KeyConfig{Type: "ecdsa"}, []string{"digital_signature", "key_agreement"}, []string{"client_auth"}, ""},
+		"dual ed25519":   {KeyConfig{Type: "ed25519"}, []string{"digital_signature"}, []string{"server_auth", "client_auth"}, ""},
+		"custom oid":     {KeyConfig{Type: "ecdsa"}, nil, []string{"1.3.6.1.4.1.311.20.2.2"}, ""},
+		"input key":      {KeyConfig{Input: "existing.key"}, []string{"key_encipherment"}, nil, ""},
+		"unknown ku":     {KeyConfig{Type: "ecdsa"}, []string{"signing"}, nil, `csr.key_usage[0]: unknown usage "signing"`},
+		"unknown eku":    {KeyConfig{Type: "ecdsa"}, nil, []string{"server_auth", "web"}, `csr.extended_key_usage[1]: unknown usage "web"`},
+		"duplicate eku":  {KeyConfig{Type: "ecdsa"}, nil, []string{"server_auth", "server_auth"}, `csr.extended_key_usage[1]: duplicate usage "server_auth"`},
+		"ecdsa encipher": {KeyConfig{Type: "ecdsa"}, []string{"digital_signature", "key_encipherment"}, nil, `csr.key_usage: key_encipherment does not apply to ecdsa keys`},
+		"ed25519 agree":  {KeyConfig{Type: "ed25519"}, []string{"digital_signature", "key_agreement"}, nil, `csr.key_usage: key_agreement does not apply to ed25519 keys`},
+		"ca bits":        {KeyConfig{Type: "rsa", Size: 2048}, []string{"digital_signature", "cert_sign"}, nil, `csr.key_usage: cert_sign is only for CA certificates`},
+		"no signature":   {KeyConfig{Type: "ecdsa"}, []string{"key_agreement"}, nil, `csr.key_usage: must include digital_signature`},
+		"pkcs11 default": {KeyConfig{Type: "pkcs11", PKCS11: PKCS11Config{Module: "/lib/p11.so", Label: "web", PIN: PassphraseConfig{Env: "PIN"}}}, []string{"key_encipherment"}, nil, `csr.key_usage: key_encipherment does not apply to ecdsa keys`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Key = tt.key
+			cfg.CSR.KeyUsage, cfg.CSR.ExtendedKeyUsage = tt.ku, tt.eku
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestValidate_CustomValues tests csr.extensions and csr.attributes.
+func TestValidate_CustomValues(t *testing.T) {
+	tests := map[string]struct {
+		csr     CSRConfig
+		wantErr string
+	}{
+		"utf8 extension":  {CSRConfig{Extensions: []ValueConfig{{OID: "1.3.6.1.4.1.99999.1", Value: "app-42"}}}, ""},
+		"der extension":   {CSRConfig{Extensions: []ValueConfig{{OID: "1.3.6.1.4.1.99999.2", Critical: true, Type: "der", Value: "0c:03:61:62:63"}}}, ""},
+		"named attribute": {CSRConfig{Attributes: []ValueConfig{{OID: "unstructured_name", Type: "ia5", Value: "host"}}}, ""},
+		"password attr":   {CSRConfig{Attributes: []ValueConfig{{OID: "challenge_password", Type: "printable", Value: "secret"}}}, ""},
+		"bad oid":         {CSRConfig{Extensions: []ValueConfig{{OID: "esf", Value: "x"}}}, `csr.extensions[0].oid: must be a dotted OID, got "esf"`},
+		"san extension":   {CSRConfig{Extensions: []ValueConfig{{OID: "2.5.29.17", Type: "der", Value: "3000"}}}, `csr.extensions[0].oid: extension 2.5.29.17 is set by csr.dns_names`},
+		"key usage twice": {CSRConfig{KeyUsage: []string{"digital_signature"}, Extensions: []ValueConfig{{OID: "2.5.29.15", Type: "der", Value: "03020780"}}}, `csr.extensions[0].oid: extension 2.5.29.15 is set by csr.key_usage`},
+		"duplicate ext":   {CSRConfig{Extensions: []ValueConfig{{OID: "1.2.3.4", Value: "a"}, {OID: "1.2.3.4", Value: "b"}}}, `csr.extensions[1].oid: duplicate extension 1.2.3.4`},
+		"bad type":        {CSRConfig{Extensions: []ValueConfig{{OID: "1.2.3.4", Type: "bmp", Value: "a"}}}, `csr.extensions[0].type: must be one of utf8, ia5, printable, der, got "bmp"`},
+		"empty value":     {CSRConfig{Extensions: []ValueConfig{{OID: "1.2.3.4"}}}, `csr.extensions[0].value: value must not be empty`},
+		"bad hex":         {CSRConfig{Extensions: []ValueConfig{{OID: "1.2.3.4", Type: "der", Value: "zz"}}}, `csr.extensions[0].value: invalid hex`},
+		"trailing der":    {CSRConfig{Extensions: []ValueConfig{{OID: "1.2.3.4", Type: "der", Value: "05000500"}}}, `csr.extensions[0].value: value is not a single DER element`},
+		"non-ascii ia5":   {CSRConfig{Attributes: []ValueConfig{{OID: "1.2.3.4", Type: "ia5", Value: "héllo"}}}, `csr.attributes[0].value: value is not a valid ia5 string`},
+		"unknown name":    {CSRConfig{Attributes: []ValueConfig{{OID: "serial", Value: "1"}}}, `csr.attributes[0].oid: must be a dotted OID or PKCS#9 attribute name, got "serial"`},
+		"extension req":   {CSRConfig{Attributes: []ValueConfig{{OID: "1.2.840.113549.1.9.14", Type: "der", Value: "3000"}}}, `csr.attributes[0].oid: attribute 1.2.840.113549.1.9.14 is set by csr.extensions`},
+		"password twice":  {CSRConfig{ChallengePassword: PassphraseConfig{Env: "CHALLENGE"}, Attributes: []ValueConfig{{OID: "challenge_password", Value: "x"}}}, `csr.attributes[0].oid: attribute 1.2.840.113549.1.9.7 is set by csr.challenge_password`},
+		"critical attr":   {CSRConfig{Attributes: []ValueConfig{{OID: "unstructured_name", Critical: true, Value: "host"}}}, `csr.attributes[0].critical: only applies to extensions`},
+		"duplicate attr":  {CSRConfig{Attributes: []ValueConfig{{OID: "unstructured_name", Value: "a"}, {OID: "1.2.840.113549.1.9.2", Value: "b"}}}, `csr.attributes[1].oid: duplicate attribute 1.2.840.113549.1.9.2`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.CSR.Extensions, cfg.CSR.Attributes = tt.csr.Extensions, tt.csr.Attributes
+			cfg.CSR.KeyUsage, cfg.CSR.ChallengePassword = tt.csr.KeyUsage, tt.csr.ChallengePassword
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestValidate_EST tests the est backend settings.
+func TestValidate_EST(t *testing.T) {
+	tests := map[string]struct {
+		est     ESTConfig
+		wantErr string
+	}{
+		"valid":              {ESTConfig{URL: "https://est.example.com"}, ""},
+		"missing url":        {ESTConfig{}, `est.url: must be set for the est backend`},
+		"plain http":         {ESTConfig{URL: "http://est.example.com"}, `est.url: must use the https scheme`},
+		"password only":      {ESTConfig{URL: "https://est.example.com", Password: PassphraseConfig{Env: "EST_PASSWORD"}}, `est.username: must be set when est.password is set`},
+		"client cert only":   {ESTConfig{URL: "https://est.example.com", ClientCert: "certificate.pem"}, `est.client_cert and est.client_key must be set together`},
+		"client key output":  {ESTConfig{URL: "https://est.example.com", ClientCert: "certificate.pem", ClientKey: "private.key"}, ""},
+		"client key current": {ESTConfig{URL: "https://est.example.com", ClientCert: "certificate.pem", ClientKey: "current.key"}, ""},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Backend = "est"
+			cfg.EST = tt.est
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestValidate_SCEP tests the scep backend settings.
+func TestValidate_SCEP(t *testing.T) {
+	tests := map[string]struct {
+		scep    SCEPConfig
+		timeout time.Duration // retry.timeout
+		wantErr string
+	}{
+		"valid":            {SCEPConfig{URL: "http://scep.example.com/scep", PollInterval: time.Minute}, 0, ""},
+		"missing url":      {SCEPConfig{}, 0, `scep.url: must be set for the scep backend`},
+		"bad scheme":       {SCEPConfig{URL: "ldap://scep.example.com"}, 0, `scep.url: must use the https or http scheme`},
+		"negative timeout": {SCEPConfig{URL: "http://scep.example.com/scep", PollTimeout: -time.Second}, 0, `scep.poll_timeout: must not be negative, got -1s`},
+		"within retry":     {SCEPConfig{URL: "http://scep.example.com/scep", PollTimeout: 10 * time.Minute}, 10 * time.Minute, ""},
+		"no retry timeout": {SCEPConfig{URL: "http://scep.example.com/scep", PollTimeout: time.Hour}, 0, ""},
+		"beyond retry":     {SCEPConfig{URL: "http://scep.example.com/scep", PollTimeout: time.Hour}, 10 * time.Minute, `scep.poll_timeout: must not exceed retry.timeout (10m0s), which bounds polling, got 1h0m0s`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Backend = "scep"
+			cfg.SCEP = tt.scep
+			cfg.Retry.Timeout = tt.timeout
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestValidate_Vault tests the vault backend settings and auth methods.
+func TestValidate_Vault(t *testing.T) {
+	base := VaultConfig{
+		Address: "https://vault.example.com:8200",
+		Mount:   "pki",
+		Role:    "web",
+		Auth:    VaultAuthConfig{Token: PassphraseConfig{Env: "VAULT_TOKEN"}},
+	}
+	tests := map[string]struct {
+		modify  func(*VaultConfig)
+		wantErr string
+	}{
+		"valid token":       {func(c *VaultConfig) {}, ""},
+		"missing address":   {func(c *VaultConfig) { c.Address = "" }, `vault.address: must be set for the vault backend`},
+		"missing role":      {func(c *VaultConfig) { c.Role = "" }, `vault.role: must be set for the vault backend`},
+		"no token source":   {func(c *VaultConfig) { c.Auth.Token = PassphraseConfig{} }, `vault.auth.token: must name a source`},
+		"approle no id":     {func(c *VaultConfig) { c.Auth.Method = "approle" }, `vault.auth.role_id: must be set for approle auth`},
+		"kubernetes no jwt": {func(c *VaultConfig) { c.Auth = VaultAuthConfig{Method: "kubernetes", Role: "app"} }, `vault.auth.jwt_file: must be set for kubernetes auth`},
+		"unknown method":    {func(c *VaultConfig) { c.Auth.Method = "ldap" }, `vault.auth.method: must be one of token, approle, kubernetes, got "ldap"`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Backend = "vault"
+			cfg.Vault = base
+			tt.modify(&cfg.Vault)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestValidate_TLS tests validation of the tls section.
+func TestValidate_TLS(t *testing.T) {
+	tests := map[string]struct {
+		tls     TLSConfig
+		wantErr string
+	}{
+		"empty":           {TLSConfig{}, ""},
+		"full":            {TLSConfig{CABundles: []string{"root.crt"}, ClientCert: "c.crt", ClientKey: "c.key", MinVersion: "1.3", ServerName: "ca.internal"}, ""},
+		"cert only":       {TLSConfig{ClientCert: "c.crt"}, "tls.client_key: tls.client_cert and tls.client_key must be set together"},
+		"key only":        {TLSConfig{ClientKey: "c.key"}, "tls.client_key: tls.client_cert and tls.client_key must be set together"},
+		"unknown version": {TLSConfig{MinVersion: "1.4"}, `tls.min_version: must be one of 1.0, 1.1, 1.2, 1.3, got "1.4"`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.TLS = tt.tls
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestValidate_Retry tests validation of the retry section.
+func TestValidate_Retry(t *testing.T) {
+	tests := map[string]struct {
+		retry   RetryConfig
+		wantErr string
+	}{
+		"empty":             {RetryConfig{}, ""},
+		"defaults":          {RetryConfig{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Minute, RequestTimeout: 30 * time.Second, Timeout: 10 * time.Minute}, ""},
+		"negative attempts": {RetryConfig{MaxAttempts: -1}, `retry.max_attempts: must not be negative, got -1`},
+		"negative timeout":  {RetryConfig{Timeout: -time.Second}, `retry.timeout: must not be negative, got -1s`},
+		"backoff order":     {RetryConfig{InitialBackoff: time.Minute, MaxBackoff: time.Second}, `retry.initial_backoff: must not exceed retry.max_backoff (1s), got 1m0s`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Retry = tt.retry
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestValidate_Verify tests validation of the verify section.
+func TestValidate_Verify(t *testing.T) {
+	tests := map[string]struct {
+		verify  VerifyConfig
+		wantErr string
+	}{
+		"empty":         {VerifyConfig{}, ""},
+		"bundles":       {VerifyConfig{TrustBundles: []string{"root.pem"}, ClockSkew: 5 * time.Minute}, ""},
+		"empty bundle":  {VerifyConfig{TrustBundles: []string{"root.pem", ""}}, `verify.trust_bundles[1]: must not be empty`},
+		"negative skew": {VerifyConfig{ClockSkew: -time.Second}, `verify.clock_skew: must not be negative, got -1s`},
+		"subject cn":    {VerifyConfig{Subject: "cn"}, ""},
+		"bad subject":   {VerifyConfig{Subject: "loose"}, `verify.subject: must be one of strict, cn, none, got "loose"`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Verify = tt.verify
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestSection_Covers tests which section each field path belongs to.
+func TestSection_Covers(t *testing.T) {
+	tests := map[string]struct {
+		sections Section
+		path     string
+		want     bool
+	}{
+		"key":              {SectionKey, "key.encryption.passphrase.env", true},
+		"csr outside key":  {SectionKey, "csr.common_name", false},
+		"csr list":         {SectionCSR, "csr.dns_names[1]", true},
+		"backend":          {SectionCA, "backend", true},
+		"backend section":  {SectionCA, "vault.auth.role_id", true},
+		"certificate":      {SectionCA, "certificate.format", true},
+		"ca outside key":   {SectionKey | SectionCSR, "endpoint", false},
+		"renew":            {SectionRenew, "renew.fraction", true},
+		"renew outside ca": {SectionCA, "renew.fraction", false},
+		"log always":       {SectionKey, "log.level", true},
+		"all":              {AllSections, "scep.poll_timeout", true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.sections.Covers(tt.path))
+		})
+	}
+}
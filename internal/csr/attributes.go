@@ -0,0 +1,130 @@
+package csr
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+)
+
+// oidChallengePassword identifies the PKCS#9 challengePassword attribute.
+var oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+
+// attribute is a PKCS#10 attribute with its SET OF values.
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// certificationRequestInfo mirrors the signed part of a PKCS#10 request.
+type certificationRequestInfo struct {
+	Version    int
+	Subject    asn1.RawValue
+	PublicKey  asn1.RawValue
+	Attributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+// certificationRequest mirrors a complete PKCS#10 request.
+type certificationRequest struct {
+	Info      asn1.RawValue
+	Algorithm pkix.AlgorithmIdentifier
+	Signature asn1.BitString
+}
+
+// challengePassword returns the challengePassword attribute for password.
+func challengePassword(password string) (attribute, error) {
+	value, err := asn1.Marshal(password) // PrintableString, or UTF8String when needed
+	if err != nil {
+		return attribute{}, err
+	}
+	return attribute{Type: oidChallengePassword, Values: []asn1.RawValue{{FullBytes: value}}}, nil
+}
+
+// addAttributes appends attrs to the DER-encoded CSR and signs it again with key.
+// The x509 package only encodes attributes shaped like extension requests.
+func addAttributes(der []byte, key crypto.Signer, attrs []attribute) ([]byte, error) {
+	parsed, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+	var req certificationRequest
+	if _, err := asn1.Unmarshal(der, &req); err != nil {
+		return nil, err
+	}
+	var info certificationRequestInfo
+	if _, err := asn1.Unmarshal(req.Info.FullBytes, &info); err != nil {
+		return nil, err
+	}
+
+	for _, attr := range attrs {
+		raw, err := asn1.Marshal(attr)
+		if err != nil {
+			return nil, err
+		}
+		info.Attributes = append(info.Attributes, asn1.RawValue{FullBytes: raw})
+	}
+	tbs, err := asn1.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := signatureHash(parsed.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	signed := tbs
+	if hash != 0 {
+		h := hash.New()
+		h.Write(tbs)
+		signed = h.Sum(nil)
+	}
+	signature, err := key.Sign(rand.Reader, signed, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(certificationRequest{
+		Info:      asn1.RawValue{FullBytes: tbs},
+		Algorithm: req.Algorithm,
+		Signature: asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+}
+
+// signatureHash returns the digest used by a signature algorithm chosen by
+// x509.CreateCertificateRequest. Ed25519 signs the message itself.
+func signatureHash(alg x509.SignatureAlgorithm) (crypto.Hash, error) {
+	switch alg {
+	case x509.SHA256WithRSA, x509.ECDSAWithSHA256:
+		return crypto.SHA256, nil
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384:
+		return crypto.SHA384, nil
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512:
+		return crypto.SHA512, nil
+	case x509.PureEd25519:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unsupported CSR signature algorithm: %s", alg)
+	}
+}
+
+// customAttributes returns the attributes listed in cfg.Attributes.
+func customAttributes(cfg config.CSRConfig) ([]attribute, error) {
+	attrs := make([]attribute, 0, len(cfg.Attributes))
+	for _, a := range cfg.Attributes {
+		oid, err := certs.ParseAttributeOID(a.OID)
+		if err != nil {
+			return nil, err
+		}
+		value, err := certs.MarshalValue(a.Type, a.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for attribute %s: %w", oid, err)
+		}
+		attrs = append(attrs, attribute{Type: oid, Values: []asn1.RawValue{{FullBytes: value}}})
+	}
+	return attrs, nil
+}
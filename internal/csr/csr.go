@@ -7,9 +7,11 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"net"
 
 	"github.com/dstout-devops/hephaestus/internal/config" // Replace with your actual module path
+	"github.com/dstout-devops/hephaestus/internal/secret"
 )
 
 // GenerateCSR creates a Certificate Signing Request (CSR) using the provided private key and CSR configuration.
@@ -59,11 +61,48 @@ func GenerateCSR(privKey interface{}, cfg config.CSRConfig) ([]byte, error) {
 		ipAddresses = append(ipAddresses, ip)
 	}
 
+	// Validate Subject Alternative Names
+	ips, err := parseIPAddresses(cfg.IPAddresses)
+	if err != nil {
+		return nil, err
+	}
+	ipAddresses = append(ipAddresses, ips...)
+
+	dnsNames, err := parseDNSNames(cfg.DNSNames)
+	if err != nil {
+		return nil, err
+	}
+
+	emailAddresses, err := parseEmailAddresses(cfg.EmailAddresses)
+	if err != nil {
+		return nil, err
+	}
+
+	uris, err := parseURIs(cfg.URIs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Requested key usages and custom extensions go into the extension
+	// request next to the SANs
+	extensions, err := usageExtensions(cfg, privKey.(crypto.Signer).Public())
+	if err != nil {
+		return nil, err
+	}
+	custom, err := customExtensions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	extensions = append(extensions, custom...)
+
 	// Create the CSR template
 	csrTemplate := &x509.CertificateRequest{
-		Subject:     subject,
-		IPAddresses: ipAddresses,
-		// Add DNSNames or EmailAddresses here if your config supports them
+		Subject:         subject,
+		DNSNames:        dnsNames,
+		IPAddresses:     ipAddresses,
+		EmailAddresses:  emailAddresses,
+		URIs:            uris,
+		ExtraExtensions: extensions,
 	}
 
 	// Generate the CSR
@@ -72,6 +111,29 @@ func GenerateCSR(privKey interface{}, cfg config.CSRConfig) ([]byte, error) {
 		return nil, err
 	}
 
+	// Add the challenge password and custom attributes, which x509 cannot
+	// encode itself
+	attrs, err := customAttributes(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ChallengePassword.IsSet() {
+		password, err := secret.Resolve(cfg.ChallengePassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read challenge password: %w", err)
+		}
+		attr, err := challengePassword(password)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append([]attribute{attr}, attrs...)
+	}
+	if len(attrs) > 0 {
+		if csrDER, err = addAttributes(csrDER, privKey.(crypto.Signer), attrs); err != nil {
+			return nil, err
+		}
+	}
+
 	// PEM-encode the CSR
 	csrPemBlock := &pem.Block{
 		Type:  "CERTIFICATE REQUEST",
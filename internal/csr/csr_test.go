@@ -1,10 +1,16 @@
 package csr
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
+	"math/big"
 	"net"
 	"testing"
 
@@ -112,3 +118,254 @@ func TestGenerateCSR_MinimalConfig(t *testing.T) {
 	// Verify no IP addresses are set
 	assert.Empty(t, csr.IPAddresses, "IPAddresses should be empty")
 }
+
+// TestGenerateCSR_ECDSA tests the GenerateCSR function with an ECDSA private key.
+func TestGenerateCSR_ECDSA(t *testing.T) {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate ECDSA private key")
+
+	csrPem, err := GenerateCSR(privKey, config.CSRConfig{CommonName: "test.com"})
+	require.NoError(t, err, "GenerateCSR should not return an error")
+
+	block, _ := pem.Decode(csrPem)
+	require.NotNil(t, block, "PEM decoding should return a non-nil block")
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err, "failed to parse CSR")
+
+	assert.Equal(t, x509.ECDSA, csr.PublicKeyAlgorithm, "Public key algorithm should be ECDSA")
+	assert.Equal(t, x509.ECDSAWithSHA256, csr.SignatureAlgorithm, "Signature algorithm should be ECDSA with SHA-256")
+	assert.NoError(t, csr.CheckSignature(), "CSR signature should verify")
+}
+
+// TestGenerateCSR_SubjectAltNames tests that every SAN type is encoded in the CSR.
+func TestGenerateCSR_SubjectAltNames(t *testing.T) {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate ECDSA private key")
+
+	cfg := config.CSRConfig{
+		CommonName:     "test.com",
+		IPAddress:      "192.168.1.1",
+		DNSNames:       []string{"test.com", "*.test.com", "bücher.example"},
+		IPAddresses:    []string{"10.0.0.1", "2001:db8::1"},
+		EmailAddresses: []string{"admin@test.com"},
+		URIs:           []string{"spiffe://test.com/service"},
+	}
+
+	csrPem, err := GenerateCSR(privKey, cfg)
+	require.NoError(t, err, "GenerateCSR should not return an error")
+
+	block, _ := pem.Decode(csrPem)
+	require.NotNil(t, block, "PEM decoding should return a non-nil block")
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err, "failed to parse CSR")
+
+	assert.Equal(t, []string{"test.com", "*.test.com", "xn--bcher-kva.example"}, csr.DNSNames, "DNS names should be converted to ASCII")
+	require.Len(t, csr.IPAddresses, 3, "CSR should include the legacy and list IP addresses")
+	assert.True(t, net.ParseIP("192.168.1.1").Equal(csr.IPAddresses[0]), "Legacy IP address should come first")
+	assert.True(t, net.ParseIP("2001:db8::1").Equal(csr.IPAddresses[2]), "IPv6 address should match")
+	assert.Equal(t, []string{"admin@test.com"}, csr.EmailAddresses, "Email addresses should match")
+	require.Len(t, csr.URIs, 1, "CSR should have exactly one URI")
+	assert.Equal(t, "spiffe://test.com/service", csr.URIs[0].String(), "URI should match")
+}
+
+// TestGenerateCSR_InvalidSubjectAltNames tests that invalid SAN entries are rejected.
+func TestGenerateCSR_InvalidSubjectAltNames(t *testing.T) {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate ECDSA private key")
+
+	tests := map[string]struct {
+		cfg     config.CSRConfig
+		wantErr string
+	}{
+		"dns": {
+			cfg:     config.CSRConfig{DNSNames: []string{"bad_name.com"}},
+			wantErr: `invalid DNS name in configuration: "bad_name.com"`,
+		},
+		"ip": {
+			cfg:     config.CSRConfig{IPAddresses: []string{"10.0.0.256"}},
+			wantErr: `invalid IP address in configuration: "10.0.0.256"`,
+		},
+		"email": {
+			cfg:     config.CSRConfig{EmailAddresses: []string{"Admin <admin@test.com>"}},
+			wantErr: `invalid email address in configuration: "Admin <admin@test.com>"`,
+		},
+		"uri": {
+			cfg:     config.CSRConfig{URIs: []string{"/relative/path"}},
+			wantErr: `invalid URI in configuration: "/relative/path"`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := GenerateCSR(privKey, tt.cfg)
+			assert.EqualError(t, err, tt.wantErr, "error message should match expected")
+		})
+	}
+}
+
+// TestGenerateCSR_ChallengePassword tests that the challenge password attribute
+// is added and the CSR is re-signed with every key type.
+func TestGenerateCSR_ChallengePassword(t *testing.T) {
+	t.Setenv("SCEP_CHALLENGE", "s3cret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "failed to generate RSA private key")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err, "failed to generate ECDSA private key")
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err, "failed to generate Ed25519 private key")
+
+	for name, key := range map[string]interface{}{"rsa": rsaKey, "ecdsa": ecKey, "ed25519": edKey} {
+		t.Run(name, func(t *testing.T) {
+			csrPem, err := GenerateCSR(key, config.CSRConfig{
+				CommonName:        "test.com",
+				DNSNames:          []string{"test.com"},
+				ChallengePassword: config.PassphraseConfig{Env: "SCEP_CHALLENGE"},
+			})
+			require.NoError(t, err, "GenerateCSR should not return an error")
+
+			block, _ := pem.Decode(csrPem)
+			require.NotNil(t, block, "PEM decoding should return a non-nil block")
+			csr, err := x509.ParseCertificateRequest(block.Bytes)
+			require.NoError(t, err, "failed to parse CSR")
+			assert.NoError(t, csr.CheckSignature(), "Re-signed CSR signature should verify")
+			assert.Equal(t, []string{"test.com"}, csr.DNSNames, "Extensions should be preserved")
+
+			var req certificationRequest
+			_, err = asn1.Unmarshal(block.Bytes, &req)
+			require.NoError(t, err)
+			var info certificationRequestInfo
+			_, err = asn1.Unmarshal(req.Info.FullBytes, &info)
+			require.NoError(t, err)
+
+			var password string
+			for _, raw := range info.Attributes {
+				var attr attribute
+				_, err := asn1.Unmarshal(raw.FullBytes, &attr)
+				require.NoError(t, err)
+				if attr.Type.Equal(oidChallengePassword) {
+					_, err := asn1.Unmarshal(attr.Values[0].FullBytes, &password)
+					require.NoError(t, err)
+				}
+			}
+			assert.Equal(t, "s3cret", password, "Expected the challenge password attribute")
+		})
+	}
+}
+
+// TestGenerateCSR_ChallengePasswordMissing tests that an unreadable password source fails.
+func TestGenerateCSR_ChallengePasswordMissing(t *testing.T) {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate ECDSA private key")
+
+	_, err = GenerateCSR(privKey, config.CSRConfig{
+		CommonName:        "test.com",
+		ChallengePassword: config.PassphraseConfig{Env: "HEPHAESTUS_TEST_UNSET"},
+	})
+	assert.ErrorContains(t, err, "failed to read challenge password")
+}
+
+// TestGenerateCSR_KeyUsage tests that requested key usages are encoded in the
+// extension request, as a CA copying them into the certificate would see them.
+func TestGenerateCSR_KeyUsage(t *testing.T) {
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "failed to generate RSA private key")
+
+	cfg := config.CSRConfig{
+		CommonName:       "test.com",
+		KeyUsage:         []string{"digital_signature", "key_encipherment"},
+		ExtendedKeyUsage: []string{"server_auth", "client_auth", "1.3.6.1.4.1.311.20.2.2"},
+	}
+	csrPem, err := GenerateCSR(privKey, cfg)
+	require.NoError(t, err, "GenerateCSR should not return an error")
+
+	block, _ := pem.Decode(csrPem)
+	require.NotNil(t, block, "PEM decoding should return a non-nil block")
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err, "failed to parse CSR")
+	require.Len(t, csr.Extensions, 2, "Expected keyUsage and extKeyUsage extensions")
+	assert.True(t, csr.Extensions[0].Critical, "keyUsage should be critical")
+
+	// Issue a certificate carrying the requested extensions and let x509 decode them
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), ExtraExtensions: csr.Extensions}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, csr.PublicKey, privKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	assert.Equal(t, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment, cert.KeyUsage)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, cert.ExtKeyUsage)
+	require.Len(t, cert.UnknownExtKeyUsage, 1)
+	assert.Equal(t, "1.3.6.1.4.1.311.20.2.2", cert.UnknownExtKeyUsage[0].String())
+}
+
+// TestGenerateCSR_KeyUsageIncompatible tests that key usages the key cannot
+// serve are rejected.
+func TestGenerateCSR_KeyUsageIncompatible(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err, "failed to generate ed25519 private key")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate ECDSA private key")
+
+	_, err = GenerateCSR(edKey, config.CSRConfig{CommonName: "test.com", KeyUsage: []string{"digital_signature", "key_agreement"}})
+	assert.EqualError(t, err, "invalid key usage: key_agreement does not apply to ed25519 keys")
+	_, err = GenerateCSR(ecKey, config.CSRConfig{CommonName: "test.com", KeyUsage: []string{"key_encipherment"}})
+	assert.EqualError(t, err, "invalid key usage: key_encipherment does not apply to ecdsa keys")
+	_, err = GenerateCSR(ecKey, config.CSRConfig{CommonName: "test.com", ExtendedKeyUsage: []string{"web_auth"}})
+	assert.EqualError(t, err, "unknown extended key usage: web_auth")
+}
+
+// TestGenerateCSR_CustomValues tests that custom extensions join the
+// extension request and custom attributes are added next to the challenge
+// password.
+func TestGenerateCSR_CustomValues(t *testing.T) {
+	t.Setenv("SCEP_CHALLENGE", "s3cret")
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate ECDSA private key")
+
+	csrPem, err := GenerateCSR(privKey, config.CSRConfig{
+		CommonName:        "test.com",
+		DNSNames:          []string{"test.com"},
+		ChallengePassword: config.PassphraseConfig{Env: "SCEP_CHALLENGE"},
+		Extensions: []config.ValueConfig{
+			{OID: "1.3.6.1.4.1.99999.1", Value: "app-42"},
+			{OID: "1.3.6.1.4.1.99999.2", Critical: true, Type: "der", Value: "01:01:ff"},
+		},
+		Attributes: []config.ValueConfig{{OID: "unstructured_name", Type: "ia5", Value: "host.test.com"}},
+	})
+	require.NoError(t, err, "GenerateCSR should not return an error")
+
+	block, _ := pem.Decode(csrPem)
+	require.NotNil(t, block, "PEM decoding should return a non-nil block")
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err, "failed to parse CSR")
+	assert.NoError(t, csr.CheckSignature(), "Re-signed CSR signature should verify")
+	assert.Equal(t, []string{"test.com"}, csr.DNSNames, "SANs should be preserved")
+
+	exts := make(map[string]pkix.Extension)
+	for _, ext := range csr.Extensions {
+		exts[ext.Id.String()] = ext
+	}
+	var appID string
+	_, err = asn1.UnmarshalWithParams(exts["1.3.6.1.4.1.99999.1"].Value, &appID, "utf8")
+	require.NoError(t, err)
+	assert.Equal(t, "app-42", appID)
+	assert.False(t, exts["1.3.6.1.4.1.99999.1"].Critical)
+	assert.Equal(t, []byte{0x01, 0x01, 0xff}, exts["1.3.6.1.4.1.99999.2"].Value, "DER values should be used as is")
+	assert.True(t, exts["1.3.6.1.4.1.99999.2"].Critical)
+
+	var req certificationRequest
+	_, err = asn1.Unmarshal(block.Bytes, &req)
+	require.NoError(t, err)
+	var info certificationRequestInfo
+	_, err = asn1.Unmarshal(req.Info.FullBytes, &info)
+	require.NoError(t, err)
+	attrs := make(map[string]asn1.RawValue)
+	for _, raw := range info.Attributes {
+		var attr attribute
+		_, err := asn1.Unmarshal(raw.FullBytes, &attr)
+		require.NoError(t, err)
+		attrs[attr.Type.String()] = attr.Values[0]
+	}
+	assert.Contains(t, attrs, oidChallengePassword.String())
+	name := attrs["1.2.840.113549.1.9.2"]
+	assert.Equal(t, asn1.TagIA5String, name.Tag)
+	assert.Equal(t, "host.test.com", string(name.Bytes))
+}
@@ -0,0 +1,85 @@
+package csr
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+)
+
+var (
+	oidKeyUsage    = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// usageExtensions returns the keyUsage and extKeyUsage extensions requested
+// in cfg. The key usages are checked against the algorithm of pub.
+func usageExtensions(cfg config.CSRConfig, pub crypto.PublicKey) ([]pkix.Extension, error) {
+	var exts []pkix.Extension
+	if len(cfg.KeyUsage) > 0 {
+		ku, err := certs.ParseKeyUsage(cfg.KeyUsage)
+		if err != nil {
+			return nil, err
+		}
+		if err := certs.CheckKeyUsage(ku, certs.KeyAlgorithm(pub)); err != nil {
+			return nil, fmt.Errorf("invalid key usage: %w", err)
+		}
+		ext, err := keyUsageExtension(ku)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, ext)
+	}
+	if len(cfg.ExtendedKeyUsage) > 0 {
+		oids, err := certs.ParseExtKeyUsage(cfg.ExtendedKeyUsage)
+		if err != nil {
+			return nil, err
+		}
+		value, err := asn1.Marshal(oids)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, pkix.Extension{Id: oidExtKeyUsage, Value: value})
+	}
+	return exts, nil
+}
+
+// keyUsageExtension encodes ku as a critical keyUsage extension, a BIT
+// STRING with bit 0 for digitalSignature and trailing zero bits dropped.
+func keyUsageExtension(ku x509.KeyUsage) (pkix.Extension, error) {
+	var bits [2]byte
+	n := 0
+	for i := 0; i < 9; i++ {
+		if ku&(1<<uint(i)) != 0 {
+			bits[i/8] |= 0x80 >> uint(i%8)
+			n = i + 1
+		}
+	}
+	length := (n + 7) / 8
+	value, err := asn1.Marshal(asn1.BitString{Bytes: bits[:length], BitLength: n})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: oidKeyUsage, Critical: true, Value: value}, nil
+}
+
+// customExtensions returns the extensions listed in cfg.Extensions.
+func customExtensions(cfg config.CSRConfig) ([]pkix.Extension, error) {
+	exts := make([]pkix.Extension, 0, len(cfg.Extensions))
+	for _, ext := range cfg.Extensions {
+		oid, err := certs.ParseOID(ext.OID)
+		if err != nil {
+			return nil, err
+		}
+		value, err := certs.MarshalValue(ext.Type, ext.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for extension %s: %w", oid, err)
+		}
+		exts = append(exts, pkix.Extension{Id: oid, Critical: ext.Critical, Value: value})
+	}
+	return exts, nil
+}
@@ -0,0 +1,68 @@
+package csr
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// parseDNSNames validates DNS names and converts internationalized names to their ASCII form.
+// A single leading wildcard label is permitted.
+func parseDNSNames(names []string) ([]string, error) {
+	var out []string
+	for _, name := range names {
+		host, wildcard := strings.CutPrefix(name, "*.")
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil || ascii == "" {
+			return nil, fmt.Errorf("invalid DNS name in configuration: %q", name)
+		}
+		if wildcard {
+			ascii = "*." + ascii
+		}
+		out = append(out, ascii)
+	}
+	return out, nil
+}
+
+// parseIPAddresses parses IPv4 and IPv6 addresses.
+func parseIPAddresses(addrs []string) ([]net.IP, error) {
+	var out []net.IP
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address in configuration: %q", addr)
+		}
+		out = append(out, ip)
+	}
+	return out, nil
+}
+
+// parseEmailAddresses validates bare RFC 5322 addresses such as "admin@example.com".
+func parseEmailAddresses(addrs []string) ([]string, error) {
+	var out []string
+	for _, addr := range addrs {
+		parsed, err := mail.ParseAddress(addr)
+		if err != nil || parsed.Address != addr {
+			return nil, fmt.Errorf("invalid email address in configuration: %q", addr)
+		}
+		out = append(out, addr)
+	}
+	return out, nil
+}
+
+// parseURIs parses absolute URIs such as "spiffe://example.com/service".
+func parseURIs(uris []string) ([]*url.URL, error) {
+	var out []*url.URL
+	for _, raw := range uris {
+		u, err := url.Parse(raw)
+		if err != nil || !u.IsAbs() {
+			return nil, fmt.Errorf("invalid URI in configuration: %q", raw)
+		}
+		out = append(out, u)
+	}
+	return out, nil
+}
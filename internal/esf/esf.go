@@ -0,0 +1,168 @@
+package esf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/dstout-devops/hephaestus/internal/transport"
+)
+
+const (
+	// defaultTimeout bounds a submission when no HTTP client is supplied.
+	defaultTimeout = 30 * time.Second
+	// maxErrorBody limits how much of an error response body is reported.
+	maxErrorBody = 512
+)
+
+// Request is the JSON body submitted to the ESF endpoint.
+type Request struct {
+	CSR           string `json:"csr"`
+	ProgramID     string `json:"program_id"`
+	ServiceID     string `json:"service_id"`
+	ApplicationID string `json:"application_id"`
+}
+
+// Response is the JSON body returned by the ESF endpoint.
+type Response struct {
+	RequestID   string `json:"request_id,omitempty"` // Identifier for fetching the certificate later
+	Certificate string `json:"certificate"`          // PEM-encoded leaf certificate
+	Chain       string `json:"chain,omitempty"`      // PEM-encoded issuing chain
+}
+
+// Client submits CSRs to an ESF endpoint.
+type Client struct {
+	httpClient *http.Client
+	endpoint   string
+}
+
+// NewClient creates a new Client for the given endpoint. A nil httpClient uses a client with a default timeout.
+func NewClient(httpClient *http.Client, endpoint string) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	return &Client{httpClient: httpClient, endpoint: endpoint}
+}
+
+// Submit posts the PEM-encoded CSR with the ESF identifiers and returns the issued certificate.
+func (c *Client) Submit(ctx context.Context, ids config.ESFConfig, csrPEM []byte) (*certs.Bundle, error) {
+	if c.endpoint == "" {
+		return nil, errors.New("no endpoint configured")
+	}
+
+	body, err := json.Marshal(Request{
+		CSR:           string(csrPEM),
+		ProgramID:     ids.ProgramID,
+		ServiceID:     ids.ServiceID,
+		ApplicationID: ids.ApplicationID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req)
+}
+
+// Fetch retrieves a previously requested certificate by its request ID.
+func (c *Client) Fetch(ctx context.Context, requestID string) (*certs.Bundle, error) {
+	if c.endpoint == "" {
+		return nil, errors.New("no endpoint configured")
+	}
+	if requestID == "" {
+		return nil, errors.New("no request ID given")
+	}
+
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("request_id", requestID)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := c.do(req)
+	var serr *statusError
+	if errors.As(err, &serr) && final(serr.code) {
+		return nil, &certs.RejectedError{RequestID: requestID, Reason: serr.Error()}
+	}
+	return bundle, err
+}
+
+// statusError reports a response with a non-2xx status.
+type statusError struct {
+	code   int
+	status string
+	msg    []byte
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("endpoint returned %s: %s", e.status, e.msg)
+}
+
+// final reports whether a fetch answered with code names a request that will
+// never be issued. Authentication, rate limiting and server errors may pass.
+func final(code int) bool {
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return code >= 400 && code < 500
+}
+
+// do sends the request and decodes the certificate from the response. A
+// request the endpoint accepted without issuing a certificate is reported as a
+// *certs.PendingError.
+func (c *Client) do(req *http.Request) (*certs.Bundle, error) {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return nil, &statusError{code: resp.StatusCode, status: resp.Status, msg: bytes.TrimSpace(msg)}
+	}
+
+	var res Response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if res.Certificate == "" {
+		if resp.StatusCode == http.StatusAccepted || res.RequestID != "" {
+			if res.RequestID == "" {
+				return nil, errors.New("pending response contains no request ID")
+			}
+			retryAfter, _ := transport.RetryAfter(resp, time.Now())
+			return nil, &certs.PendingError{RequestID: res.RequestID, RetryAfter: retryAfter}
+		}
+		return nil, errors.New("response contains no certificate")
+	}
+
+	// The fields need not end in a newline, so they are joined with one to
+	// keep the PEM blocks apart
+	bundle, err := certs.ParsePEM([]byte(res.Certificate + "\n" + res.Chain))
+	if err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
@@ -0,0 +1,203 @@
+package esf
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCSR creates a PEM-encoded CSR for testing.
+func newCSR(t *testing.T, cn string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate key")
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: cn},
+	}, key)
+	require.NoError(t, err, "failed to create CSR")
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+// fakeCA returns a handler that issues a self-signed certificate for the
+// submitted CSR. It runs on the server's goroutine, so failures are reported
+// with t.Errorf and a 500 response rather than require.
+func fakeCA(t *testing.T, got *Request) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		pemCert, err := issue(got.CSR)
+		if err != nil {
+			t.Errorf("failed to issue certificate: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Response{Certificate: pemCert})
+	}
+}
+
+// issue returns a PEM-encoded self-signed certificate for the PEM-encoded CSR.
+func issue(csrPEM string) (string, error) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil {
+		return "", errors.New("failed to decode CSR")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, csr.PublicKey, caKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), nil
+}
+
+// TestClient_Submit tests a successful submission against a fake CA.
+func TestClient_Submit(t *testing.T) {
+	var got Request
+	srv := httptest.NewServer(fakeCA(t, &got))
+	defer srv.Close()
+
+	ids := config.ESFConfig{ProgramID: "1", ServiceID: "2", ApplicationID: "3"}
+	csrPEM := newCSR(t, "test.com")
+
+	bundle, err := NewClient(srv.Client(), srv.URL).Submit(context.Background(), ids, csrPEM)
+	require.NoError(t, err, "Submit should not return an error")
+	assert.Equal(t, "test.com", bundle.Certificate.Subject.CommonName, "Certificate subject should match CSR")
+	assert.Empty(t, bundle.Chain, "Expected no chain")
+
+	// Verify the request carried the CSR and ESF identifiers
+	assert.Equal(t, string(csrPEM), got.CSR, "CSR should be submitted as PEM")
+	assert.Equal(t, "1", got.ProgramID, "ProgramID should match")
+	assert.Equal(t, "2", got.ServiceID, "ServiceID should match")
+	assert.Equal(t, "3", got.ApplicationID, "ApplicationID should match")
+}
+
+// TestClient_Submit_Chain tests that a certificate without a trailing newline
+// is kept apart from its chain.
+func TestClient_Submit_Chain(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pemCert := func(cn string) string {
+		tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: cn}, NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	leaf, intermediate := pemCert("test.com"), pemCert("Intermediate CA")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(Response{Certificate: strings.TrimSuffix(leaf, "\n"), Chain: intermediate})
+	}))
+	defer srv.Close()
+
+	bundle, err := NewClient(srv.Client(), srv.URL).Submit(context.Background(), config.ESFConfig{}, newCSR(t, "test.com"))
+	require.NoError(t, err, "Submit should not return an error")
+	assert.Equal(t, "test.com", bundle.Certificate.Subject.CommonName, "Expected the leaf certificate")
+	require.Len(t, bundle.Chain, 1, "Expected the intermediate in the chain")
+	assert.Equal(t, "Intermediate CA", bundle.Chain[0].Subject.CommonName)
+}
+
+// TestClient_Submit_HTTPError tests that a non-2xx response is reported.
+func TestClient_Submit_HTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.Client(), srv.URL).Submit(context.Background(), config.ESFConfig{}, newCSR(t, "test.com"))
+	require.Error(t, err, "Submit should fail on HTTP error")
+	assert.Equal(t, "endpoint returned 400 Bad Request: bad request", err.Error(), "error message should match expected")
+}
+
+// TestClient_Submit_NoCertificate tests that a response without a certificate is rejected.
+func TestClient_Submit_NoCertificate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.Client(), srv.URL).Submit(context.Background(), config.ESFConfig{}, newCSR(t, "test.com"))
+	assert.EqualError(t, err, "response contains no certificate", "Expected specific error message")
+}
+
+// TestClient_Submit_Pending tests that an accepted request without a certificate is reported as pending.
+func TestClient_Submit_Pending(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "300")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"request_id":"REQ-42"}`))
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.Client(), srv.URL).Submit(context.Background(), config.ESFConfig{}, newCSR(t, "test.com"))
+	var perr *certs.PendingError
+	require.ErrorAs(t, err, &perr, "Expected a pending error")
+	assert.Equal(t, "REQ-42", perr.RequestID)
+	assert.Equal(t, 5*time.Minute, perr.RetryAfter)
+}
+
+// TestClient_Fetch_Pending tests that a request still awaiting approval is reported as pending.
+func TestClient_Fetch_Pending(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"request_id":"` + r.URL.Query().Get("request_id") + `"}`))
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.Client(), srv.URL).Fetch(context.Background(), "REQ-42")
+	var perr *certs.PendingError
+	require.ErrorAs(t, err, &perr, "Expected a pending error")
+	assert.Equal(t, "REQ-42", perr.RequestID)
+	assert.Zero(t, perr.RetryAfter)
+}
+
+// TestClient_Fetch_Rejected tests that a client error on fetch is reported as
+// a rejected request, and that a server error is not.
+func TestClient_Fetch_Rejected(t *testing.T) {
+	status := http.StatusNotFound
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown request", status)
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.Client(), srv.URL).Fetch(context.Background(), "REQ-42")
+	var rerr *certs.RejectedError
+	require.ErrorAs(t, err, &rerr, "Expected a rejected error")
+	assert.Equal(t, "request REQ-42 was rejected: endpoint returned 404 Not Found: unknown request", err.Error())
+
+	status = http.StatusServiceUnavailable
+	_, err = NewClient(srv.Client(), srv.URL).Fetch(context.Background(), "REQ-42")
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &rerr), "A server error should not reject the request")
+}
@@ -0,0 +1,225 @@
+package est
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/dstout-devops/hephaestus/internal/secret"
+	"github.com/dstout-devops/hephaestus/internal/transport"
+	"github.com/smallstep/pkcs7"
+)
+
+const (
+	// defaultTimeout bounds each request when no HTTP client is supplied.
+	defaultTimeout = 30 * time.Second
+	// maxErrorBody limits how much of an error response body is reported.
+	maxErrorBody = 512
+	// maxResponseBody limits the size of a certificate response.
+	maxResponseBody = 1 << 20
+)
+
+// Client enrolls certificates with an RFC 7030 EST server.
+type Client struct {
+	httpClient *http.Client
+	cfg        config.ESTConfig
+	reenroll   bool // An existing certificate is presented for TLS client auth
+}
+
+// NewClient creates a new Client. A nil httpClient uses a client with a default
+// timeout. When the certificate at cfg.ClientCert exists it is presented for TLS
+// client authentication and the client re-enrolls; otherwise it enrolls.
+func NewClient(httpClient *http.Client, cfg config.ESTConfig) (*Client, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	c := &Client{httpClient: httpClient, cfg: cfg}
+
+	if cfg.ClientCert == "" {
+		return c, nil
+	}
+	if _, err := os.Stat(cfg.ClientCert); errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	if c.httpClient, err = transport.WithClientCert(httpClient, cert); err != nil {
+		return nil, err
+	}
+	c.reenroll = true
+	return c, nil
+}
+
+// Submit fetches the CA certificates, posts the PEM-encoded CSR to
+// simpleenroll, or simplereenroll when re-enrolling, and returns the issued
+// certificate with the CA certificates as its chain. A request the server
+// accepts without issuing a certificate is reported as a *certs.PendingError
+// whose request ID is RequestID of the CSR.
+func (c *Client) Submit(ctx context.Context, csrPEM []byte) (*certs.Bundle, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("failed to decode CSR")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSR: %w", err)
+	}
+
+	caCerts, err := c.CACerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	op := "simpleenroll"
+	if c.reenroll {
+		op = "simplereenroll"
+	}
+	body := base64.StdEncoding.EncodeToString(block.Bytes)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(op), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/pkcs10")
+	req.Header.Set("Content-Transfer-Encoding", "base64")
+	if err := c.authenticate(req); err != nil {
+		return nil, err
+	}
+
+	issued, err := c.do(req)
+	var perr *certs.PendingError
+	if errors.As(err, &perr) {
+		perr.RequestID = RequestID(csr)
+		return nil, perr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", op, err)
+	}
+	return certs.ForKey(csr.PublicKey, issued, caCerts)
+}
+
+// Fetch checks on a pending request. EST has no request IDs: the client sends
+// the same CSR again (RFC 7030 section 4.2.3), so csrPEM must be the CSR whose
+// RequestID is requestID. Any other CSR is reported as a *certs.RejectedError.
+func (c *Client) Fetch(ctx context.Context, requestID string, csrPEM []byte) (*certs.Bundle, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("failed to decode CSR")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSR: %w", err)
+	}
+	if RequestID(csr) != requestID {
+		return nil, &certs.RejectedError{RequestID: requestID, Reason: "the CSR it was made with has changed"}
+	}
+	return c.Submit(ctx, csrPEM)
+}
+
+// RequestID identifies a pending enrollment by the SHA-256 digest of its CSR.
+func RequestID(csr *x509.CertificateRequest) string {
+	sum := sha256.Sum256(csr.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// CACerts retrieves the current CA certificates from the cacerts operation.
+func (c *Client) CACerts(ctx context.Context) ([]*x509.Certificate, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("cacerts"), nil)
+	if err != nil {
+		return nil, err
+	}
+	caCerts, err := c.do(req)
+	var perr *certs.PendingError
+	if errors.As(err, &perr) {
+		return nil, errors.New("cacerts failed: server returned 202 Accepted without certificates")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cacerts failed: %w", err)
+	}
+	return caCerts, nil
+}
+
+// url returns the URL of an EST operation, including the optional CA label.
+func (c *Client) url(op string) string {
+	u := strings.TrimSuffix(c.cfg.URL, "/") + "/.well-known/est/"
+	if c.cfg.Label != "" {
+		u += c.cfg.Label + "/"
+	}
+	return u + op
+}
+
+// authenticate adds HTTP basic credentials when a username is configured.
+func (c *Client) authenticate(req *http.Request) error {
+	if c.cfg.Username == "" {
+		return nil
+	}
+	var password string
+	if c.cfg.Password.IsSet() {
+		var err error
+		if password, err = secret.Resolve(c.cfg.Password); err != nil {
+			return fmt.Errorf("failed to read EST password: %w", err)
+		}
+	}
+	req.SetBasicAuth(c.cfg.Username, password)
+	return nil
+}
+
+// do sends the request and decodes the certs-only PKCS#7 response. A request
+// the server accepted without issuing a certificate is reported as a
+// *certs.PendingError without a request ID.
+func (c *Client) do(req *http.Request) ([]*x509.Certificate, error) {
+	req.Header.Set("Accept", "application/pkcs7-mime")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted {
+		retryAfter, _ := transport.RetryAfter(resp, time.Now())
+		return nil, &certs.PendingError{RetryAfter: retryAfter}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return nil, fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return parseCertsOnly(data)
+}
+
+// parseCertsOnly decodes a certs-only PKCS#7 structure, either base64 encoded
+// as RFC 7030 requires or as raw DER as some servers send it.
+func parseCertsOnly(data []byte) ([]*x509.Certificate, error) {
+	der, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(data), nil)))
+	if err != nil {
+		der = data
+	}
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 response: %w", err)
+	}
+	if len(p7.Certificates) == 0 {
+		return nil, errors.New("PKCS#7 response contains no certificates")
+	}
+	return p7.Certificates, nil
+}
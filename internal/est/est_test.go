@@ -0,0 +1,290 @@
+package est
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/smallstep/pkcs7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCSR creates a PEM-encoded CSR and its key for testing.
+func newCSR(t *testing.T, cn string) ([]byte, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate key")
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: cn},
+	}, key)
+	require.NoError(t, err, "failed to create CSR")
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), key
+}
+
+// fakeEST is an EST server that signs CSRs with a self-signed CA.
+type fakeEST struct {
+	*httptest.Server
+	ca       *x509.Certificate
+	caKey    *ecdsa.PrivateKey
+	paths    []string // Request paths in order
+	username string   // Basic auth user of the last enrollment
+	peer     string   // Common name of the last TLS client certificate
+	pending  bool     // Answer enrollments with 202 Accepted
+}
+
+// newFakeEST starts a TLS EST server that requests, but does not require, client certificates.
+func newFakeEST(t *testing.T) *fakeEST {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test EST CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	f := &fakeEST{ca: ca, caKey: caKey}
+	f.Server = httptest.NewUnstartedServer(http.HandlerFunc(f.serve(t)))
+	f.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	f.StartTLS()
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeEST) serve(t *testing.T) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f.paths = append(f.paths, r.URL.Path)
+		switch filepath.Base(r.URL.Path) {
+		case "cacerts":
+			f.write(t, w, f.ca.Raw)
+		case "simpleenroll", "simplereenroll":
+			if f.pending {
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			f.username, _, _ = r.BasicAuth()
+			f.peer = ""
+			if len(r.TLS.PeerCertificates) > 0 {
+				f.peer = r.TLS.PeerCertificates[0].Subject.CommonName
+			}
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			der, err := base64.StdEncoding.DecodeString(string(body))
+			require.NoError(t, err)
+			csr, err := x509.ParseCertificateRequest(der)
+			require.NoError(t, err)
+
+			tmpl := &x509.Certificate{
+				SerialNumber: big.NewInt(time.Now().UnixNano()),
+				Subject:      csr.Subject,
+				NotBefore:    time.Now().Add(-time.Minute),
+				NotAfter:     time.Now().Add(time.Hour),
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			}
+			cert, err := x509.CreateCertificate(rand.Reader, tmpl, f.ca, csr.PublicKey, f.caKey)
+			require.NoError(t, err)
+			f.write(t, w, cert)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// write sends der as a base64 certs-only PKCS#7 response.
+func (f *fakeEST) write(t *testing.T, w http.ResponseWriter, der []byte) {
+	p7, err := pkcs7.DegenerateCertificate(der)
+	require.NoError(t, err)
+	w.Header().Set("Content-Type", "application/pkcs7-mime; smime-type=certs-only")
+	w.Header().Set("Content-Transfer-Encoding", "base64")
+	_, _ = io.WriteString(w, base64.StdEncoding.EncodeToString(p7))
+}
+
+// TestSubmit_Enroll tests initial enrollment with basic auth and a CA label.
+func TestSubmit_Enroll(t *testing.T) {
+	f := newFakeEST(t)
+	t.Setenv("EST_PASSWORD", "secret")
+	client, err := NewClient(f.Client(), config.ESTConfig{
+		URL:      f.URL,
+		Label:    "servers",
+		Username: "enroller",
+		Password: config.PassphraseConfig{Env: "EST_PASSWORD"},
+	})
+	require.NoError(t, err)
+
+	csrPEM, _ := newCSR(t, "host.example.com")
+	bundle, err := client.Submit(context.Background(), csrPEM)
+	require.NoError(t, err, "Submit should succeed")
+
+	assert.Equal(t, []string{"/.well-known/est/servers/cacerts", "/.well-known/est/servers/simpleenroll"}, f.paths)
+	assert.Equal(t, "enroller", f.username)
+	assert.Equal(t, "host.example.com", bundle.Certificate.Subject.CommonName)
+	require.Len(t, bundle.Chain, 1)
+	assert.True(t, bundle.Chain[0].Equal(f.ca), "Expected the CA certificate as the chain")
+}
+
+// TestSubmit_EmptyPassword tests that an empty password variable is an error
+// rather than an empty basic auth password.
+func TestSubmit_EmptyPassword(t *testing.T) {
+	f := newFakeEST(t)
+	t.Setenv("EST_PASSWORD", "")
+	client, err := NewClient(f.Client(), config.ESTConfig{
+		URL:      f.URL,
+		Username: "enroller",
+		Password: config.PassphraseConfig{Env: "EST_PASSWORD"},
+	})
+	require.NoError(t, err)
+
+	csrPEM, _ := newCSR(t, "host.example.com")
+	_, err = client.Submit(context.Background(), csrPEM)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read EST password: environment variable EST_PASSWORD is empty")
+	assert.NotContains(t, f.paths, "/.well-known/est/simpleenroll", "The CSR should not be sent")
+}
+
+// TestSubmit_Reenroll tests that an existing certificate is used for TLS client
+// auth and the CSR is posted to simplereenroll.
+func TestSubmit_Reenroll(t *testing.T) {
+	f := newFakeEST(t)
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "certificate.pem")
+	keyPath := filepath.Join(dir, "current.key")
+
+	// Enroll once to obtain the certificate being renewed
+	client, err := NewClient(f.Client(), config.ESTConfig{URL: f.URL, ClientCert: certPath, ClientKey: keyPath})
+	require.NoError(t, err, "A missing client certificate should fall back to enrollment")
+	csrPEM, key := newCSR(t, "host.example.com")
+	bundle, err := client.Submit(context.Background(), csrPEM)
+	require.NoError(t, err)
+	assert.Empty(t, f.peer, "Initial enrollment should not present a client certificate")
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certPath, bundle.PEM(), 0644))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	f.paths = nil
+	client, err = NewClient(f.Client(), config.ESTConfig{URL: f.URL, ClientCert: certPath, ClientKey: keyPath})
+	require.NoError(t, err)
+	csrPEM, _ = newCSR(t, "host.example.com")
+	renewed, err := client.Submit(context.Background(), csrPEM)
+	require.NoError(t, err, "Submit should succeed")
+
+	assert.Equal(t, []string{"/.well-known/est/cacerts", "/.well-known/est/simplereenroll"}, f.paths)
+	assert.Equal(t, "host.example.com", f.peer, "Expected the existing certificate for TLS client auth")
+	assert.NotEqual(t, bundle.Certificate.SerialNumber, renewed.Certificate.SerialNumber)
+}
+
+// TestSubmit_Pending tests that a 202 response is reported as pending and
+// that sending the same CSR again retrieves the certificate.
+func TestSubmit_Pending(t *testing.T) {
+	f := newFakeEST(t)
+	f.pending = true
+	client, err := NewClient(f.Client(), config.ESTConfig{URL: f.URL})
+	require.NoError(t, err)
+
+	csrPEM, _ := newCSR(t, "host.example.com")
+	_, err = client.Submit(context.Background(), csrPEM)
+	var perr *certs.PendingError
+	require.ErrorAs(t, err, &perr, "Expected a pending request")
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	assert.Equal(t, RequestID(csr), perr.RequestID, "Expected the CSR digest as the request ID")
+	assert.Equal(t, time.Minute, perr.RetryAfter)
+
+	_, err = client.Fetch(context.Background(), perr.RequestID, csrPEM)
+	require.ErrorAs(t, err, &perr, "Expected the request to be still pending")
+
+	f.pending = false
+	other, _ := newCSR(t, "host.example.com")
+	_, err = client.Fetch(context.Background(), perr.RequestID, other)
+	var rerr *certs.RejectedError
+	require.ErrorAs(t, err, &rerr, "A different CSR should not be sent")
+	assert.Equal(t, perr.RequestID, rerr.RequestID)
+
+	bundle, err := client.Fetch(context.Background(), perr.RequestID, csrPEM)
+	require.NoError(t, err, "Expected the certificate once issued")
+	assert.Equal(t, "host.example.com", bundle.Certificate.Subject.CommonName)
+}
+
+// TestSubmit_Errors tests server errors.
+func TestSubmit_Errors(t *testing.T) {
+	tests := map[string]struct {
+		status  int
+		wantErr string
+	}{
+		"rejected": {http.StatusForbidden, "simpleenroll failed: server returned 403 Forbidden: denied"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeEST(t)
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if filepath.Base(r.URL.Path) == "cacerts" {
+					f.write(t, w, f.ca.Raw)
+					return
+				}
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, "denied")
+			}))
+			defer srv.Close()
+
+			client, err := NewClient(srv.Client(), config.ESTConfig{URL: srv.URL})
+			require.NoError(t, err)
+			csrPEM, _ := newCSR(t, "host.example.com")
+			_, err = client.Submit(context.Background(), csrPEM)
+			require.Error(t, err)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+// TestParseCertsOnly tests decoding base64 and raw DER responses.
+func TestParseCertsOnly(t *testing.T) {
+	f := newFakeEST(t)
+	p7, err := pkcs7.DegenerateCertificate(f.ca.Raw)
+	require.NoError(t, err)
+
+	wrapped := base64.StdEncoding.EncodeToString(p7)
+	for name, data := range map[string][]byte{
+		"base64":       []byte(wrapped),
+		"base64 lines": []byte(wrapped[:40] + "\r\n" + wrapped[40:] + "\r\n"),
+		"der":          p7,
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseCertsOnly(data)
+			require.NoError(t, err)
+			require.Len(t, got, 1)
+			assert.True(t, got[0].Equal(f.ca))
+		})
+	}
+
+	_, err = parseCertsOnly([]byte("garbage"))
+	assert.ErrorContains(t, err, "failed to parse PKCS#7 response")
+}
@@ -0,0 +1,452 @@
+//go:build cgo
+
+package hsm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/dstout-devops/hephaestus/internal/keys"
+	"github.com/dstout-devops/hephaestus/internal/secret"
+	"github.com/miekg/pkcs11"
+)
+
+// Supported reports whether this build can use PKCS#11 tokens.
+const Supported = true
+
+// Key is a private key kept in a PKCS#11 token. Signing happens inside the
+// token; the key material is never read.
+type Key struct {
+	ctx     *pkcs11.Ctx
+	mu      sync.Mutex // A session runs one operation at a time
+	session pkcs11.SessionHandle
+	handle  pkcs11.ObjectHandle
+	public  crypto.PublicKey
+	uri     URI
+}
+
+var _ keys.Reference = (*Key)(nil)
+
+var (
+	modulesMu sync.Mutex
+	modules   = make(map[string]*pkcs11.Ctx) // Loaded libraries, initialized once per process
+)
+
+// GenerateKey returns the key labelled key.pkcs11.label in the configured
+// token, generating it there first when the token has no such key.
+func GenerateKey(cfg config.KeyConfig) (crypto.PrivateKey, error) {
+	p := cfg.PKCS11
+	if p.Label == "" {
+		return nil, errors.New("no PKCS#11 key label configured")
+	}
+	k, err := open(URI{Module: p.Module, Slot: p.Slot, Token: p.TokenLabel, Object: p.Label}, p)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := k.find(pkcs11.CKO_PRIVATE_KEY)
+	if err != nil {
+		k.Close()
+		return nil, err
+	}
+	if !found {
+		err = k.generate(p.KeyType, cfg.Size, cfg.Curve)
+	}
+	if err == nil {
+		err = k.loadPublic()
+	}
+	if err != nil {
+		k.Close()
+		return nil, err
+	}
+	return k, nil
+}
+
+// Load opens the key named by a saved pkcs11 URI. The module defaults to
+// key.pkcs11.module and the PIN is read from key.pkcs11.pin.
+func Load(uri string, cfg config.KeyConfig) (crypto.PrivateKey, error) {
+	u, err := ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Module == "" {
+		u.Module = cfg.PKCS11.Module
+	}
+	k, err := open(u, cfg.PKCS11)
+	if err != nil {
+		return nil, err
+	}
+	found, err := k.find(pkcs11.CKO_PRIVATE_KEY)
+	if err == nil && !found {
+		err = fmt.Errorf("no private key found for %s", describe(u))
+	}
+	if err == nil {
+		err = k.loadPublic()
+	}
+	if err != nil {
+		k.Close()
+		return nil, err
+	}
+	return k, nil
+}
+
+// open logs in to the token named by u and returns a Key without an object.
+func open(u URI, p config.PKCS11Config) (*Key, error) {
+	if u.Module == "" {
+		return nil, errors.New("no PKCS#11 module configured")
+	}
+	pin, err := secret.Resolve(p.PIN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PKCS#11 PIN: %w", err)
+	}
+	ctx, err := module(u.Module)
+	if err != nil {
+		return nil, err
+	}
+	slot, err := findSlot(ctx, u.Slot, u.Token)
+	if err != nil {
+		return nil, err
+	}
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PKCS#11 session: %w", err)
+	}
+	err = ctx.Login(session, pkcs11.CKU_USER, pin)
+	if err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+		ctx.CloseSession(session)
+		return nil, fmt.Errorf("failed to log in to PKCS#11 token: %w", err)
+	}
+	if u.Slot == nil {
+		u.Slot = &slot
+	}
+	return &Key{ctx: ctx, session: session, uri: u}, nil
+}
+
+// module loads and initializes the PKCS#11 library at path, once per process.
+func module(path string) (*pkcs11.Ctx, error) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	if ctx, ok := modules[path]; ok {
+		return ctx, nil
+	}
+	ctx := pkcs11.New(path)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %s", path)
+	}
+	if err := ctx.Initialize(); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		ctx.Destroy()
+		return nil, fmt.Errorf("failed to initialize PKCS#11 module %s: %w", path, err)
+	}
+	modules[path] = ctx
+	return ctx, nil
+}
+
+// findSlot returns the slot holding the token with the given slot ID and
+// label. When neither is given, the only token present is used.
+func findSlot(ctx *pkcs11.Ctx, slot *uint, label string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list PKCS#11 slots: %w", err)
+	}
+	var matches []uint
+	for _, id := range slots {
+		if slot != nil && id != *slot {
+			continue
+		}
+		if label != "" {
+			info, err := ctx.GetTokenInfo(id)
+			if err != nil || info.Label != label {
+				continue
+			}
+		}
+		matches = append(matches, id)
+	}
+	switch {
+	case len(matches) == 1:
+		return matches[0], nil
+	case len(matches) == 0:
+		return 0, fmt.Errorf("no PKCS#11 token found for %s", describe(URI{Slot: slot, Token: label}))
+	default:
+		return 0, errors.New("several PKCS#11 tokens found, set key.pkcs11.slot or key.pkcs11.token_label")
+	}
+}
+
+// find looks up the object of class with the key's label or ID. A private
+// key found this way becomes the key's handle.
+func (k *Key) find(class uint) (bool, error) {
+	handle, found, err := k.findObject(class)
+	if err == nil && found && class == pkcs11.CKO_PRIVATE_KEY {
+		k.handle = handle
+		if len(k.uri.ID) == 0 {
+			attrs, err := k.ctx.GetAttributeValue(k.session, handle, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_ID, nil)})
+			if err == nil && len(attrs[0].Value) > 0 {
+				k.uri.ID = attrs[0].Value
+			}
+		}
+	}
+	return found, err
+}
+
+func (k *Key) findObject(class uint) (pkcs11.ObjectHandle, bool, error) {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, class)}
+	if len(k.uri.ID) > 0 {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, k.uri.ID))
+	}
+	if k.uri.Object != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, k.uri.Object))
+	}
+	if err := k.ctx.FindObjectsInit(k.session, template); err != nil {
+		return 0, false, fmt.Errorf("failed to search PKCS#11 token: %w", err)
+	}
+	handles, _, err := k.ctx.FindObjects(k.session, 2)
+	if ferr := k.ctx.FindObjectsFinal(k.session); err == nil {
+		err = ferr
+	}
+	switch {
+	case err != nil:
+		return 0, false, fmt.Errorf("failed to search PKCS#11 token: %w", err)
+	case len(handles) > 1:
+		return 0, false, fmt.Errorf("several keys match %s, set a unique label", describe(k.uri))
+	case len(handles) == 0:
+		return 0, false, nil
+	}
+	return handles[0], true, nil
+}
+
+// generate creates a non-exportable key pair in the token.
+func (k *Key) generate(keyType string, bits int, curve string) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	var mech uint
+	public := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, k.uri.Object),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	}
+	private := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, k.uri.Object),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	}
+	switch keyType {
+	case "rsa":
+		if bits < 2048 {
+			return errors.New("RSA key size must be at least 2048 bits")
+		}
+		mech = pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN
+		public = append(public,
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, bits),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+		)
+		private = append(private, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA))
+	case "", "ecdsa":
+		c, err := keys.ECDSACurve(curve)
+		if err != nil {
+			return err
+		}
+		params, err := asn1.Marshal(curveOIDs[c])
+		if err != nil {
+			return err
+		}
+		mech = pkcs11.CKM_EC_KEY_PAIR_GEN
+		public = append(public,
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params),
+		)
+		private = append(private, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC))
+	default:
+		return fmt.Errorf("unsupported PKCS#11 key type: %s", keyType)
+	}
+
+	_, handle, err := k.ctx.GenerateKeyPair(k.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mech, nil)}, public, private)
+	if err != nil {
+		return fmt.Errorf("failed to generate key in PKCS#11 token: %w", err)
+	}
+	k.handle, k.uri.ID = handle, id
+	return nil
+}
+
+// curveOIDs maps the supported curves to their named curve OIDs.
+var curveOIDs = map[elliptic.Curve]asn1.ObjectIdentifier{
+	elliptic.P256(): {1, 2, 840, 10045, 3, 1, 7},
+	elliptic.P384(): {1, 3, 132, 0, 34},
+	elliptic.P521(): {1, 3, 132, 0, 35},
+}
+
+// loadPublic reads the public half of the key, from the private key object
+// for RSA and from the matching public key object for ECDSA.
+func (k *Key) loadPublic() error {
+	attrs, err := k.ctx.GetAttributeValue(k.session, k.handle, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil)})
+	if err != nil {
+		return fmt.Errorf("failed to read PKCS#11 key type: %w", err)
+	}
+
+	switch bytesToUint(attrs[0].Value) {
+	case pkcs11.CKK_RSA:
+		attrs, err := k.ctx.GetAttributeValue(k.session, k.handle, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read PKCS#11 public key: %w", err)
+		}
+		k.public = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+		}
+	case pkcs11.CKK_EC:
+		pub, found, err := k.findObject(pkcs11.CKO_PUBLIC_KEY)
+		if err == nil && !found {
+			err = errors.New("no matching public key object")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read PKCS#11 public key: %w", err)
+		}
+		attrs, err := k.ctx.GetAttributeValue(k.session, pub, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read PKCS#11 public key: %w", err)
+		}
+		k.public, err = ecdsaPublicKey(attrs[0].Value, attrs[1].Value)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("unsupported PKCS#11 key type, only RSA and EC keys can be used")
+	}
+	return nil
+}
+
+// ecdsaPublicKey decodes CKA_EC_PARAMS and CKA_EC_POINT. The point is a DER
+// OCTET STRING, though some tokens return the bare point.
+func ecdsaPublicKey(params, point []byte) (*ecdsa.PublicKey, error) {
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(params, &oid); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#11 curve: %w", err)
+	}
+	var curve elliptic.Curve
+	for c, o := range curveOIDs {
+		if o.Equal(oid) {
+			curve = c
+		}
+	}
+	if curve == nil {
+		return nil, fmt.Errorf("unsupported PKCS#11 curve %s", oid)
+	}
+
+	var raw []byte
+	if rest, err := asn1.Unmarshal(point, &raw); err != nil || len(rest) > 0 {
+		raw = point
+	}
+	x, y := elliptic.Unmarshal(curve, raw)
+	if x == nil {
+		return nil, errors.New("failed to parse PKCS#11 EC point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// Public returns the public key.
+func (k *Key) Public() crypto.PublicKey {
+	return k.public
+}
+
+// Sign signs digest inside the token. RSA keys sign with PKCS#1 v1.5, or PSS
+// when opts is *rsa.PSSOptions; ECDSA signatures are returned ASN.1 encoded.
+func (k *Key) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var mech *pkcs11.Mechanism
+	data := digest
+	switch k.public.(type) {
+	case *ecdsa.PublicKey:
+		mech = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	case *rsa.PublicKey:
+		h, ok := hashes[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("unsupported hash for PKCS#11 RSA signature: %v", opts.HashFunc())
+		}
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			salt := pss.SaltLength
+			if salt <= 0 {
+				salt = opts.HashFunc().Size()
+			}
+			mech = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, pkcs11.NewPSSParams(h.mech, h.mgf, uint(salt)))
+		} else {
+			mech = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+			data = append(append([]byte{}, h.prefix...), digest...)
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.ctx.SignInit(k.session, []*pkcs11.Mechanism{mech}, k.handle); err != nil {
+		return nil, fmt.Errorf("PKCS#11 signing failed: %w", err)
+	}
+	sig, err := k.ctx.Sign(k.session, data)
+	if err != nil {
+		return nil, fmt.Errorf("PKCS#11 signing failed: %w", err)
+	}
+	if _, ok := k.public.(*ecdsa.PublicKey); ok {
+		// The token returns r and s concatenated, x509 expects them ASN.1 encoded
+		half := len(sig) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			new(big.Int).SetBytes(sig[:half]),
+			new(big.Int).SetBytes(sig[half:]),
+		})
+	}
+	return sig, nil
+}
+
+// hashes holds the PKCS#11 parameters for each supported RSA signature hash.
+// The prefix is the DER DigestInfo header of RFC 8017 that precedes a
+// PKCS#1 v1.5 digest.
+var hashes = map[crypto.Hash]struct {
+	mech, mgf uint
+	prefix    []byte
+}{
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256, []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384, []byte{0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30}},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512, []byte{0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40}},
+}
+
+// URI returns the reference saved in place of the key.
+func (k *Key) URI() string {
+	return k.uri.String()
+}
+
+// Close ends the key's session with the token. The key stays in the token.
+func (k *Key) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.ctx.CloseSession(k.session)
+}
+
+// bytesToUint decodes a CK_ULONG attribute value in native byte order.
+func bytesToUint(b []byte) uint {
+	var n uint
+	for i := len(b) - 1; i >= 0; i-- {
+		n = n<<8 | uint(b[i])
+	}
+	return n
+}
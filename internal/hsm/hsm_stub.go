@@ -0,0 +1,25 @@
+//go:build !cgo
+
+package hsm
+
+import (
+	"crypto"
+	"errors"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+)
+
+// Supported reports whether this build can use PKCS#11 tokens.
+const Supported = false
+
+var errNoCgo = errors.New("PKCS#11 support requires a build with cgo enabled")
+
+// GenerateKey always fails: PKCS#11 modules are loaded through cgo.
+func GenerateKey(config.KeyConfig) (crypto.PrivateKey, error) {
+	return nil, errNoCgo
+}
+
+// Load always fails: PKCS#11 modules are loaded through cgo.
+func Load(string, config.KeyConfig) (crypto.PrivateKey, error) {
+	return nil, errNoCgo
+}
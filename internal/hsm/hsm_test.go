@@ -0,0 +1,171 @@
+//go:build cgo
+
+package hsm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/dstout-devops/hephaestus/internal/csr"
+	"github.com/miekg/pkcs11"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// softHSMPaths are the usual install locations of the SoftHSM2 module.
+var softHSMPaths = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib64/pkcs11/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+}
+
+// newToken initializes a SoftHSM2 token in a temporary directory and returns
+// a key configuration for it. The test is skipped when SoftHSM2 is missing;
+// set SOFTHSM2_MODULE to point at a module in another location.
+func newToken(t *testing.T, label string) config.KeyConfig {
+	t.Helper()
+	lib := os.Getenv("SOFTHSM2_MODULE")
+	if lib == "" {
+		for _, p := range softHSMPaths {
+			if _, err := os.Stat(p); err == nil {
+				lib = p
+				break
+			}
+		}
+	}
+	if lib == "" {
+		t.Skip("SoftHSM2 not installed, set SOFTHSM2_MODULE to run PKCS#11 tests")
+	}
+
+	// SoftHSM2 reads its configuration when the module is first initialized,
+	// so every token of the test binary shares one directory.
+	if os.Getenv("SOFTHSM2_CONF") == "" {
+		dir, err := os.MkdirTemp("", "softhsm")
+		require.NoError(t, err)
+		conf := filepath.Join(dir, "softhsm2.conf")
+		require.NoError(t, os.WriteFile(conf, []byte("directories.tokendir = "+dir+"\nobjectstore.backend = file\n"), 0600))
+		require.NoError(t, os.Setenv("SOFTHSM2_CONF", conf))
+	}
+
+	ctx, err := module(lib)
+	require.NoError(t, err)
+	slots, err := ctx.GetSlotList(false)
+	require.NoError(t, err)
+	var free uint
+	found := false
+	for _, s := range slots {
+		info, err := ctx.GetTokenInfo(s)
+		if err == nil && info.Flags&pkcs11.CKF_TOKEN_INITIALIZED == 0 {
+			free, found = s, true
+			break
+		}
+	}
+	require.True(t, found, "Expected an uninitialized SoftHSM2 slot")
+	require.NoError(t, ctx.InitToken(free, "1234", label))
+
+	slot, err := findSlot(ctx, nil, label)
+	require.NoError(t, err)
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	require.NoError(t, err)
+	defer ctx.CloseSession(session)
+	require.NoError(t, ctx.Login(session, pkcs11.CKU_SO, "1234"))
+	require.NoError(t, ctx.InitPIN(session, "5678"))
+	require.NoError(t, ctx.Logout(session))
+
+	pin := filepath.Join(t.TempDir(), "pin")
+	require.NoError(t, os.WriteFile(pin, []byte("5678\n"), 0600))
+	return config.KeyConfig{
+		Type: "pkcs11",
+		PKCS11: config.PKCS11Config{
+			Module:     lib,
+			TokenLabel: label,
+			Label:      "web",
+			PIN:        config.PassphraseConfig{File: pin},
+		},
+	}
+}
+
+// TestGenerateKey tests that keys are generated in the token, sign there and
+// are found again by label.
+func TestGenerateKey(t *testing.T) {
+	tests := map[string]struct {
+		keyType string
+		bits    int
+		curve   string
+		check   func(t *testing.T, pub interface{})
+	}{
+		"ecdsa": {"ecdsa", 0, "P-384", func(t *testing.T, pub interface{}) {
+			require.IsType(t, &ecdsa.PublicKey{}, pub)
+			assert.Equal(t, elliptic.P384(), pub.(*ecdsa.PublicKey).Curve)
+		}},
+		"rsa": {"rsa", 2048, "", func(t *testing.T, pub interface{}) {
+			require.IsType(t, &rsa.PublicKey{}, pub)
+			assert.Equal(t, 2048, pub.(*rsa.PublicKey).N.BitLen())
+		}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := newToken(t, "test-"+name)
+			cfg.PKCS11.KeyType, cfg.Size, cfg.Curve = tt.keyType, tt.bits, tt.curve
+
+			priv, err := GenerateKey(cfg)
+			require.NoError(t, err)
+			key := priv.(*Key)
+			defer key.Close()
+			tt.check(t, key.Public())
+
+			// The CSR is signed inside the token
+			csrPEM, err := csr.GenerateCSR(key, config.CSRConfig{CommonName: "test.com"})
+			require.NoError(t, err)
+			block, _ := pem.Decode(csrPEM)
+			require.NotNil(t, block)
+			req, err := x509.ParseCertificateRequest(block.Bytes)
+			require.NoError(t, err)
+			assert.NoError(t, req.CheckSignature(), "Expected a valid signature from the token")
+
+			// A second run reuses the key with the same label
+			again, err := GenerateKey(cfg)
+			require.NoError(t, err)
+			defer again.(*Key).Close()
+			assert.Equal(t, key.URI(), again.(*Key).URI(), "Expected the existing key to be reused")
+
+			// The saved reference opens the same key
+			loaded, err := Load(key.URI(), cfg)
+			require.NoError(t, err)
+			defer loaded.(*Key).Close()
+			assert.Equal(t, key.Public(), loaded.(*Key).Public())
+		})
+	}
+}
+
+// TestLoad_Missing tests that a reference to a key the token does not hold fails.
+func TestLoad_Missing(t *testing.T) {
+	cfg := newToken(t, "test-missing")
+	_, err := Load("pkcs11:token=test-missing;object=absent;type=private", cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `no private key found for token "test-missing", label "absent"`)
+}
+
+// TestGenerateKey_EmptyPIN tests that an empty PIN variable is an error
+// rather than a login without a PIN.
+func TestGenerateKey_EmptyPIN(t *testing.T) {
+	t.Setenv("TEST_PKCS11_PIN", "")
+	_, err := GenerateKey(config.KeyConfig{
+		Type: "pkcs11",
+		PKCS11: config.PKCS11Config{
+			Module: "/nonexistent/libpkcs11.so",
+			Label:  "web",
+			PIN:    config.PassphraseConfig{Env: "TEST_PKCS11_PIN"},
+		},
+	})
+	assert.EqualError(t, err, "failed to read PKCS#11 PIN: environment variable TEST_PKCS11_PIN is empty")
+}
@@ -0,0 +1,169 @@
+package hsm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Scheme is the URI scheme of saved PKCS#11 key references.
+const Scheme = "pkcs11"
+
+// URI identifies a private key in a PKCS#11 token, in the form described by
+// RFC 7512, e.g. pkcs11:token=hsm;object=web;type=private?module-path=/usr/lib/softhsm/libsofthsm2.so.
+// It never carries the PIN.
+type URI struct {
+	Module string // Path to the PKCS#11 library
+	Slot   *uint  // Slot ID of the token
+	Token  string // Label of the token
+	Object string // Label of the key
+	ID     []byte // CKA_ID of the key
+}
+
+// String formats u as a pkcs11 URI.
+func (u URI) String() string {
+	var path []string
+	if u.Slot != nil {
+		path = append(path, "slot-id="+strconv.FormatUint(uint64(*u.Slot), 10))
+	}
+	if u.Token != "" {
+		path = append(path, "token="+escape(u.Token))
+	}
+	if u.Object != "" {
+		path = append(path, "object="+escape(u.Object))
+	}
+	if len(u.ID) > 0 {
+		var id strings.Builder
+		for _, b := range u.ID {
+			fmt.Fprintf(&id, "%%%02X", b)
+		}
+		path = append(path, "id="+id.String())
+	}
+	path = append(path, "type=private")
+
+	s := Scheme + ":" + strings.Join(path, ";")
+	if u.Module != "" {
+		s += "?module-path=" + escape(u.Module)
+	}
+	return s
+}
+
+// ParseURI parses a pkcs11 URI as written by URI.String. Attributes it does
+// not use are ignored.
+func ParseURI(s string) (URI, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(s), Scheme+":")
+	if !ok {
+		return URI{}, fmt.Errorf("not a %s URI: %q", Scheme, s)
+	}
+	path, query, _ := strings.Cut(rest, "?")
+
+	var u URI
+	for _, attr := range splitAttrs(path, ";") {
+		name, raw, _ := strings.Cut(attr, "=")
+		value, err := unescape(raw)
+		if err != nil {
+			return URI{}, fmt.Errorf("invalid %s URI attribute %s: %w", Scheme, name, err)
+		}
+		switch name {
+		case "slot-id":
+			slot, err := strconv.ParseUint(value, 10, 0)
+			if err != nil {
+				return URI{}, fmt.Errorf("invalid %s URI slot-id %q", Scheme, value)
+			}
+			id := uint(slot)
+			u.Slot = &id
+		case "token":
+			u.Token = value
+		case "object":
+			u.Object = value
+		case "id":
+			u.ID = []byte(value)
+		case "type":
+			if value != "private" {
+				return URI{}, fmt.Errorf("%s URI does not name a private key: type=%s", Scheme, value)
+			}
+		}
+	}
+	for _, attr := range splitAttrs(query, "&") {
+		name, raw, _ := strings.Cut(attr, "=")
+		if name != "module-path" {
+			continue
+		}
+		value, err := unescape(raw)
+		if err != nil {
+			return URI{}, fmt.Errorf("invalid %s URI attribute %s: %w", Scheme, name, err)
+		}
+		u.Module = value
+	}
+	if u.Object == "" && len(u.ID) == 0 {
+		return URI{}, fmt.Errorf("%s URI names no object or id", Scheme)
+	}
+	return u, nil
+}
+
+func splitAttrs(s, sep string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, sep)
+}
+
+// escape percent-encodes every byte that is not unreserved in RFC 3986, or
+// a slash, which RFC 7512 allows unencoded.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// unescape decodes percent-encoded bytes.
+func unescape(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", errors.New("truncated percent encoding")
+		}
+		n, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid percent encoding %q", s[i:i+3])
+		}
+		b.WriteByte(byte(n))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// describe names the token and key of u for error messages.
+func describe(u URI) string {
+	var parts []string
+	if u.Slot != nil {
+		parts = append(parts, fmt.Sprintf("slot %d", *u.Slot))
+	}
+	if u.Token != "" {
+		parts = append(parts, fmt.Sprintf("token %q", u.Token))
+	}
+	if u.Object != "" {
+		parts = append(parts, fmt.Sprintf("label %q", u.Object))
+	}
+	if len(u.ID) > 0 {
+		parts = append(parts, fmt.Sprintf("id %x", u.ID))
+	}
+	if len(parts) == 0 {
+		return "any token"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,49 @@
+package hsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestURI tests that a URI survives formatting and parsing.
+func TestURI(t *testing.T) {
+	slot := uint(3)
+	u := URI{
+		Module: "/usr/lib/softhsm/libsofthsm2.so",
+		Slot:   &slot,
+		Token:  "my token",
+		Object: "web;1",
+		ID:     []byte{0x01, 0xab},
+	}
+	s := u.String()
+	assert.Equal(t, "pkcs11:slot-id=3;token=my%20token;object=web%3B1;id=%01%AB;type=private?module-path=/usr/lib/softhsm/libsofthsm2.so", s)
+
+	got, err := ParseURI(s)
+	require.NoError(t, err)
+	assert.Equal(t, u, got)
+}
+
+// TestParseURI_Errors tests that malformed or unusable URIs are rejected.
+func TestParseURI_Errors(t *testing.T) {
+	tests := map[string]struct {
+		uri     string
+		wantErr string
+	}{
+		"other scheme":   {"file:///etc/key.pem", `not a pkcs11 URI`},
+		"public key":     {"pkcs11:object=web;type=public", `does not name a private key: type=public`},
+		"no object":      {"pkcs11:token=hsm", `names no object or id`},
+		"bad slot":       {"pkcs11:slot-id=x;object=web", `invalid pkcs11 URI slot-id "x"`},
+		"bad escape":     {"pkcs11:object=web%zz", `invalid percent encoding "%zz"`},
+		"truncated hex":  {"pkcs11:object=web%4", `truncated percent encoding`},
+		"bad module hex": {"pkcs11:object=web?module-path=%", `truncated percent encoding`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseURI(tt.uri)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package inspect
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+)
+
+// maxExtensionBytes limits how much of an unknown extension value is shown.
+const maxExtensionBytes = 32
+
+// Extension describes a certificate or requested CSR extension.
+type Extension struct {
+	OID      string `json:"oid"`
+	Name     string `json:"name,omitempty"` // RFC 5280 name, empty for unknown extensions
+	Critical bool   `json:"critical,omitempty"`
+	Value    string `json:"value"` // Decoded value, or hex for unknown extensions
+}
+
+// extensionNames maps well-known extension OIDs to their RFC names.
+var extensionNames = map[string]string{
+	"2.5.29.14":               "subjectKeyIdentifier",
+	"2.5.29.15":               "keyUsage",
+	"2.5.29.17":               "subjectAltName",
+	"2.5.29.19":               "basicConstraints",
+	"2.5.29.30":               "nameConstraints",
+	"2.5.29.31":               "cRLDistributionPoints",
+	"2.5.29.32":               "certificatePolicies",
+	"2.5.29.35":               "authorityKeyIdentifier",
+	"2.5.29.37":               "extKeyUsage",
+	"1.3.6.1.5.5.7.1.1":       "authorityInfoAccess",
+	"1.3.6.1.4.1.11129.2.4.2": "ctPrecertificateSCTs",
+}
+
+// describeExtension decodes ext for display. The SANs come from s; cert, when
+// set, supplies the parsed form of extensions only certificates carry.
+func describeExtension(ext pkix.Extension, s *Summary, cert *x509.Certificate) Extension {
+	oid := ext.Id.String()
+	e := Extension{OID: oid, Name: extensionNames[oid], Critical: ext.Critical}
+	value, ok := decodeExtension(oid, ext.Value, s, cert)
+	if !ok {
+		value = truncatedHex(ext.Value)
+	}
+	e.Value = value
+	return e
+}
+
+// decodeExtension returns the readable value of a known extension, and false
+// when the extension is unknown or malformed.
+func decodeExtension(oid string, value []byte, s *Summary, cert *x509.Certificate) (string, bool) {
+	switch extensionNames[oid] {
+	case "basicConstraints":
+		var bc struct {
+			IsCA       bool `asn1:"optional"`
+			MaxPathLen int  `asn1:"optional,default:-1"`
+		}
+		if rest, err := asn1.Unmarshal(value, &bc); err != nil || len(rest) > 0 {
+			return "", false
+		}
+		if !bc.IsCA {
+			return "CA:FALSE", true
+		}
+		if bc.MaxPathLen >= 0 {
+			return fmt.Sprintf("CA:TRUE, pathlen:%d", bc.MaxPathLen), true
+		}
+		return "CA:TRUE", true
+	case "keyUsage":
+		var bits asn1.BitString
+		if rest, err := asn1.Unmarshal(value, &bits); err != nil || len(rest) > 0 {
+			return "", false
+		}
+		var ku x509.KeyUsage
+		for i := 0; i < 9; i++ {
+			if bits.At(i) != 0 {
+				ku |= 1 << uint(i)
+			}
+		}
+		return strings.Join(certs.KeyUsageNames(ku), ", "), true
+	case "extKeyUsage":
+		var oids []asn1.ObjectIdentifier
+		if rest, err := asn1.Unmarshal(value, &oids); err != nil || len(rest) > 0 {
+			return "", false
+		}
+		names := make([]string, len(oids))
+		for i, o := range oids {
+			names[i] = certs.ExtKeyUsageName(o)
+		}
+		return strings.Join(names, ", "), true
+	case "subjectKeyIdentifier":
+		var id []byte
+		if rest, err := asn1.Unmarshal(value, &id); err != nil || len(rest) > 0 {
+			return "", false
+		}
+		return colonHex(id), true
+	case "authorityKeyIdentifier":
+		var aki struct {
+			ID []byte `asn1:"optional,tag:0"`
+		}
+		if _, err := asn1.Unmarshal(value, &aki); err != nil || aki.ID == nil {
+			return "", false
+		}
+		return "keyid:" + colonHex(aki.ID), true
+	case "subjectAltName":
+		var names []string
+		for _, n := range s.DNSNames {
+			names = append(names, "DNS:"+n)
+		}
+		for _, n := range s.IPAddresses {
+			names = append(names, "IP:"+n)
+		}
+		for _, n := range s.EmailAddresses {
+			names = append(names, "email:"+n)
+		}
+		for _, n := range s.URIs {
+			names = append(names, "URI:"+n)
+		}
+		return strings.Join(names, ", "), len(names) > 0
+	}
+
+	if cert == nil {
+		return "", false
+	}
+	switch extensionNames[oid] {
+	case "cRLDistributionPoints":
+		return strings.Join(cert.CRLDistributionPoints, ", "), len(cert.CRLDistributionPoints) > 0
+	case "authorityInfoAccess":
+		var parts []string
+		for _, u := range cert.OCSPServer {
+			parts = append(parts, "OCSP:"+u)
+		}
+		for _, u := range cert.IssuingCertificateURL {
+			parts = append(parts, "CA Issuers:"+u)
+		}
+		return strings.Join(parts, ", "), len(parts) > 0
+	case "certificatePolicies":
+		policies := stringify(cert.Policies)
+		return strings.Join(policies, ", "), len(policies) > 0
+	}
+	return "", false
+}
+
+// truncatedHex formats an undecoded value, shortened when it is long.
+func truncatedHex(value []byte) string {
+	if len(value) > maxExtensionBytes {
+		return colonHex(value[:maxExtensionBytes]) + fmt.Sprintf("... (%d bytes)", len(value))
+	}
+	return colonHex(value)
+}
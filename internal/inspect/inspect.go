@@ -0,0 +1,442 @@
+package inspect
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/keys"
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Summary describes a single decoded key, CSR or certificate.
+type Summary struct {
+	File               string        `json:"file,omitempty"` // Set by callers inspecting several files
+	Type               string        `json:"type"`
+	Encoding           string        `json:"encoding"` // PEM, DER or PKCS#12
+	Subject            string        `json:"subject,omitempty"`
+	Issuer             string        `json:"issuer,omitempty"`
+	Serial             string        `json:"serial,omitempty"`
+	NotBefore          *time.Time    `json:"not_before,omitempty"`
+	NotAfter           *time.Time    `json:"not_after,omitempty"`
+	DNSNames           []string      `json:"dns_names,omitempty"`
+	IPAddresses        []string      `json:"ip_addresses,omitempty"`
+	EmailAddresses     []string      `json:"email_addresses,omitempty"`
+	URIs               []string      `json:"uris,omitempty"`
+	KeyAlgorithm       string        `json:"key_algorithm,omitempty"`
+	KeySize            int           `json:"key_size,omitempty"` // Bits of the RSA modulus or elliptic curve
+	Curve              string        `json:"curve,omitempty"`
+	Encrypted          bool          `json:"encrypted,omitempty"` // Private key was stored encrypted
+	SignatureAlgorithm string        `json:"signature_algorithm,omitempty"`
+	SignatureValid     *bool         `json:"signature_valid,omitempty"` // Unset for certificates whose issuer is not in the input
+	Fingerprints       *Fingerprints `json:"fingerprints,omitempty"`
+	Extensions         []Extension   `json:"extensions,omitempty"`
+
+	cert *x509.Certificate // Parsed certificate, for checking signatures within the input
+}
+
+// Fingerprints holds digests identifying an object. The public key digest is
+// the same for a key, its CSRs and its certificates.
+type Fingerprints struct {
+	SHA1      string `json:"sha1,omitempty"`   // SHA-1 of the DER encoding
+	SHA256    string `json:"sha256,omitempty"` // SHA-256 of the DER encoding
+	PublicKey string `json:"public_key"`       // SHA-256 of the DER SubjectPublicKeyInfo
+}
+
+// Inspect detects whether data holds PEM blocks, DER or a PKCS#12 bundle and
+// summarizes every key, CSR and certificate in it. The password decrypts
+// PKCS#12 bundles and encrypted private keys.
+func Inspect(data []byte, password string) ([]Summary, error) {
+	var summaries []Summary
+	var err error
+	switch {
+	case bytes.Contains(data, []byte("-----BEGIN ")):
+		summaries, err = inspectPEM(data, password)
+	default:
+		summaries, err = inspectDER(data, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+	checkSignatures(summaries)
+	return summaries, nil
+}
+
+// inspectPEM summarizes every PEM block in data.
+func inspectPEM(data []byte, password string) ([]Summary, error) {
+	var summaries []Summary
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		s, err := inspectBlock(block, password)
+		if err != nil {
+			return nil, err
+		}
+		s.Encoding = "PEM"
+		summaries = append(summaries, s)
+	}
+	if len(summaries) == 0 {
+		return nil, errors.New("no PEM data found")
+	}
+	return summaries, nil
+}
+
+// inspectBlock summarizes a single PEM block.
+func inspectBlock(block *pem.Block, password string) (Summary, error) {
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return Summary{}, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		return certificateSummary(cert), nil
+	case "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST":
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			return Summary{}, fmt.Errorf("failed to parse CSR: %w", err)
+		}
+		return requestSummary(csr), nil
+	case "PRIVATE KEY":
+		key, err := parsePrivateKey(block.Bytes)
+		if err != nil {
+			return Summary{}, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		return privateKeySummary(key)
+	case "RSA PRIVATE KEY", "EC PRIVATE KEY", "OPENSSH PRIVATE KEY":
+		// These may carry legacy OpenSSL or OpenSSH encryption
+		data := pem.EncodeToMemory(block)
+		encrypted := keys.IsEncrypted(data)
+		if encrypted && password == "" {
+			return Summary{Type: "encrypted private key"}, nil
+		}
+		key, err := keys.ParsePrivateKey(data, password)
+		if err != nil {
+			return Summary{}, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		s, err := privateKeySummary(key)
+		s.Encrypted = encrypted
+		return s, err
+	case "ENCRYPTED PRIVATE KEY":
+		if password == "" {
+			return Summary{Type: "encrypted private key"}, nil
+		}
+		key, _, err := pkcs8.ParsePrivateKey(block.Bytes, []byte(password))
+		if err != nil {
+			return Summary{}, fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+		s, err := privateKeySummary(key)
+		s.Encrypted = true
+		return s, err
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Summary{}, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		s := Summary{Type: "public key"}
+		err = describeKey(&s, pub)
+		return s, err
+	default:
+		return Summary{}, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+}
+
+// inspectDER summarizes binary data: one or more DER certificates, a CSR, a
+// private or public key, or a PKCS#12 bundle.
+func inspectDER(data []byte, password string) ([]Summary, error) {
+	if len(data) == 0 {
+		return nil, errors.New("no data found")
+	}
+	if chain, err := x509.ParseCertificates(data); err == nil && len(chain) > 0 {
+		var summaries []Summary
+		for _, cert := range chain {
+			summaries = append(summaries, der(certificateSummary(cert)))
+		}
+		return summaries, nil
+	}
+	if csr, err := x509.ParseCertificateRequest(data); err == nil {
+		return []Summary{der(requestSummary(csr))}, nil
+	}
+	if key, err := parsePrivateKey(data); err == nil {
+		s, err := privateKeySummary(key)
+		return []Summary{der(s)}, err
+	}
+	if pub, err := x509.ParsePKIXPublicKey(data); err == nil {
+		s := Summary{Type: "public key", Encoding: "DER"}
+		err = describeKey(&s, pub)
+		return []Summary{s}, err
+	}
+
+	summaries, err := inspectPKCS12(data, password)
+	switch {
+	case errors.Is(err, pkcs12.ErrIncorrectPassword) && password == "":
+		return nil, errors.New("PKCS#12 bundle is password protected, a password is required")
+	case errors.Is(err, pkcs12.ErrIncorrectPassword):
+		return nil, errors.New("incorrect PKCS#12 password")
+	case err != nil:
+		return nil, errors.New("unrecognized data: not PEM, DER or PKCS#12")
+	}
+	for i := range summaries {
+		summaries[i].Encoding = "PKCS#12"
+	}
+	return summaries, nil
+}
+
+// inspectPKCS12 summarizes the key and certificates of a PKCS#12 bundle, or
+// the certificates of a trust store without a key.
+func inspectPKCS12(data []byte, password string) ([]Summary, error) {
+	var summaries []Summary
+	key, cert, chain, err := pkcs12.DecodeChain(data, password)
+	if err == nil {
+		s, err := privateKeySummary(key)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+		chain = append([]*x509.Certificate{cert}, chain...)
+	} else if chain, err = pkcs12.DecodeTrustStore(data, password); err != nil {
+		return nil, err
+	}
+	for _, c := range chain {
+		summaries = append(summaries, certificateSummary(c))
+	}
+	return summaries, nil
+}
+
+// der marks a summary as read from DER.
+func der(s Summary) Summary {
+	s.Encoding = "DER"
+	return s
+}
+
+// parsePrivateKey parses an unencrypted PKCS#8, PKCS#1 or SEC 1 private key.
+func parsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(data); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(data); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("not a PKCS#8, PKCS#1 or SEC 1 private key")
+}
+
+func certificateSummary(cert *x509.Certificate) Summary {
+	s := Summary{
+		Type:               "certificate",
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		Serial:             cert.SerialNumber.String(),
+		NotBefore:          &cert.NotBefore,
+		NotAfter:           &cert.NotAfter,
+		DNSNames:           cert.DNSNames,
+		IPAddresses:        stringify(cert.IPAddresses),
+		EmailAddresses:     cert.EmailAddresses,
+		URIs:               stringify(cert.URIs),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		Fingerprints:       &Fingerprints{SHA1: sha1Hex(cert.Raw), SHA256: sha256Hex(cert.Raw)},
+		cert:               cert,
+	}
+	_ = describeKey(&s, cert.PublicKey) // The key was parsed with the certificate, so it is supported
+	s.KeyAlgorithm = cert.PublicKeyAlgorithm.String()
+	for _, ext := range cert.Extensions {
+		s.Extensions = append(s.Extensions, describeExtension(ext, &s, cert))
+	}
+	return s
+}
+
+func requestSummary(csr *x509.CertificateRequest) Summary {
+	valid := csr.CheckSignature() == nil
+	s := Summary{
+		Type:               "certificate request",
+		Subject:            csr.Subject.String(),
+		DNSNames:           csr.DNSNames,
+		IPAddresses:        stringify(csr.IPAddresses),
+		EmailAddresses:     csr.EmailAddresses,
+		URIs:               stringify(csr.URIs),
+		SignatureAlgorithm: csr.SignatureAlgorithm.String(),
+		SignatureValid:     &valid,
+		Fingerprints:       &Fingerprints{SHA1: sha1Hex(csr.Raw), SHA256: sha256Hex(csr.Raw)},
+	}
+	_ = describeKey(&s, csr.PublicKey) // The key was parsed with the CSR, so it is supported
+	s.KeyAlgorithm = csr.PublicKeyAlgorithm.String()
+	for _, ext := range csr.Extensions {
+		s.Extensions = append(s.Extensions, describeExtension(ext, &s, nil))
+	}
+	return s
+}
+
+func privateKeySummary(key crypto.PrivateKey) (Summary, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return Summary{}, fmt.Errorf("unsupported private key type %T", key)
+	}
+	s := Summary{Type: "private key"}
+	err := describeKey(&s, signer.Public())
+	return s, err
+}
+
+// describeKey fills in the algorithm, size and public key fingerprint of pub.
+func describeKey(s *Summary, pub crypto.PublicKey) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		s.KeyAlgorithm, s.KeySize = x509.RSA.String(), k.N.BitLen()
+	case *ecdsa.PublicKey:
+		s.KeyAlgorithm, s.KeySize, s.Curve = x509.ECDSA.String(), k.Curve.Params().BitSize, k.Curve.Params().Name
+	case ed25519.PublicKey:
+		s.KeyAlgorithm, s.KeySize = x509.Ed25519.String(), 256
+	default:
+		s.KeyAlgorithm = x509.UnknownPublicKeyAlgorithm.String()
+		return nil
+	}
+	spki, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return fmt.Errorf("failed to encode public key: %w", err)
+	}
+	if s.Fingerprints == nil {
+		s.Fingerprints = &Fingerprints{}
+	}
+	s.Fingerprints.PublicKey = sha256Hex(spki)
+	return nil
+}
+
+// checkSignatures sets SignatureValid on each certificate whose issuer, or
+// itself when self-signed, is among the summarized certificates.
+func checkSignatures(summaries []Summary) {
+	for i := range summaries {
+		cert := summaries[i].cert
+		if cert == nil {
+			continue
+		}
+		for _, s := range summaries {
+			if s.cert == nil || !bytes.Equal(s.cert.RawSubject, cert.RawIssuer) {
+				continue
+			}
+			valid := s.cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+			summaries[i].SignatureValid = &valid
+			if valid {
+				break
+			}
+		}
+	}
+}
+
+// WriteText writes a human-readable rendering of the summaries to w.
+func WriteText(w io.Writer, summaries []Summary) error {
+	for i, s := range summaries {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Type:            %s\n", s.Type)
+		writeField(w, "Encoding", s.Encoding)
+		writeField(w, "Subject", s.Subject)
+		writeField(w, "Issuer", s.Issuer)
+		writeField(w, "Serial", s.Serial)
+		if s.NotBefore != nil {
+			writeField(w, "Not Before", s.NotBefore.UTC().Format(time.RFC3339))
+		}
+		if s.NotAfter != nil {
+			writeField(w, "Not After", s.NotAfter.UTC().Format(time.RFC3339))
+		}
+		writeField(w, "DNS Names", strings.Join(s.DNSNames, ", "))
+		writeField(w, "IP Addresses", strings.Join(s.IPAddresses, ", "))
+		writeField(w, "Email Addresses", strings.Join(s.EmailAddresses, ", "))
+		writeField(w, "URIs", strings.Join(s.URIs, ", "))
+		writeField(w, "Key Algorithm", s.KeyAlgorithm)
+		switch {
+		case s.Curve != "":
+			writeField(w, "Key Size", fmt.Sprintf("%d bits (%s)", s.KeySize, s.Curve))
+		case s.KeySize > 0:
+			writeField(w, "Key Size", fmt.Sprintf("%d bits", s.KeySize))
+		}
+		if s.Encrypted {
+			writeField(w, "Encrypted", "true")
+		}
+		writeField(w, "Signature", s.SignatureAlgorithm)
+		if s.SignatureValid != nil {
+			writeField(w, "Signature Valid", fmt.Sprint(*s.SignatureValid))
+		}
+		if f := s.Fingerprints; f != nil {
+			writeField(w, "SHA-1", f.SHA1)
+			writeField(w, "SHA-256", f.SHA256)
+			writeField(w, "Public Key", f.PublicKey)
+		}
+		if len(s.Extensions) > 0 {
+			fmt.Fprintln(w, "Extensions:")
+			for _, ext := range s.Extensions {
+				name := ext.Name
+				if name == "" {
+					name = ext.OID
+				}
+				if ext.Critical {
+					name += " (critical)"
+				}
+				fmt.Fprintf(w, "  %s: %s\n", name, ext.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the summaries to w as an indented JSON array.
+func WriteJSON(w io.Writer, summaries []Summary) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(summaries)
+}
+
+// writeField writes a labelled line, skipping empty values.
+func writeField(w io.Writer, label, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(w, "%-16s %s\n", label+":", value)
+}
+
+// sha1Hex returns the SHA-1 digest of data as colon-separated hex.
+func sha1Hex(data []byte) string {
+	sum := sha1.Sum(data)
+	return colonHex(sum[:])
+}
+
+// sha256Hex returns the SHA-256 digest of data as colon-separated hex.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return colonHex(sum[:])
+}
+
+// colonHex formats data as upper-case hex bytes separated by colons, as openssl does.
+func colonHex(data []byte) string {
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = strings.ToUpper(hex.EncodeToString([]byte{b}))
+	}
+	return strings.Join(parts, ":")
+}
+
+// stringify converts a slice of fmt.Stringer values to strings.
+func stringify[T fmt.Stringer](values []T) []string {
+	var out []string
+	for _, v := range values {
+		out = append(out, v.String())
+	}
+	return out
+}
@@ -0,0 +1,256 @@
+package inspect
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// TestInspect tests summarizing a key, CSR and certificate from one PEM file.
+func TestInspect(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate key")
+
+	keyPem, err := keys.SerializePrivateKey(key, "")
+	require.NoError(t, err, "failed to serialize key")
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "test.com"},
+		DNSNames: []string{"test.com"},
+	}, key)
+	require.NoError(t, err, "failed to create CSR")
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "test.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err, "failed to create certificate")
+
+	data := append([]byte{}, keyPem...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})...)
+
+	summaries, err := Inspect(data, "")
+	require.NoError(t, err, "Inspect should not return an error")
+	require.Len(t, summaries, 3, "Expected one summary per PEM block")
+
+	assert.Equal(t, "private key", summaries[0].Type)
+	assert.Equal(t, "ECDSA", summaries[0].KeyAlgorithm)
+
+	assert.Equal(t, "certificate request", summaries[1].Type)
+	assert.Equal(t, "CN=test.com", summaries[1].Subject)
+	assert.Equal(t, []string{"test.com"}, summaries[1].DNSNames)
+	require.NotNil(t, summaries[1].SignatureValid)
+	assert.True(t, *summaries[1].SignatureValid, "CSR signature should be valid")
+
+	assert.Equal(t, "certificate", summaries[2].Type)
+	assert.Equal(t, "7", summaries[2].Serial)
+	require.NotNil(t, summaries[2].SignatureValid, "A self-signed certificate is its own issuer")
+	assert.True(t, *summaries[2].SignatureValid)
+
+	for _, s := range summaries {
+		assert.Equal(t, "PEM", s.Encoding)
+		assert.Equal(t, 256, s.KeySize)
+		assert.Equal(t, "P-256", s.Curve)
+		assert.Equal(t, summaries[0].Fingerprints.PublicKey, s.Fingerprints.PublicKey, "Key, CSR and certificate should share the public key fingerprint")
+	}
+	sum := sha256.Sum256(certDER)
+	assert.Equal(t, colonHex(sum[:]), summaries[2].Fingerprints.SHA256)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteText(&buf, summaries))
+	assert.Contains(t, buf.String(), "Subject:         CN=test.com")
+	assert.Contains(t, buf.String(), "Signature Valid: true")
+}
+
+// TestInspect_NoPEM tests that input that is not PEM, DER or PKCS#12 is rejected.
+func TestInspect_NoPEM(t *testing.T) {
+	_, err := Inspect([]byte("garbage"), "")
+	assert.EqualError(t, err, "unrecognized data: not PEM, DER or PKCS#12", "Expected specific error message")
+	_, err = Inspect([]byte("-----BEGIN garbage"), "")
+	assert.EqualError(t, err, "no PEM data found", "Expected specific error message")
+}
+
+// newCertificate creates a certificate from tmpl for key, signed by parent
+// and parentKey, or self-signed when parent is nil.
+func newCertificate(t *testing.T, tmpl *x509.Certificate, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+	t.Helper()
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err, "failed to create certificate")
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err, "failed to parse certificate")
+	return cert
+}
+
+// testChain returns a leaf with common extensions, its issuing root and the leaf key.
+func testChain(t *testing.T) (leaf, root *x509.Certificate, leafKey *ecdsa.PrivateKey) {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate key")
+	leafKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err, "failed to generate key")
+
+	root = newCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLen:            0,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, rootKey, nil, nil)
+	leaf = newCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "test.com"},
+		DNSNames:              []string{"test.com"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		CRLDistributionPoints: []string{"http://crl.example.com/root.crl"},
+		OCSPServer:            []string{"http://ocsp.example.com"},
+	}, leafKey, root, rootKey)
+	return leaf, root, leafKey
+}
+
+// TestInspect_Extensions tests decoding certificate extensions and checking
+// signatures against an issuer in the same input.
+func TestInspect_Extensions(t *testing.T) {
+	leaf, root, _ := testChain(t)
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})...)
+
+	summaries, err := Inspect(data, "")
+	require.NoError(t, err, "Inspect should not return an error")
+	require.Len(t, summaries, 2)
+	require.NotNil(t, summaries[0].SignatureValid, "The leaf issuer is in the input")
+	assert.True(t, *summaries[0].SignatureValid)
+	assert.Equal(t, 384, summaries[0].KeySize)
+	assert.Equal(t, "ECDSA-SHA256", summaries[0].SignatureAlgorithm)
+
+	values := make(map[string]string)
+	for _, ext := range summaries[0].Extensions {
+		values[ext.Name] = ext.Value
+	}
+	assert.Equal(t, "digital_signature", values["keyUsage"])
+	assert.Equal(t, "server_auth, client_auth", values["extKeyUsage"])
+	assert.Equal(t, "CA:FALSE", values["basicConstraints"])
+	assert.Equal(t, "DNS:test.com", values["subjectAltName"])
+	assert.Equal(t, "http://crl.example.com/root.crl", values["cRLDistributionPoints"])
+	assert.Equal(t, "OCSP:http://ocsp.example.com", values["authorityInfoAccess"])
+	assert.Equal(t, "keyid:"+colonHex(root.SubjectKeyId), values["authorityKeyIdentifier"])
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteText(&buf, summaries))
+	assert.Contains(t, buf.String(), "  keyUsage (critical): digital_signature\n")
+	assert.Contains(t, buf.String(), "  basicConstraints (critical): CA:TRUE, pathlen:0\n")
+}
+
+// TestInspect_DER tests detecting DER certificates, CSRs and keys.
+func TestInspect_DER(t *testing.T) {
+	leaf, root, leafKey := testChain(t)
+	summaries, err := Inspect(append(append([]byte{}, leaf.Raw...), root.Raw...), "")
+	require.NoError(t, err, "Inspect should read a DER chain")
+	require.Len(t, summaries, 2)
+	assert.Equal(t, "certificate", summaries[1].Type)
+	assert.Equal(t, "DER", summaries[1].Encoding)
+	assert.Equal(t, "CN=Test Root", summaries[1].Subject)
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "test.com"}}, leafKey)
+	require.NoError(t, err, "failed to create CSR")
+	summaries, err = Inspect(csrDER, "")
+	require.NoError(t, err, "Inspect should read a DER CSR")
+	assert.Equal(t, "certificate request", summaries[0].Type)
+
+	keyDER, err := x509.MarshalECPrivateKey(leafKey)
+	require.NoError(t, err, "failed to marshal key")
+	summaries, err = Inspect(keyDER, "")
+	require.NoError(t, err, "Inspect should read a DER SEC 1 key")
+	assert.Equal(t, "private key", summaries[0].Type)
+	assert.Equal(t, "P-384", summaries[0].Curve)
+}
+
+// TestInspect_PKCS12 tests reading a password-protected PKCS#12 bundle.
+func TestInspect_PKCS12(t *testing.T) {
+	leaf, root, leafKey := testChain(t)
+	data, err := pkcs12.Modern.Encode(leafKey, leaf, []*x509.Certificate{root}, "changeit")
+	require.NoError(t, err, "failed to encode PKCS#12")
+
+	summaries, err := Inspect(data, "changeit")
+	require.NoError(t, err, "Inspect should decode the bundle")
+	require.Len(t, summaries, 3, "Expected the key, leaf and chain")
+	assert.Equal(t, []string{"private key", "certificate", "certificate"}, []string{summaries[0].Type, summaries[1].Type, summaries[2].Type})
+	assert.Equal(t, "PKCS#12", summaries[1].Encoding)
+	assert.Equal(t, summaries[0].Fingerprints.PublicKey, summaries[1].Fingerprints.PublicKey)
+
+	_, err = Inspect(data, "")
+	assert.EqualError(t, err, "PKCS#12 bundle is password protected, a password is required")
+	_, err = Inspect(data, "wrong")
+	assert.EqualError(t, err, "incorrect PKCS#12 password")
+}
+
+// TestInspect_EncryptedKey tests decrypting an encrypted PKCS#8 key.
+func TestInspect_EncryptedKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "failed to generate key")
+
+	for _, format := range []string{keys.FormatPKCS8, keys.FormatOpenSSH} {
+		t.Run(format, func(t *testing.T) {
+			keyPem, err := keys.EncodePrivateKey(key, format, "secret", keys.EncryptionOptions{Iterations: 1000})
+			require.NoError(t, err, "failed to serialize key")
+
+			summaries, err := Inspect(keyPem, "")
+			require.NoError(t, err)
+			assert.Equal(t, "encrypted private key", summaries[0].Type, "Without a password only the type is known")
+
+			summaries, err = Inspect(keyPem, "secret")
+			require.NoError(t, err)
+			assert.Equal(t, "private key", summaries[0].Type)
+			assert.True(t, summaries[0].Encrypted)
+			assert.Equal(t, 2048, summaries[0].KeySize)
+		})
+	}
+}
+
+// TestWriteJSON tests the JSON rendering of summaries.
+func TestWriteJSON(t *testing.T) {
+	leaf, _, _ := testChain(t)
+	summaries, err := Inspect(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}), "")
+	require.NoError(t, err)
+	summaries[0].File = "leaf.pem"
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteJSON(&buf, summaries))
+	var got []map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got), "Output should be a JSON array")
+	require.Len(t, got, 1)
+	assert.Equal(t, "leaf.pem", got[0]["file"])
+	assert.Equal(t, "CN=test.com", got[0]["subject"])
+	assert.NotContains(t, got[0], "signature_valid", "The issuer is not in the input")
+	assert.Contains(t, got[0]["fingerprints"], "sha256")
+	assert.NotEmpty(t, got[0]["extensions"])
+}
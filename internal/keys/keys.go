@@ -2,13 +2,20 @@ package keys
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
 	"encoding/pem"
 	"errors"
+	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/youmark/pkcs8"
+	"golang.org/x/crypto/ssh"
 )
 
 // GenerateEd25519Key generates a new ed25519 private key.
@@ -25,13 +32,118 @@ func GenerateRSAKey(bits int) (*rsa.PrivateKey, error) {
 	return rsa.GenerateKey(rand.Reader, bits)
 }
 
+// GenerateECDSAKey generates a new ECDSA private key on the named curve.
+// Supported curves are P-256, P-384 and P-521; an empty name selects P-256.
+func GenerateECDSAKey(curve string) (*ecdsa.PrivateKey, error) {
+	c, err := ECDSACurve(curve)
+	if err != nil {
+		return nil, err
+	}
+	return ecdsa.GenerateKey(c, rand.Reader)
+}
+
+// ECDSACurve returns the elliptic curve for the given name.
+func ECDSACurve(name string) (elliptic.Curve, error) {
+	switch name {
+	case "", "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported ECDSA curve: %s", name)
+	}
+}
+
+// DefaultIterations is the PBKDF2 iteration count used when none is set, as
+// recommended by OWASP for PBKDF2-HMAC-SHA256.
+const DefaultIterations = 600000
+
+// Default scrypt cost parameters, as recommended by RFC 7914.
+const (
+	DefaultScryptN = 1 << 15
+	DefaultScryptR = 8
+	DefaultScryptP = 1
+)
+
+// ciphers maps the supported PBES2 cipher names to their implementations.
+var ciphers = map[string]pkcs8.Cipher{
+	"aes-128-cbc": pkcs8.AES128CBC,
+	"aes-192-cbc": pkcs8.AES192CBC,
+	"aes-256-cbc": pkcs8.AES256CBC,
+	"aes-128-gcm": pkcs8.AES128GCM,
+	"aes-192-gcm": pkcs8.AES192GCM,
+	"aes-256-gcm": pkcs8.AES256GCM,
+}
+
+// EncryptionOptions selects how an encrypted PKCS#8 key is protected. Zero
+// values select aes-256-cbc with PBKDF2 and the default cost parameters.
+type EncryptionOptions struct {
+	Cipher     string // One of aes-{128,192,256}-{cbc,gcm}
+	KDF        string // pbkdf2 or scrypt
+	Iterations int    // PBKDF2 iteration count
+	ScryptN    int    // scrypt CPU/memory cost
+	ScryptR    int    // scrypt block size
+	ScryptP    int    // scrypt parallelization
+}
+
+// pkcs8Opts converts o to the options of the pkcs8 package.
+func (o EncryptionOptions) pkcs8Opts() (*pkcs8.Opts, error) {
+	name := o.Cipher
+	if name == "" {
+		name = "aes-256-cbc"
+	}
+	c, ok := ciphers[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported key encryption cipher: %s", name)
+	}
+	opts := &pkcs8.Opts{Cipher: c}
+	switch o.KDF {
+	case "", "pbkdf2":
+		opts.KDFOpts = pkcs8.PBKDF2Opts{
+			SaltSize:       16,
+			IterationCount: orDefault(o.Iterations, DefaultIterations),
+			HMACHash:       crypto.SHA256,
+		}
+	case "scrypt":
+		opts.KDFOpts = pkcs8.ScryptOpts{
+			SaltSize:                 16,
+			CostParameter:            orDefault(o.ScryptN, DefaultScryptN),
+			BlockSize:                orDefault(o.ScryptR, DefaultScryptR),
+			ParallelizationParameter: orDefault(o.ScryptP, DefaultScryptP),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key derivation function: %s", o.KDF)
+	}
+	return opts, nil
+}
+
+func orDefault(n, def int) int {
+	if n == 0 {
+		return def
+	}
+	return n
+}
+
 // SerializePrivateKey serializes the private key to PEM format, optionally encrypted with a password.
 func SerializePrivateKey(key crypto.PrivateKey, password string) ([]byte, error) {
+	return SerializeEncryptedPrivateKey(key, password, EncryptionOptions{})
+}
+
+// SerializeEncryptedPrivateKey serializes the private key to PEM format. When
+// password is set the key is encrypted as PBES2 with the given options.
+func SerializeEncryptedPrivateKey(key crypto.PrivateKey, password string, enc EncryptionOptions) ([]byte, error) {
 	var pass []byte
+	var opts *pkcs8.Opts
 	if password != "" {
 		pass = []byte(password)
+		var err error
+		if opts, err = enc.pkcs8Opts(); err != nil {
+			return nil, err
+		}
 	}
-	der, err := pkcs8.MarshalPrivateKey(key, pass, nil)
+	der, err := pkcs8.MarshalPrivateKey(key, pass, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -46,23 +158,165 @@ func SerializePrivateKey(key crypto.PrivateKey, password string) ([]byte, error)
 	return pem.EncodeToMemory(pemBlock), nil
 }
 
-// ParsePrivateKey parses a PEM-encoded private key, optionally decrypting it with a password.
+// Private key encodings accepted by EncodePrivateKey.
+const (
+	FormatPKCS8   = "pkcs8"   // PRIVATE KEY, any key type
+	FormatPKCS1   = "pkcs1"   // RSA PRIVATE KEY
+	FormatSEC1    = "sec1"    // EC PRIVATE KEY
+	FormatOpenSSH = "openssh" // OPENSSH PRIVATE KEY
+)
+
+// EncodePrivateKey serializes the private key to PEM in format; an empty
+// format selects PKCS#8. A password encrypts PKCS#8 keys as PBES2 with enc and
+// OpenSSH keys with bcrypt and AES-256-CTR. PKCS#1 and SEC1 keys are written
+// unencrypted only, as their PEM encryption is obsolete.
+func EncodePrivateKey(key crypto.PrivateKey, format, password string, enc EncryptionOptions) ([]byte, error) {
+	var block *pem.Block
+	switch format {
+	case "", FormatPKCS8:
+		return SerializeEncryptedPrivateKey(key, password, enc)
+	case FormatPKCS1:
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("pkcs1 format only supports RSA keys")
+		}
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}
+	case FormatSEC1:
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("sec1 format only supports ECDSA keys")
+		}
+		der, err := x509.MarshalECPrivateKey(ecKey)
+		if err != nil {
+			return nil, err
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	case FormatOpenSSH:
+		var err error
+		if password != "" {
+			block, err = ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(password))
+		} else {
+			block, err = ssh.MarshalPrivateKey(key, "")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(block), nil
+	default:
+		return nil, fmt.Errorf("unsupported private key format: %s", format)
+	}
+	if password != "" {
+		return nil, fmt.Errorf("%s keys cannot be encrypted, use pkcs8 or openssh", format)
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// errPassphraseRequired is returned when an encrypted key is parsed without a password.
+var errPassphraseRequired = errors.New("private key is encrypted, a passphrase is required")
+
+// privateKeyBlock returns the first PEM block of pemData, skipping the EC
+// PARAMETERS block that openssl ecparam writes before the key.
+func privateKeyBlock(pemData []byte) *pem.Block {
+	for {
+		var block *pem.Block
+		block, pemData = pem.Decode(pemData)
+		if block == nil || block.Type != "EC PARAMETERS" {
+			return block
+		}
+	}
+}
+
+// IsEncrypted reports whether pemData holds an encrypted private key.
+func IsEncrypted(pemData []byte) bool {
+	block := privateKeyBlock(pemData)
+	switch {
+	case block == nil:
+		return false
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		return true
+	case block.Type == "OPENSSH PRIVATE KEY":
+		_, err := ssh.ParseRawPrivateKey(pem.EncodeToMemory(block))
+		var missing *ssh.PassphraseMissingError
+		return errors.As(err, &missing)
+	default:
+		return x509.IsEncryptedPEMBlock(block)
+	}
+}
+
+// ParsePrivateKey parses a PEM-encoded private key in PKCS#8, PKCS#1, SEC1 or
+// OpenSSH form. Encrypted keys, including legacy OpenSSL-encrypted PKCS#1 and
+// SEC1 keys, are decrypted with password; it is ignored for unencrypted keys.
 func ParsePrivateKey(pemData []byte, password string) (crypto.PrivateKey, error) {
-	block, _ := pem.Decode(pemData)
+	block := privateKeyBlock(pemData)
 	if block == nil {
 		return nil, errors.New("failed to decode PEM block")
 	}
-	var pass []byte
-	if password != "" {
-		pass = []byte(password)
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		if password == "" {
+			return nil, errPassphraseRequired
+		}
+		key, _, err := pkcs8.ParsePrivateKey(block.Bytes, []byte(password))
+		return key, err
+	case "RSA PRIVATE KEY", "EC PRIVATE KEY":
+		der := block.Bytes
+		// Legacy OpenSSL PEM encryption is read for existing keys but never written
+		if x509.IsEncryptedPEMBlock(block) {
+			if password == "" {
+				return nil, errPassphraseRequired
+			}
+			var err error
+			der, err = x509.DecryptPEMBlock(block, []byte(password))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+			}
+		}
+		if block.Type == "RSA PRIVATE KEY" {
+			return x509.ParsePKCS1PrivateKey(der)
+		}
+		return x509.ParseECPrivateKey(der)
+	case "OPENSSH PRIVATE KEY":
+		data := pem.EncodeToMemory(block)
+		key, err := ssh.ParseRawPrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			if password == "" {
+				return nil, errPassphraseRequired
+			}
+			key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, []byte(password))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if k, ok := key.(*ed25519.PrivateKey); ok {
+			// x/crypto/ssh returns a pointer, the rest of hephaestus uses the value
+			return *k, nil
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
 	}
-	key, _, err := pkcs8.ParsePrivateKey(block.Bytes, pass)
-	if err != nil {
-		return nil, err
+}
+
+// Reference is implemented by private keys that cannot be exported, such as
+// keys kept in an HSM. They are saved as their URI instead of as PEM.
+type Reference interface {
+	crypto.Signer
+	URI() string
+}
+
+// ReferenceScheme returns the URI scheme when data holds a saved key
+// reference rather than PEM, as in "pkcs11:token=...".
+func ReferenceScheme(data []byte) (string, bool) {
+	text := strings.TrimSpace(string(data))
+	if text == "" || strings.ContainsAny(text, "\n ") {
+		return "", false
 	}
-	privKey, ok := key.(crypto.PrivateKey)
-	if !ok {
-		return nil, errors.New("parsed key is not a crypto.PrivateKey")
+	u, err := url.Parse(text)
+	if err != nil || u.Scheme == "" {
+		return "", false
 	}
-	return privKey, nil
+	return u.Scheme, true
 }
@@ -1,8 +1,14 @@
 package keys
 
 import (
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -31,6 +37,26 @@ func TestGenerateRSAKey(t *testing.T) {
 	assert.EqualError(t, err, "RSA key size must be at least 2048 bits", "Expected specific error message")
 }
 
+// TestGenerateECDSAKey tests the generation of ECDSA private keys on each supported curve.
+func TestGenerateECDSAKey(t *testing.T) {
+	curves := map[string]elliptic.Curve{
+		"":      elliptic.P256(),
+		"P-256": elliptic.P256(),
+		"P-384": elliptic.P384(),
+		"P-521": elliptic.P521(),
+	}
+	for name, curve := range curves {
+		privKey, err := GenerateECDSAKey(name)
+		require.NoError(t, err, "Expected no error when generating ECDSA key on curve %q", name)
+		assert.IsType(t, &ecdsa.PrivateKey{}, privKey, "Expected an ECDSA private key")
+		assert.Equal(t, curve, privKey.Curve, "Expected curve to match for %q", name)
+	}
+
+	// Test with unsupported curve
+	_, err := GenerateECDSAKey("P-224")
+	assert.EqualError(t, err, "unsupported ECDSA curve: P-224", "Expected specific error message")
+}
+
 // TestSerializePrivateKey tests the serialization of private keys, both unencrypted and encrypted.
 func TestSerializePrivateKey(t *testing.T) {
 	// Generate an Ed25519 key for testing
@@ -76,3 +102,141 @@ func TestParsePrivateKey(t *testing.T) {
 	_, err = ParsePrivateKey(pemData, "wrong")
 	assert.Error(t, err, "Expected an error when parsing with incorrect password")
 }
+
+// TestParsePrivateKey_ECDSA tests a serialize/parse round trip for an ECDSA key.
+func TestParsePrivateKey_ECDSA(t *testing.T) {
+	privKey, err := GenerateECDSAKey("P-384")
+	require.NoError(t, err, "Failed to generate ECDSA key for testing")
+
+	pemData, err := SerializePrivateKey(privKey, "secret")
+	require.NoError(t, err, "Expected no error when serializing ECDSA key")
+
+	parsedKey, err := ParsePrivateKey(pemData, "secret")
+	require.NoError(t, err, "Expected no error when parsing ECDSA key")
+	assert.True(t, privKey.Equal(parsedKey), "Parsed key should match original key")
+}
+
+// TestReferenceScheme tests that saved key references are told apart from PEM.
+func TestReferenceScheme(t *testing.T) {
+	scheme, ok := ReferenceScheme([]byte("pkcs11:token=hsm;object=web;type=private\n"))
+	assert.True(t, ok, "Expected a key reference")
+	assert.Equal(t, "pkcs11", scheme)
+
+	privKey, err := GenerateEd25519Key()
+	require.NoError(t, err, "Failed to generate key for testing")
+	pemData, err := SerializePrivateKey(privKey, "")
+	require.NoError(t, err, "Failed to serialize key for testing")
+	_, ok = ReferenceScheme(pemData)
+	assert.False(t, ok, "PEM should not be taken for a key reference")
+
+	_, ok = ReferenceScheme([]byte("private.key"))
+	assert.False(t, ok, "A bare path has no scheme")
+}
+
+// TestSerializeEncryptedPrivateKey tests round trips through each cipher and KDF.
+func TestSerializeEncryptedPrivateKey(t *testing.T) {
+	privKey, err := GenerateECDSAKey("P-256")
+	require.NoError(t, err, "Failed to generate key for testing")
+
+	tests := map[string]EncryptionOptions{
+		"defaults":    {},
+		"aes-128-gcm": {Cipher: "aes-128-gcm", Iterations: 1000},
+		"aes-192-cbc": {Cipher: "aes-192-cbc", KDF: "pbkdf2", Iterations: 1000},
+		"scrypt":      {KDF: "scrypt", ScryptN: 1024, ScryptR: 8, ScryptP: 1},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			pemData, err := SerializeEncryptedPrivateKey(privKey, "secret", opts)
+			require.NoError(t, err, "Expected no error when serializing key")
+			assert.True(t, IsEncrypted(pemData), "Expected an encrypted PEM block")
+
+			parsedKey, err := ParsePrivateKey(pemData, "secret")
+			require.NoError(t, err, "Expected no error when parsing key")
+			assert.True(t, privKey.Equal(parsedKey), "Parsed key should match original key")
+		})
+	}
+
+	_, err = SerializeEncryptedPrivateKey(privKey, "secret", EncryptionOptions{Cipher: "des"})
+	assert.EqualError(t, err, "unsupported key encryption cipher: des")
+	_, err = SerializeEncryptedPrivateKey(privKey, "secret", EncryptionOptions{KDF: "argon2"})
+	assert.EqualError(t, err, "unsupported key derivation function: argon2")
+
+	// Without a password the options are not used
+	pemData, err := SerializeEncryptedPrivateKey(privKey, "", EncryptionOptions{Cipher: "des"})
+	require.NoError(t, err, "Expected no error for an unencrypted key")
+	assert.False(t, IsEncrypted(pemData), "Expected an unencrypted PEM block")
+}
+
+// TestEncodePrivateKey tests that each format writes the expected PEM block
+// and parses back to the same key.
+func TestEncodePrivateKey(t *testing.T) {
+	rsaKey, err := GenerateRSAKey(2048)
+	require.NoError(t, err, "Failed to generate RSA key for testing")
+	ecKey, err := GenerateECDSAKey("P-256")
+	require.NoError(t, err, "Failed to generate ECDSA key for testing")
+	edKey, err := GenerateEd25519Key()
+	require.NoError(t, err, "Failed to generate ed25519 key for testing")
+
+	tests := map[string]struct {
+		key      crypto.Signer
+		format   string
+		password string
+		pemType  string
+	}{
+		"pkcs8":             {ecKey, FormatPKCS8, "", "PRIVATE KEY"},
+		"pkcs1":             {rsaKey, FormatPKCS1, "", "RSA PRIVATE KEY"},
+		"sec1":              {ecKey, FormatSEC1, "", "EC PRIVATE KEY"},
+		"openssh ed25519":   {edKey, FormatOpenSSH, "", "OPENSSH PRIVATE KEY"},
+		"openssh ecdsa":     {ecKey, FormatOpenSSH, "", "OPENSSH PRIVATE KEY"},
+		"openssh encrypted": {rsaKey, FormatOpenSSH, "secret", "OPENSSH PRIVATE KEY"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			pemData, err := EncodePrivateKey(tt.key, tt.format, tt.password, EncryptionOptions{})
+			require.NoError(t, err, "Expected no error when encoding key")
+			block, _ := pem.Decode(pemData)
+			require.NotNil(t, block, "Expected a PEM block")
+			assert.Equal(t, tt.pemType, block.Type)
+			assert.Equal(t, tt.password != "", IsEncrypted(pemData))
+
+			parsedKey, err := ParsePrivateKey(pemData, tt.password)
+			require.NoError(t, err, "Expected no error when parsing key")
+			assert.True(t, tt.key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(parsedKey.(crypto.Signer).Public()),
+				"Parsed key should match original key")
+		})
+	}
+
+	_, err = EncodePrivateKey(ecKey, FormatPKCS1, "", EncryptionOptions{})
+	assert.EqualError(t, err, "pkcs1 format only supports RSA keys")
+	_, err = EncodePrivateKey(edKey, FormatSEC1, "", EncryptionOptions{})
+	assert.EqualError(t, err, "sec1 format only supports ECDSA keys")
+	_, err = EncodePrivateKey(ecKey, FormatSEC1, "secret", EncryptionOptions{})
+	assert.EqualError(t, err, "sec1 keys cannot be encrypted, use pkcs8 or openssh")
+	_, err = EncodePrivateKey(ecKey, "jwk", "", EncryptionOptions{})
+	assert.EqualError(t, err, "unsupported private key format: jwk")
+}
+
+// TestParsePrivateKey_Legacy tests OpenSSL-style keys: an EC PARAMETERS block
+// before the key, and legacy PEM encryption.
+func TestParsePrivateKey_Legacy(t *testing.T) {
+	ecKey, err := GenerateECDSAKey("P-384")
+	require.NoError(t, err, "Failed to generate ECDSA key for testing")
+	der, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+
+	params := pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x05, 0x2b, 0x81, 0x04, 0x00, 0x22}})
+	pemData := append(params, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})...)
+	parsedKey, err := ParsePrivateKey(pemData, "")
+	require.NoError(t, err, "Expected the EC PARAMETERS block to be skipped")
+	assert.True(t, ecKey.Equal(parsedKey), "Parsed key should match original key")
+
+	block, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", der, []byte("secret"), x509.PEMCipherAES256)
+	require.NoError(t, err)
+	pemData = pem.EncodeToMemory(block)
+	assert.True(t, IsEncrypted(pemData), "Expected a legacy encrypted key")
+	_, err = ParsePrivateKey(pemData, "")
+	assert.EqualError(t, err, "private key is encrypted, a passphrase is required")
+	parsedKey, err = ParsePrivateKey(pemData, "secret")
+	require.NoError(t, err, "Expected the legacy encrypted key to decrypt")
+	assert.True(t, ecKey.Equal(parsedKey), "Parsed key should match original key")
+}
@@ -1,8 +1,12 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
 )
 
 // Logger defines the logging interface.
@@ -51,3 +55,64 @@ func NewLogger() Logger {
 	}))
 	return &slogLogger{slog: sl}
 }
+
+// NewFromConfig creates a Logger from the log section of the configuration.
+// The returned io.Closer releases the log file and must be closed when logging
+// is done; it is a no-op for stdout and stderr.
+func NewFromConfig(cfg config.LogConfig) (Logger, io.Closer, error) {
+	var w io.Writer
+	var closer io.Closer = nopCloser{}
+	switch cfg.Output {
+	case "", "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	case "file":
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		w, closer = f, f
+	default:
+		return nil, nil, fmt.Errorf("unsupported log output: %s", cfg.Output)
+	}
+
+	handler, err := NewHandler(w, cfg)
+	if err != nil {
+		closer.Close()
+		return nil, nil, err
+	}
+	return &slogLogger{slog: slog.New(handler)}, closer, nil
+}
+
+// NewHandler builds the slog.Handler for the configured format and level, writing to w.
+func NewHandler(w io.Writer, cfg config.LogConfig) (slog.Handler, error) {
+	var level slog.Level
+	switch cfg.Level {
+	case "debug":
+		level = slog.LevelDebug
+	case "", "info":
+		level = slog.LevelInfo
+	case "warn":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		return nil, fmt.Errorf("unsupported log level: %s", cfg.Level)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch cfg.Format {
+	case "", "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unsupported log format: %s", cfg.Format)
+	}
+}
+
+// nopCloser is an io.Closer that does nothing.
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
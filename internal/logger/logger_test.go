@@ -1,10 +1,15 @@
 package logger
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/dstout-devops/hephaestus/internal/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -86,3 +91,42 @@ func TestNewLogger(t *testing.T) {
 	assert.NotNil(t, logger, "Expected NewLogger to return a non-nil logger")
 	assert.Implements(t, (*Logger)(nil), logger, "Expected logger to implement Logger interface")
 }
+
+// TestNewHandler tests handler format and level selection.
+func TestNewHandler(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := NewHandler(&buf, config.LogConfig{Format: "json", Level: "warn"})
+	require.NoError(t, err, "Expected no error for a valid config")
+
+	logger := &slogLogger{slog: slog.New(handler)}
+	logger.Info("filtered")
+	logger.Warn("kept", "key", "value")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record), "Expected a single JSON record")
+	assert.Equal(t, "kept", record["msg"], "Expected the warn message")
+	assert.Equal(t, "WARN", record["level"], "Expected the warn level")
+	assert.Equal(t, "value", record["key"], "Expected the key-value pair")
+
+	_, err = NewHandler(&buf, config.LogConfig{Format: "xml"})
+	assert.EqualError(t, err, "unsupported log format: xml", "Expected specific error message")
+	_, err = NewHandler(&buf, config.LogConfig{Level: "trace"})
+	assert.EqualError(t, err, "unsupported log level: trace", "Expected specific error message")
+}
+
+// TestNewFromConfig tests logging to a file at debug level.
+func TestNewFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hephaestus.log")
+	logger, closer, err := NewFromConfig(config.LogConfig{Level: "debug", Output: "file", File: path})
+	require.NoError(t, err, "Expected no error for a valid config")
+
+	logger.Debug("debug message")
+	require.NoError(t, closer.Close(), "Expected the log file to close")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "level=DEBUG msg=\"debug message\"", "Expected the debug record in text format")
+
+	_, _, err = NewFromConfig(config.LogConfig{Output: "syslog"})
+	assert.EqualError(t, err, "unsupported log output: syslog", "Expected specific error message")
+}
@@ -0,0 +1,57 @@
+package pending
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Request is a CSR the CA accepted but has not issued a certificate for yet.
+// It records where the key and CSR were saved so a later run can fetch the
+// certificate instead of starting over with a new key.
+type Request struct {
+	Backend   string    `json:"backend"`
+	RequestID string    `json:"request_id"`
+	Key       string    `json:"key"` // Private key the CSR is signed with
+	CSR       string    `json:"csr"`
+	Submitted time.Time `json:"submitted"`
+}
+
+// Load reads the request saved at path. It returns nil when no request is saved.
+func Load(path string) (*Request, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending request: %w", err)
+	}
+	var req Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("failed to parse pending request %s: %w", path, err)
+	}
+	if req.RequestID == "" {
+		return nil, fmt.Errorf("pending request %s has no request ID", path)
+	}
+	return &req, nil
+}
+
+// Encode returns the request as JSON for saving.
+func (r *Request) Encode() ([]byte, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Remove deletes the request saved at path, if any.
+func Remove(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove pending request: %w", err)
+	}
+	return nil
+}
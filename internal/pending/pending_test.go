@@ -0,0 +1,55 @@
+package pending
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoad tests saving and loading a pending request.
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pending.json")
+	req := &Request{
+		Backend:   "esf",
+		RequestID: "REQ-42",
+		Key:       "private.key",
+		CSR:       "host.csr",
+		Submitted: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	data, err := req.Encode()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	got, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, req, got)
+
+	require.NoError(t, Remove(path))
+	got, err = Load(path)
+	require.NoError(t, err)
+	assert.Nil(t, got, "Expected no request after removal")
+	assert.NoError(t, Remove(path), "Removing a missing request should succeed")
+}
+
+// TestLoad_Invalid tests that unusable files are reported.
+func TestLoad_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		data    string
+		wantErr string
+	}{
+		"not json":      {"REQ-42", "failed to parse pending request"},
+		"no request id": {`{"backend":"esf"}`, "has no request ID"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pending.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0600))
+			_, err := Load(path)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
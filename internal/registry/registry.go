@@ -0,0 +1,187 @@
+// Package registry holds the implementations hephaestus selects by name from
+// the configuration. Implementations register themselves from init functions,
+// as the built-ins in internal/builtins do, so new key types, CSR builders,
+// backends and output formats can be added without changing the command.
+package registry
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+)
+
+// Names used when the configuration leaves a selection empty.
+const (
+	DefaultCSRBuilder = "pkcs10"
+	DefaultBackend    = "esf"
+	DefaultFormat     = "pem"
+)
+
+// KeyGenerator creates a new private key, selected by key.type.
+type KeyGenerator func(cfg config.KeyConfig) (crypto.PrivateKey, error)
+
+// KeyLoader opens a private key saved as a reference, selected by the scheme
+// of its URI, such as a key kept in a PKCS#11 token.
+type KeyLoader func(uri string, cfg config.KeyConfig) (crypto.PrivateKey, error)
+
+// CSRBuilder creates a PEM-encoded CSR signed by key, selected by csr.builder.
+type CSRBuilder func(key crypto.PrivateKey, cfg config.CSRConfig) ([]byte, error)
+
+// Submitter sends a PEM-encoded CSR to a CA, selected by backend.
+type Submitter interface {
+	Submit(ctx context.Context, cfg config.Config, csrPEM []byte) (*certs.Bundle, error)
+}
+
+// Fetcher is implemented by submitters that can retrieve an earlier request by its ID.
+type Fetcher interface {
+	Fetch(ctx context.Context, cfg config.Config, requestID string) (*certs.Bundle, error)
+}
+
+// SubmitterFunc adapts a function to the Submitter interface.
+type SubmitterFunc func(ctx context.Context, cfg config.Config, csrPEM []byte) (*certs.Bundle, error)
+
+// Submit calls f(ctx, cfg, csrPEM).
+func (f SubmitterFunc) Submit(ctx context.Context, cfg config.Config, csrPEM []byte) (*certs.Bundle, error) {
+	return f(ctx, cfg, csrPEM)
+}
+
+// Output is an issued certificate to be written to certificate.output.
+type Output struct {
+	Bundle *certs.Bundle
+	Config config.CertificateConfig
+	Key    func() (crypto.PrivateKey, error) // Loads the private key for formats that include it
+}
+
+// Writer encodes an issued certificate, selected by certificate.format, and
+// returns the file contents and permissions.
+type Writer func(out Output) ([]byte, os.FileMode, error)
+
+var (
+	keyGenerators = newTable[KeyGenerator]("key type")
+	keyLoaders    = newTable[KeyLoader]("key reference scheme")
+	csrBuilders   = newTable[CSRBuilder]("CSR builder")
+	submitters    = newTable[Submitter]("backend")
+	writers       = newTable[Writer]("certificate format")
+)
+
+// RegisterKeyGenerator makes a key generator available as key.type name.
+// It panics if name is empty or already registered.
+func RegisterKeyGenerator(name string, gen KeyGenerator) { keyGenerators.register(name, gen) }
+
+// RegisterKeyLoader makes a key loader available for references with the URI scheme.
+// It panics if scheme is empty or already registered.
+func RegisterKeyLoader(scheme string, loader KeyLoader) { keyLoaders.register(scheme, loader) }
+
+// RegisterCSRBuilder makes a CSR builder available as csr.builder name.
+// It panics if name is empty or already registered.
+func RegisterCSRBuilder(name string, builder CSRBuilder) { csrBuilders.register(name, builder) }
+
+// RegisterSubmitter makes a submitter available as backend name.
+// It panics if name is empty or already registered.
+func RegisterSubmitter(name string, submitter Submitter) { submitters.register(name, submitter) }
+
+// RegisterWriter makes an output writer available as certificate.format name.
+// It panics if name is empty or already registered.
+func RegisterWriter(name string, writer Writer) { writers.register(name, writer) }
+
+// LookupKeyGenerator returns the key generator registered as name.
+func LookupKeyGenerator(name string) (KeyGenerator, error) { return keyGenerators.lookup(name) }
+
+// LookupKeyLoader returns the key loader registered for scheme.
+func LookupKeyLoader(scheme string) (KeyLoader, error) { return keyLoaders.lookup(scheme) }
+
+// LookupCSRBuilder returns the CSR builder registered as name, or the default when name is empty.
+func LookupCSRBuilder(name string) (CSRBuilder, error) {
+	return csrBuilders.lookup(orDefault(name, DefaultCSRBuilder))
+}
+
+// LookupSubmitter returns the submitter registered as name, or the default when name is empty.
+func LookupSubmitter(name string) (Submitter, error) {
+	return submitters.lookup(orDefault(name, DefaultBackend))
+}
+
+// LookupWriter returns the output writer registered as name, or the default when name is empty.
+func LookupWriter(name string) (Writer, error) { return writers.lookup(orDefault(name, DefaultFormat)) }
+
+// Missing returns a field error for every implementation named in cfg that is not registered.
+func Missing(cfg config.Config) []config.FieldError {
+	var errs []config.FieldError
+	check := func(path, name string, names []string) {
+		for _, n := range names {
+			if n == name {
+				return
+			}
+		}
+		errs = append(errs, config.FieldError{
+			Path:    path,
+			Message: fmt.Sprintf("must be one of %s, got %q", strings.Join(names, ", "), name),
+		})
+	}
+
+	if cfg.Key.Input == "" && cfg.Key.Type != "" {
+		check("key.type", cfg.Key.Type, keyGenerators.names())
+	}
+	check("csr.builder", orDefault(cfg.CSR.Builder, DefaultCSRBuilder), csrBuilders.names())
+	check("backend", orDefault(cfg.Backend, DefaultBackend), submitters.names())
+	check("certificate.format", orDefault(cfg.Certificate.Format, DefaultFormat), writers.names())
+	return errs
+}
+
+// orDefault returns name, or def when name is empty.
+func orDefault(name, def string) string {
+	if name == "" {
+		return def
+	}
+	return name
+}
+
+// table is a concurrency-safe set of named implementations of one kind.
+type table[T any] struct {
+	kind  string
+	mu    sync.RWMutex
+	items map[string]T
+}
+
+func newTable[T any](kind string) *table[T] {
+	return &table[T]{kind: kind, items: make(map[string]T)}
+}
+
+func (t *table[T]) register(name string, item T) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if name == "" {
+		panic(fmt.Sprintf("registry: empty %s name", t.kind))
+	}
+	if _, dup := t.items[name]; dup {
+		panic(fmt.Sprintf("registry: %s %q registered twice", t.kind, name))
+	}
+	t.items[name] = item
+}
+
+func (t *table[T]) lookup(name string) (T, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	item, ok := t.items[name]
+	if !ok {
+		return item, fmt.Errorf("unknown %s %q", t.kind, name)
+	}
+	return item, nil
+}
+
+func (t *table[T]) names() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	names := make([]string, 0, len(t.items))
+	for name := range t.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"context"
+	"crypto"
+	"testing"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTable tests registering, looking up and listing names.
+func TestTable(t *testing.T) {
+	tbl := newTable[int]("widget")
+	tbl.register("b", 2)
+	tbl.register("a", 1)
+
+	got, err := tbl.lookup("a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, got)
+	assert.Equal(t, []string{"a", "b"}, tbl.names(), "Names should be sorted")
+
+	_, err = tbl.lookup("c")
+	assert.EqualError(t, err, `unknown widget "c"`)
+
+	assert.PanicsWithValue(t, `registry: widget "a" registered twice`, func() { tbl.register("a", 3) })
+	assert.PanicsWithValue(t, "registry: empty widget name", func() { tbl.register("", 3) })
+}
+
+// TestLookupDefaults tests that empty names select the defaults.
+func TestLookupDefaults(t *testing.T) {
+	RegisterSubmitter(DefaultBackend, SubmitterFunc(func(context.Context, config.Config, []byte) (*certs.Bundle, error) {
+		return &certs.Bundle{}, nil
+	}))
+	RegisterCSRBuilder(DefaultCSRBuilder, func(crypto.PrivateKey, config.CSRConfig) ([]byte, error) {
+		return []byte("csr"), nil
+	})
+
+	submitter, err := LookupSubmitter("")
+	require.NoError(t, err)
+	bundle, err := submitter.Submit(context.Background(), config.Config{}, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, bundle)
+
+	build, err := LookupCSRBuilder("")
+	require.NoError(t, err)
+	csr, err := build(nil, config.CSRConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("csr"), csr)
+
+	_, err = LookupWriter("")
+	assert.EqualError(t, err, `unknown certificate format "pem"`)
+}
+
+// TestMissing tests reporting names without a registered implementation.
+func TestMissing(t *testing.T) {
+	RegisterKeyGenerator("test-key", func(config.KeyConfig) (crypto.PrivateKey, error) { return nil, nil })
+
+	errs := Missing(config.Config{
+		Key:         config.KeyConfig{Type: "test-key"},
+		CSR:         config.CSRConfig{Builder: "crmf"},
+		Backend:     "nowhere",
+		Certificate: config.CertificateConfig{Format: "jks"},
+	})
+	var paths []string
+	for _, fe := range errs {
+		paths = append(paths, fe.Path)
+	}
+	assert.Equal(t, []string{"csr.builder", "backend", "certificate.format"}, paths)
+
+	// An input key does not need a generator
+	errs = Missing(config.Config{Key: config.KeyConfig{Type: "dsa", Input: "existing.key"}})
+	for _, fe := range errs {
+		assert.NotEqual(t, "key.type", fe.Path)
+	}
+}
@@ -0,0 +1,44 @@
+package renew
+
+import (
+	"crypto/x509"
+	"math/rand/v2"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+)
+
+// DefaultFraction is the share of a certificate's lifetime after which it is renewed
+// when no valid fraction is configured.
+const DefaultFraction = 2.0 / 3.0
+
+// RenewAt computes when the certificate is due for renewal. A fixed number of
+// days before NotAfter takes precedence over a fraction of the lifetime. A
+// schedule that would fall before NotBefore falls back to DefaultFraction so a
+// short-lived certificate is not renewed in a loop.
+func RenewAt(cert *x509.Certificate, cfg config.RenewConfig) time.Time {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	fallback := cert.NotBefore.Add(time.Duration(float64(lifetime) * DefaultFraction))
+
+	if cfg.DaysBefore > 0 {
+		at := cert.NotAfter.Add(-time.Duration(cfg.DaysBefore) * 24 * time.Hour)
+		if at.Before(cert.NotBefore) {
+			return fallback
+		}
+		return at
+	}
+
+	if cfg.Fraction <= 0 || cfg.Fraction >= 1 {
+		return fallback
+	}
+	return cert.NotBefore.Add(time.Duration(float64(lifetime) * cfg.Fraction))
+}
+
+// Jitter returns a random duration in [0, max) used to spread renewals of many
+// hosts. It returns zero when max is not positive.
+func Jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(max)))
+}
@@ -0,0 +1,61 @@
+package renew
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRenewAt tests the renewal time for each scheduling option.
+func TestRenewAt(t *testing.T) {
+	notBefore := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{
+		NotBefore: notBefore,
+		NotAfter:  notBefore.Add(90 * 24 * time.Hour),
+	}
+
+	tests := map[string]struct {
+		cfg  config.RenewConfig
+		want time.Time
+	}{
+		"default fraction": {
+			cfg:  config.RenewConfig{},
+			want: notBefore.Add(60 * 24 * time.Hour),
+		},
+		"fraction": {
+			cfg:  config.RenewConfig{Fraction: 0.5},
+			want: notBefore.Add(45 * 24 * time.Hour),
+		},
+		"invalid fraction": {
+			cfg:  config.RenewConfig{Fraction: 1.5},
+			want: notBefore.Add(60 * 24 * time.Hour),
+		},
+		"days before": {
+			cfg:  config.RenewConfig{Fraction: 0.5, DaysBefore: 30},
+			want: notBefore.Add(60 * 24 * time.Hour),
+		},
+		"days before exceeds lifetime": {
+			cfg:  config.RenewConfig{DaysBefore: 120},
+			want: notBefore.Add(60 * 24 * time.Hour),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.want, RenewAt(cert, tt.cfg))
+		})
+	}
+}
+
+// TestJitter tests that jitter stays within bounds.
+func TestJitter(t *testing.T) {
+	assert.Zero(t, Jitter(0), "Expected no jitter for zero max")
+	assert.Zero(t, Jitter(-time.Second), "Expected no jitter for negative max")
+	for range 100 {
+		j := Jitter(time.Minute)
+		assert.GreaterOrEqual(t, j, time.Duration(0))
+		assert.Less(t, j, time.Minute)
+	}
+}
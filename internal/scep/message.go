@@ -0,0 +1,264 @@
+package scep
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/smallstep/pkcs7"
+)
+
+// SCEP message types carried in the messageType attribute.
+const (
+	msgCertRep        = "3"
+	msgPKCSReq        = "19"
+	msgGetCertInitial = "20"
+)
+
+// SCEP pkiStatus values.
+const (
+	statusSuccess = "0"
+	statusFailure = "2"
+	statusPending = "3"
+)
+
+// Signed attribute OIDs defined by RFC 8894.
+var (
+	oidMessageType    = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 2}
+	oidPKIStatus      = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 3}
+	oidFailInfo       = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 4}
+	oidSenderNonce    = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 5}
+	oidRecipientNonce = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 6}
+	oidTransactionID  = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 7}
+)
+
+// failInfoText describes the failInfo values of a rejected request.
+var failInfoText = map[string]string{
+	"0": "badAlg",
+	"1": "badMessageCheck",
+	"2": "badRequest",
+	"3": "badTime",
+	"4": "badCertId",
+}
+
+// issuerAndSubject is the content of a GetCertInitial message.
+type issuerAndSubject struct {
+	Issuer  asn1.RawValue
+	Subject asn1.RawValue
+}
+
+// signer is the transient identity that signs requests and decrypts replies.
+// It always uses RSA, since SCEP replies are encrypted with RSA key transport
+// whatever the type of the key being certified.
+type signer struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+// newSigner creates a transient self-signed certificate for subject.
+func newSigner(subject []byte) (*signer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		RawSubject:   subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &signer{cert: cert, key: key}, nil
+}
+
+// transactionID derives a stable transaction ID from the requested public key.
+func transactionID(csr *x509.CertificateRequest) string {
+	sum := sha256.Sum256(csr.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+// message builds a pkiMessage: content is encrypted for recipient and the
+// envelope is signed together with the SCEP attributes.
+func (s *signer) message(msgType, txID string, nonce, content []byte, recipient *x509.Certificate, caps capabilities) ([]byte, error) {
+	envelope, err := encrypt(content, recipient, caps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+
+	sd, err := pkcs7.NewSignedData(envelope)
+	if err != nil {
+		return nil, err
+	}
+	if caps.has("SHA-256") {
+		sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	}
+	err = sd.AddSigner(s.cert, s.key, pkcs7.SignerInfoConfig{
+		ExtraSignedAttributes: []pkcs7.Attribute{
+			{Type: oidMessageType, Value: msgType},
+			{Type: oidTransactionID, Value: txID},
+			{Type: oidSenderNonce, Value: nonce},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	return sd.Finish()
+}
+
+// certRep is a decoded CertRep reply.
+type certRep struct {
+	status string
+	certs  []*x509.Certificate // Issued certificates, on success
+}
+
+// parseCertRep verifies a CertRep signed by one of caCerts, checks that it
+// answers the request with txID and nonce, and decrypts any issued certificates.
+func (s *signer) parseCertRep(data []byte, caCerts []*x509.Certificate, txID string, nonce []byte) (*certRep, error) {
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse reply: %w", err)
+	}
+	if len(p7.Certificates) == 0 {
+		p7.Certificates = caCerts // Replies may omit the signer certificate
+	}
+	if err := p7.Verify(); err != nil {
+		return nil, fmt.Errorf("failed to verify reply: %w", err)
+	}
+	if !contains(caCerts, p7.GetOnlySigner()) {
+		return nil, errors.New("reply is not signed by the CA or RA")
+	}
+
+	var msgType, status, gotTxID string
+	var recipientNonce []byte
+	for _, attr := range []struct {
+		oid asn1.ObjectIdentifier
+		out interface{}
+	}{
+		{oidMessageType, &msgType},
+		{oidPKIStatus, &status},
+		{oidTransactionID, &gotTxID},
+		{oidRecipientNonce, &recipientNonce},
+	} {
+		if err := p7.UnmarshalSignedAttribute(attr.oid, attr.out); err != nil {
+			return nil, fmt.Errorf("reply attribute %s: %w", attr.oid, err)
+		}
+	}
+	switch {
+	case msgType != msgCertRep:
+		return nil, fmt.Errorf("unexpected reply message type %s", msgType)
+	case gotTxID != txID:
+		return nil, errors.New("reply transaction ID does not match the request")
+	case !bytes.Equal(recipientNonce, nonce):
+		return nil, errors.New("reply nonce does not match the request")
+	}
+
+	rep := &certRep{status: status}
+	switch status {
+	case statusSuccess:
+		envelope, err := pkcs7.Parse(p7.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse reply envelope: %w", err)
+		}
+		content, err := envelope.Decrypt(s.cert, s.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt reply: %w", err)
+		}
+		issued, err := pkcs7.Parse(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse issued certificates: %w", err)
+		}
+		if len(issued.Certificates) == 0 {
+			return nil, errors.New("reply contains no certificates")
+		}
+		rep.certs = issued.Certificates
+	case statusFailure:
+		var failInfo string
+		_ = p7.UnmarshalSignedAttribute(oidFailInfo, &failInfo)
+		if text, ok := failInfoText[failInfo]; ok {
+			failInfo = text
+		}
+		return nil, fmt.Errorf("request rejected: %s", failInfo)
+	case statusPending:
+	default:
+		return nil, fmt.Errorf("unexpected reply status %q", status)
+	}
+	return rep, nil
+}
+
+// contains reports whether list holds cert.
+func contains(list []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range list {
+		if cert != nil && c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// recipient picks the certificate requests are encrypted for: the RA
+// certificate when the server has one, otherwise the CA certificate.
+func recipient(caCerts []*x509.Certificate) *x509.Certificate {
+	for _, cert := range caCerts {
+		if !cert.IsCA {
+			return cert
+		}
+	}
+	return caCerts[0]
+}
+
+// issuer picks the CA certificate from the certificates the server returned.
+func issuer(caCerts []*x509.Certificate) *x509.Certificate {
+	for _, cert := range caCerts {
+		if cert.IsCA {
+			return cert
+		}
+	}
+	return caCerts[0]
+}
+
+// getCertInitial builds the content of a GetCertInitial poll.
+func getCertInitial(ca *x509.Certificate, csr *x509.CertificateRequest) ([]byte, error) {
+	return asn1.Marshal(issuerAndSubject{
+		Issuer:  asn1.RawValue{FullBytes: ca.RawSubject},
+		Subject: asn1.RawValue{FullBytes: csr.RawSubject},
+	})
+}
+
+// newNonce returns a random senderNonce.
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// subjectName returns the DER subject of csr, falling back to a fixed name
+// for requests with an empty subject.
+func subjectName(csr *x509.CertificateRequest) ([]byte, error) {
+	if len(csr.Subject.Names) > 0 {
+		return csr.RawSubject, nil
+	}
+	return asn1.Marshal(pkix.Name{CommonName: "hephaestus"}.ToRDNSequence())
+}
@@ -0,0 +1,279 @@
+package scep
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/smallstep/pkcs7"
+)
+
+const (
+	// defaultTimeout bounds each request when no HTTP client is supplied.
+	defaultTimeout = 30 * time.Second
+	// defaultPollInterval is used when no poll interval is configured.
+	defaultPollInterval = time.Minute
+	// defaultPollTimeout is used when no poll timeout is configured.
+	defaultPollTimeout = 10 * time.Minute
+	// maxErrorBody limits how much of an error response body is reported.
+	maxErrorBody = 512
+	// maxResponseBody limits the size of a response.
+	maxResponseBody = 1 << 20
+)
+
+// capabilities are the keywords returned by GetCACaps.
+type capabilities map[string]bool
+
+// has reports whether the server advertised capability or, for algorithms,
+// the SCEPStandard keyword that implies them.
+func (c capabilities) has(capability string) bool {
+	if c[strings.ToLower(capability)] {
+		return true
+	}
+	switch capability {
+	case "AES", "SHA-256", "POSTPKIOperation":
+		return c["scepstandard"]
+	}
+	return false
+}
+
+// Client enrolls certificates with an RFC 8894 SCEP server.
+type Client struct {
+	httpClient *http.Client
+	cfg        config.SCEPConfig
+	sleep      func(ctx context.Context, d time.Duration) error // Replaced in tests
+}
+
+// NewClient creates a new Client. A nil httpClient uses a client with a default timeout.
+func NewClient(httpClient *http.Client, cfg config.SCEPConfig) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	return &Client{httpClient: httpClient, cfg: cfg, sleep: sleep}
+}
+
+// Submit reads the server capabilities and CA certificates, sends the
+// PEM-encoded CSR in a PKCSReq message signed with a transient self-signed
+// certificate, and polls with GetCertInitial while the request is pending.
+// Any challenge password must already be an attribute of the CSR.
+func (c *Client) Submit(ctx context.Context, csrPEM []byte) (*certs.Bundle, error) {
+	if c.cfg.URL == "" {
+		return nil, errors.New("no SCEP URL configured")
+	}
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("failed to decode CSR")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSR: %w", err)
+	}
+
+	caps, err := c.getCACaps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	caCerts, err := c.getCACert(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := subjectName(csr)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSigner(subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing certificate: %w", err)
+	}
+	txID := transactionID(csr)
+
+	rep, err := c.send(ctx, s, msgPKCSReq, txID, block.Bytes, caCerts, caps)
+	if err != nil {
+		return nil, err
+	}
+
+	interval, timeout := c.cfg.PollInterval, c.cfg.PollTimeout
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultPollTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for rep.status == statusPending {
+		if time.Now().Add(interval).After(deadline) {
+			return nil, fmt.Errorf("request %s still pending after %s", txID, timeout)
+		}
+		if d, ok := ctx.Deadline(); ok && time.Now().Add(interval).After(d) {
+			return nil, fmt.Errorf("request %s still pending at the retry.timeout deadline", txID)
+		}
+		if err := c.sleep(ctx, interval); err != nil {
+			return nil, err
+		}
+
+		poll, err := getCertInitial(issuer(caCerts), csr)
+		if err != nil {
+			return nil, err
+		}
+		if rep, err = c.send(ctx, s, msgGetCertInitial, txID, poll, caCerts, caps); err != nil {
+			return nil, err
+		}
+	}
+	return certs.ForKey(csr.PublicKey, rep.certs, caCerts)
+}
+
+// send wraps content in a pkiMessage, posts it and decodes the CertRep reply.
+func (c *Client) send(ctx context.Context, s *signer, msgType, txID string, content []byte, caCerts []*x509.Certificate, caps capabilities) (*certRep, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := s.message(msgType, txID, nonce, content, recipient(caCerts), caps)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.pkiOperation(ctx, msg, caps)
+	if err != nil {
+		return nil, fmt.Errorf("PKIOperation failed: %w", err)
+	}
+	return s.parseCertRep(data, caCerts, txID, nonce)
+}
+
+// getCACaps returns the capabilities advertised by the server. Servers that
+// do not implement GetCACaps are treated as advertising none.
+func (c *Client) getCACaps(ctx context.Context) (capabilities, error) {
+	body, _, err := c.get(ctx, "GetCACaps", "")
+	caps := capabilities{}
+	if err != nil {
+		var se *statusError
+		if errors.As(err, &se) {
+			return caps, nil
+		}
+		return nil, fmt.Errorf("GetCACaps failed: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			caps[strings.ToLower(line)] = true
+		}
+	}
+	return caps, nil
+}
+
+// getCACert returns the CA certificate, followed by any RA certificates.
+func (c *Client) getCACert(ctx context.Context) ([]*x509.Certificate, error) {
+	body, contentType, err := c.get(ctx, "GetCACert", "")
+	if err != nil {
+		return nil, fmt.Errorf("GetCACert failed: %w", err)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "application/x-x509-ca-ra-cert" {
+		if cert, err := x509.ParseCertificate(body); err == nil {
+			return []*x509.Certificate{cert}, nil
+		}
+	}
+	p7, err := pkcs7.Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("GetCACert failed: invalid response: %w", err)
+	}
+	if len(p7.Certificates) == 0 {
+		return nil, errors.New("GetCACert failed: response contains no certificates")
+	}
+	return p7.Certificates, nil
+}
+
+// pkiOperation sends a pkiMessage by POST when the server supports it and
+// by GET otherwise.
+func (c *Client) pkiOperation(ctx context.Context, msg []byte, caps capabilities) ([]byte, error) {
+	if !caps.has("POSTPKIOperation") {
+		body, _, err := c.get(ctx, "PKIOperation", base64.StdEncoding.EncodeToString(msg))
+		return body, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.operationURL("PKIOperation", ""), bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-pki-message")
+	body, _, err := c.do(req)
+	return body, err
+}
+
+// get performs a GET request for operation with an optional message parameter.
+func (c *Client) get(ctx context.Context, operation, message string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.operationURL(operation, message), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return c.do(req)
+}
+
+// operationURL returns the configured URL with the operation query parameters.
+func (c *Client) operationURL(operation, message string) string {
+	u, err := url.Parse(c.cfg.URL)
+	if err != nil {
+		return c.cfg.URL
+	}
+	q := u.Query()
+	q.Set("operation", operation)
+	if message != "" {
+		q.Set("message", message)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// statusError reports a non-2xx HTTP response.
+type statusError struct {
+	status string
+	body   []byte
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("server returned %s: %s", e.status, e.body)
+}
+
+// do sends the request and returns the response body and content type.
+func (c *Client) do(req *http.Request) ([]byte, string, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return nil, "", &statusError{status: resp.Status, body: bytes.TrimSpace(msg)}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read response: %w", err)
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
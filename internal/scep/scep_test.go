@@ -0,0 +1,281 @@
+package scep
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/smallstep/pkcs7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCSR creates a PEM-encoded CSR for testing.
+func newCSR(t *testing.T, cn string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate key")
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: cn},
+	}, key)
+	require.NoError(t, err, "failed to create CSR")
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+// fakeSCEP is a SCEP server whose CA also acts as the recipient of requests.
+type fakeSCEP struct {
+	*httptest.Server
+	caps     string
+	ca       *x509.Certificate
+	caKey    *rsa.PrivateKey
+	pending  int    // Number of pending replies before issuing
+	failInfo string // Reject requests with this failInfo when set
+	methods  []string
+	types    []string // Message types received
+	csrs     map[string]*x509.CertificateRequest
+}
+
+// newFakeSCEP starts a SCEP server advertising caps.
+func newFakeSCEP(t *testing.T, caps string) *fakeSCEP {
+	t.Helper()
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test SCEP CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	f := &fakeSCEP{caps: caps, ca: ca, caKey: caKey, csrs: map[string]*x509.CertificateRequest{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("operation") {
+		case "GetCACaps":
+			if f.caps == "" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = io.WriteString(w, f.caps)
+		case "GetCACert":
+			w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+			_, _ = w.Write(f.ca.Raw)
+		case "PKIOperation":
+			f.methods = append(f.methods, r.Method)
+			var msg []byte
+			if r.Method == http.MethodPost {
+				msg, err = io.ReadAll(r.Body)
+			} else {
+				msg, err = base64.StdEncoding.DecodeString(r.URL.Query().Get("message"))
+			}
+			require.NoError(t, err)
+			w.Header().Set("Content-Type", "application/x-pki-message")
+			_, _ = w.Write(f.reply(t, msg))
+		default:
+			http.Error(w, "unknown operation", http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// reply handles a pkiMessage and returns the signed CertRep.
+func (f *fakeSCEP) reply(t *testing.T, msg []byte) []byte {
+	p7, err := pkcs7.Parse(msg)
+	require.NoError(t, err)
+	require.NoError(t, p7.Verify(), "request signature should verify")
+
+	var msgType, txID string
+	var nonce []byte
+	require.NoError(t, p7.UnmarshalSignedAttribute(oidMessageType, &msgType))
+	require.NoError(t, p7.UnmarshalSignedAttribute(oidTransactionID, &txID))
+	require.NoError(t, p7.UnmarshalSignedAttribute(oidSenderNonce, &nonce))
+	f.types = append(f.types, msgType)
+
+	envelope, err := pkcs7.Parse(p7.Content)
+	require.NoError(t, err)
+	content, err := envelope.Decrypt(f.ca, f.caKey)
+	require.NoError(t, err, "request should be encrypted for the CA")
+
+	switch msgType {
+	case msgPKCSReq:
+		csr, err := x509.ParseCertificateRequest(content)
+		require.NoError(t, err)
+		f.csrs[txID] = csr
+	case msgGetCertInitial:
+		var ias issuerAndSubject
+		_, err := asn1.Unmarshal(content, &ias)
+		require.NoError(t, err)
+		assert.Equal(t, f.ca.RawSubject, ias.Issuer.FullBytes, "poll should name the CA as issuer")
+	}
+
+	status := statusSuccess
+	var issued []byte
+	attrs := []pkcs7.Attribute{
+		{Type: oidMessageType, Value: msgCertRep},
+		{Type: oidTransactionID, Value: txID},
+		{Type: oidRecipientNonce, Value: nonce},
+	}
+	switch {
+	case f.failInfo != "":
+		status = statusFailure
+		attrs = append(attrs, pkcs7.Attribute{Type: oidFailInfo, Value: f.failInfo})
+	case f.pending > 0:
+		f.pending--
+		status = statusPending
+	default:
+		csr := f.csrs[txID]
+		require.NotNil(t, csr, "poll for unknown transaction")
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      csr.Subject,
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, f.ca, csr.PublicKey, f.caKey)
+		require.NoError(t, err)
+		degenerate, err := pkcs7.DegenerateCertificate(der)
+		require.NoError(t, err)
+		issued, err = pkcs7.Encrypt(degenerate, []*x509.Certificate{p7.GetOnlySigner()})
+		require.NoError(t, err)
+	}
+	attrs = append(attrs, pkcs7.Attribute{Type: oidPKIStatus, Value: status})
+
+	sd, err := pkcs7.NewSignedData(issued)
+	require.NoError(t, err)
+	require.NoError(t, sd.AddSigner(f.ca, f.caKey, pkcs7.SignerInfoConfig{ExtraSignedAttributes: attrs}))
+	out, err := sd.Finish()
+	require.NoError(t, err)
+	return out
+}
+
+// newTestClient returns a client for f that does not sleep between polls.
+func newTestClient(f *fakeSCEP, cfg config.SCEPConfig) *Client {
+	cfg.URL = f.URL + "/scep"
+	client := NewClient(f.Client(), cfg)
+	client.sleep = func(context.Context, time.Duration) error { return nil }
+	return client
+}
+
+// TestSubmit tests enrollment over POST and over GET for servers without capabilities.
+func TestSubmit(t *testing.T) {
+	tests := map[string]struct {
+		caps   string
+		method string
+	}{
+		"post":     {"POSTPKIOperation\nSHA-256\nAES\n", http.MethodPost},
+		"standard": {"SCEPStandard\n", http.MethodPost},
+		"get":      {"", http.MethodGet},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeSCEP(t, tt.caps)
+			bundle, err := newTestClient(f, config.SCEPConfig{}).Submit(context.Background(), newCSR(t, "host.example.com"))
+			require.NoError(t, err, "Submit should succeed")
+
+			assert.Equal(t, []string{tt.method}, f.methods)
+			assert.Equal(t, "host.example.com", bundle.Certificate.Subject.CommonName)
+			require.Len(t, bundle.Chain, 1)
+			assert.True(t, bundle.Chain[0].Equal(f.ca), "Expected the CA certificate as the chain")
+		})
+	}
+}
+
+// TestSubmit_Pending tests polling with GetCertInitial until the certificate is issued.
+func TestSubmit_Pending(t *testing.T) {
+	f := newFakeSCEP(t, "POSTPKIOperation\n")
+	f.pending = 2
+
+	bundle, err := newTestClient(f, config.SCEPConfig{PollInterval: time.Second, PollTimeout: time.Minute}).Submit(context.Background(), newCSR(t, "host.example.com"))
+	require.NoError(t, err, "Submit should succeed once issued")
+	assert.Equal(t, []string{msgPKCSReq, msgGetCertInitial, msgGetCertInitial}, f.types)
+	assert.Equal(t, "host.example.com", bundle.Certificate.Subject.CommonName)
+}
+
+// TestSubmit_PendingTimeout tests that polling stops at the poll timeout.
+func TestSubmit_PendingTimeout(t *testing.T) {
+	f := newFakeSCEP(t, "POSTPKIOperation\n")
+	f.pending = 100
+
+	_, err := newTestClient(f, config.SCEPConfig{PollInterval: time.Minute, PollTimeout: time.Minute / 2}).Submit(context.Background(), newCSR(t, "host.example.com"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "still pending after 30s")
+	assert.Equal(t, []string{msgPKCSReq}, f.types)
+}
+
+// TestSubmit_PendingDeadline tests that polling stops before the context
+// deadline set from retry.timeout.
+func TestSubmit_PendingDeadline(t *testing.T) {
+	f := newFakeSCEP(t, "POSTPKIOperation\n")
+	f.pending = 100
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := newTestClient(f, config.SCEPConfig{PollInterval: time.Minute}).Submit(ctx, newCSR(t, "host.example.com"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "still pending at the retry.timeout deadline")
+	assert.Equal(t, []string{msgPKCSReq}, f.types)
+}
+
+// TestSubmit_Rejected tests that a failure reply reports its failInfo.
+func TestSubmit_Rejected(t *testing.T) {
+	f := newFakeSCEP(t, "POSTPKIOperation\n")
+	f.failInfo = "2"
+
+	_, err := newTestClient(f, config.SCEPConfig{}).Submit(context.Background(), newCSR(t, "host.example.com"))
+	assert.EqualError(t, err, "request rejected: badRequest")
+}
+
+// TestEncrypt tests that requests use AES when the server offers it and
+// DES-EDE3-CBC otherwise, never single DES.
+func TestEncrypt(t *testing.T) {
+	f := newFakeSCEP(t, "")
+	tests := map[string]struct {
+		caps capabilities
+		want asn1.ObjectIdentifier
+	}{
+		"aes":      {capabilities{"aes": true}, oidAES128CBC},
+		"standard": {capabilities{"scepstandard": true}, oidAES128CBC},
+		"none":     {capabilities{}, oidDESEDE3CBC},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			der, err := encrypt([]byte("request content"), f.ca, tt.caps)
+			require.NoError(t, err)
+
+			var ci contentInfo
+			_, err = asn1.Unmarshal(der, &ci)
+			require.NoError(t, err)
+			var env envelopedData
+			_, err = asn1.Unmarshal(ci.Content.Bytes, &env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, env.EncryptedContentInfo.ContentEncryptionAlgorithm.Algorithm)
+
+			p7, err := pkcs7.Parse(der)
+			require.NoError(t, err)
+			content, err := p7.Decrypt(f.ca, f.caKey)
+			require.NoError(t, err, "pkcs7 should decrypt the envelope")
+			assert.Equal(t, "request content", string(content))
+		})
+	}
+}
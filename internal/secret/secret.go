@@ -0,0 +1,106 @@
+package secret
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"golang.org/x/term"
+)
+
+// stdin and stderr are where prompted secrets are read and asked for.
+var (
+	stdin  io.Reader = os.Stdin
+	stderr io.Writer = os.Stderr
+)
+
+// Resolve reads a passphrase from the configured source. Sources are tried in
+// the order environment variable, file, command and prompt. A trailing
+// newline in the file is ignored, and only the first line of command output is
+// used. A source yielding an empty value is an error; an empty string is
+// returned only when no source is configured.
+func Resolve(src config.PassphraseConfig) (string, error) {
+	if src.Env != "" {
+		value, ok := os.LookupEnv(src.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", src.Env)
+		}
+		if value == "" {
+			return "", fmt.Errorf("environment variable %s is empty", src.Env)
+		}
+		return value, nil
+	}
+	if src.File != "" {
+		data, err := os.ReadFile(src.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+		value := strings.TrimRight(string(data), "\r\n")
+		if value == "" {
+			return "", errors.New("passphrase file is empty")
+		}
+		return value, nil
+	}
+	if src.Command != "" {
+		return run(src.Command)
+	}
+	if src.Prompt {
+		return prompt()
+	}
+	return "", nil
+}
+
+// run executes command, split on whitespace, and returns its first line of
+// output.
+func run(command string) (string, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return "", errors.New("passphrase command is empty")
+	}
+	var out, errOut bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(errOut.String()); msg != "" {
+			return "", fmt.Errorf("passphrase command failed: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("passphrase command failed: %w", err)
+	}
+	value, _, _ := strings.Cut(out.String(), "\n")
+	value = strings.TrimRight(value, "\r")
+	if value == "" {
+		return "", errors.New("passphrase command printed nothing")
+	}
+	return value, nil
+}
+
+// prompt asks for the passphrase on stderr and reads it from stdin, without
+// echo when stdin is a terminal.
+func prompt() (string, error) {
+	fmt.Fprint(stderr, "Passphrase: ")
+	var value string
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		data, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		value = string(data)
+	} else {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		value = strings.TrimRight(line, "\r\n")
+	}
+	if value == "" {
+		return "", errors.New("no passphrase entered")
+	}
+	return value, nil
+}
@@ -0,0 +1,82 @@
+package secret
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResolve_Env tests reading a passphrase from an environment variable.
+func TestResolve_Env(t *testing.T) {
+	t.Setenv("TEST_PASSPHRASE", "from-env")
+
+	value, err := Resolve(config.PassphraseConfig{Env: "TEST_PASSPHRASE", File: "ignored"})
+	require.NoError(t, err, "Resolve should not return an error")
+	assert.Equal(t, "from-env", value, "Environment variable should take precedence")
+
+	_, err = Resolve(config.PassphraseConfig{Env: "TEST_PASSPHRASE_UNSET"})
+	assert.EqualError(t, err, "environment variable TEST_PASSPHRASE_UNSET is not set", "Expected specific error message")
+
+	t.Setenv("TEST_PASSPHRASE_EMPTY", "")
+	_, err = Resolve(config.PassphraseConfig{Env: "TEST_PASSPHRASE_EMPTY"})
+	assert.EqualError(t, err, "environment variable TEST_PASSPHRASE_EMPTY is empty", "An empty passphrase should be rejected")
+}
+
+// TestResolve_File tests reading a passphrase from a file.
+func TestResolve_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passphrase")
+	require.NoError(t, os.WriteFile(path, []byte("from-file\n"), 0600))
+
+	value, err := Resolve(config.PassphraseConfig{File: path})
+	require.NoError(t, err, "Resolve should not return an error")
+	assert.Equal(t, "from-file", value, "Trailing newline should be trimmed")
+
+	require.NoError(t, os.WriteFile(path, []byte("\n"), 0600))
+	_, err = Resolve(config.PassphraseConfig{File: path})
+	assert.EqualError(t, err, "passphrase file is empty", "Expected specific error message")
+}
+
+// TestResolve_None tests that no source yields an empty passphrase.
+func TestResolve_None(t *testing.T) {
+	value, err := Resolve(config.PassphraseConfig{})
+	require.NoError(t, err, "Resolve should not return an error")
+	assert.Empty(t, value, "Expected an empty passphrase")
+}
+
+// TestResolve_Command tests reading a passphrase from a command's output.
+func TestResolve_Command(t *testing.T) {
+	value, err := Resolve(config.PassphraseConfig{Command: "echo from-command"})
+	require.NoError(t, err, "Resolve should not return an error")
+	assert.Equal(t, "from-command", value, "Expected the first line of output")
+
+	_, err = Resolve(config.PassphraseConfig{Command: "false"})
+	assert.ErrorContains(t, err, "passphrase command failed", "Expected specific error message")
+
+	_, err = Resolve(config.PassphraseConfig{Command: "true"})
+	assert.EqualError(t, err, "passphrase command printed nothing", "Expected specific error message")
+
+	_, err = Resolve(config.PassphraseConfig{Command: " \t"})
+	assert.EqualError(t, err, "passphrase command is empty", "Expected specific error message")
+}
+
+// TestResolve_Prompt tests reading a passphrase from stdin when it is not a terminal.
+func TestResolve_Prompt(t *testing.T) {
+	var out bytes.Buffer
+	stdin, stderr = strings.NewReader("typed\n"), &out
+	t.Cleanup(func() { stdin, stderr = os.Stdin, os.Stderr })
+
+	value, err := Resolve(config.PassphraseConfig{Prompt: true})
+	require.NoError(t, err, "Resolve should not return an error")
+	assert.Equal(t, "typed", value, "Expected the entered line")
+	assert.Equal(t, "Passphrase: ", out.String(), "Expected the prompt on stderr")
+
+	stdin = strings.NewReader("\n")
+	_, err = Resolve(config.PassphraseConfig{Prompt: true})
+	assert.EqualError(t, err, "no passphrase entered", "Expected specific error message")
+}
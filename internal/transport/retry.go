@@ -0,0 +1,208 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+)
+
+// maxDrain limits how much of a discarded response is read so the connection can be reused.
+const maxDrain = 4 << 10
+
+// retryTransport retries requests that fail with a transport error or a
+// retryable status, bounding each attempt by the request timeout. Requests
+// that are not idempotent are retried only when they cannot have been
+// processed, as described by shouldRetry.
+type retryTransport struct {
+	base  http.RoundTripper
+	cfg   config.RetryConfig
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := max(t.cfg.MaxAttempts, 1)
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		attempts = 1 // The body cannot be sent again
+	}
+	ctx := req.Context()
+
+	for n := 1; ; n++ {
+		resp, err := t.attempt(req, n)
+		if !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+		if n == attempts || ctx.Err() != nil {
+			if err != nil && n > 1 {
+				err = fmt.Errorf("giving up after %d attempts: %w", n, err)
+			}
+			return resp, err
+		}
+
+		wait := Backoff(t.cfg, n, resp)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return resp, err // The retry would start after the overall deadline
+		}
+		if resp != nil {
+			_, _ = io.CopyN(io.Discard, resp.Body, maxDrain)
+			resp.Body.Close()
+		}
+		if err := t.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends attempt n of req, replaying the body after the first.
+func (t *retryTransport) attempt(req *http.Request, n int) (*http.Response, error) {
+	r := req
+	if n > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r = req.Clone(req.Context())
+		r.Body = body
+	}
+	if t.cfg.RequestTimeout <= 0 {
+		return t.base.RoundTrip(r)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), t.cfg.RequestTimeout)
+	resp, err := t.base.RoundTrip(r.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the attempt's timeout once the response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// shouldRetry reports whether an attempt of req that returned resp or err may
+// be sent again. A request that is not idempotent, such as a CSR POST, may
+// have been processed even though its response was lost or a gateway failed,
+// and sending it again could issue a second certificate. It is retried only
+// when no connection could be made, or when the CA answered that it did not
+// handle the request: 408, 429 or 503.
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if idempotent(req.Method) {
+		return err != nil || Retryable(resp.StatusCode)
+	}
+	if err != nil {
+		return unsent(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// idempotent reports whether a request with method can be sent twice with the
+// same effect as once (RFC 9110 section 9.2.2).
+func idempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// unsent reports whether err happened before the request could be written:
+// the host was not found or the connection was refused.
+func unsent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// Retryable reports whether a response with the given status is worth
+// retrying: the CA or a proxy in front of it is busy, rate limiting or down
+// for maintenance.
+func Retryable(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Backoff returns how long to wait before retry n, where the first retry is 1.
+// A Retry-After header on resp is honoured up to cfg.MaxBackoff, so a CA
+// asking for hours does not stall the command. Otherwise the wait starts at
+// cfg.InitialBackoff, doubles for each retry up to cfg.MaxBackoff, and is
+// reduced by up to half at random so many clients do not retry in step.
+func Backoff(cfg config.RetryConfig, n int, resp *http.Response) time.Duration {
+	if d, ok := RetryAfter(resp, time.Now()); ok {
+		if cfg.MaxBackoff > 0 && d > cfg.MaxBackoff {
+			return cfg.MaxBackoff
+		}
+		return d
+	}
+	d := cfg.InitialBackoff
+	for i := 1; i < n && d < math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if cfg.MaxBackoff > 0 && d > cfg.MaxBackoff {
+		d = cfg.MaxBackoff
+	}
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int64N(int64(d/2)+1))
+}
+
+// RetryAfter returns the wait requested by the Retry-After header of resp,
+// given in seconds or as an HTTP date.
+func RetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
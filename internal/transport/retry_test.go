@@ -0,0 +1,287 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer answers with the given statuses in turn, then 200, recording request bodies.
+type flakyServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	header   http.Header
+	delay    time.Duration // Delay before answering the first request
+	bodies   []string
+}
+
+func newFlakyServer(t *testing.T, statuses ...int) *flakyServer {
+	t.Helper()
+	f := &flakyServer{statuses: statuses, header: http.Header{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		f.bodies = append(f.bodies, string(body))
+		n := len(f.bodies)
+		f.mu.Unlock()
+		if n == 1 && f.delay > 0 {
+			select {
+			case <-time.After(f.delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if n <= len(f.statuses) {
+			for k, v := range f.header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(f.statuses[n-1])
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// newTestClient returns a retrying client whose waits are recorded instead of slept.
+func newTestClient(cfg config.RetryConfig) (*http.Client, *[]time.Duration) {
+	var waits []time.Duration
+	return &http.Client{Transport: &retryTransport{
+		base: http.DefaultTransport,
+		cfg:  cfg,
+		sleep: func(_ context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		},
+	}}, &waits
+}
+
+// TestRetry_Succeeds tests retrying unavailable responses and replaying the request body.
+func TestRetry_Succeeds(t *testing.T) {
+	srv := newFlakyServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	client, waits := newTestClient(config.RetryConfig{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Minute})
+
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("csr"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"csr", "csr", "csr"}, srv.bodies, "Expected the body to be sent on every attempt")
+	require.Len(t, *waits, 2)
+	assert.True(t, (*waits)[0] >= 500*time.Millisecond && (*waits)[0] <= time.Second, "First wait %s outside [0.5s, 1s]", (*waits)[0])
+	assert.True(t, (*waits)[1] >= time.Second && (*waits)[1] <= 2*time.Second, "Second wait %s outside [1s, 2s]", (*waits)[1])
+}
+
+// TestRetry_GivesUp tests returning the last response once the attempts are used up.
+func TestRetry_GivesUp(t *testing.T) {
+	srv := newFlakyServer(t, 503, 503, 503, 503)
+	client, waits := newTestClient(config.RetryConfig{MaxAttempts: 3})
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Len(t, srv.bodies, 3)
+	assert.Len(t, *waits, 2)
+}
+
+// TestRetry_NotRetryable tests that client errors are returned at once.
+func TestRetry_NotRetryable(t *testing.T) {
+	srv := newFlakyServer(t, http.StatusBadRequest)
+	client, _ := newTestClient(config.RetryConfig{MaxAttempts: 5})
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Len(t, srv.bodies, 1)
+}
+
+// TestRetry_NotIdempotent tests that a POST is sent again only for statuses
+// saying the CA did not handle it, while a GET is retried on any gateway error.
+func TestRetry_NotIdempotent(t *testing.T) {
+	tests := map[string]struct {
+		method   string
+		status   int
+		attempts int
+	}{
+		"post bad gateway":     {http.MethodPost, http.StatusBadGateway, 1},
+		"post gateway timeout": {http.MethodPost, http.StatusGatewayTimeout, 1},
+		"post unavailable":     {http.MethodPost, http.StatusServiceUnavailable, 2},
+		"post rate limited":    {http.MethodPost, http.StatusTooManyRequests, 2},
+		"post request timeout": {http.MethodPost, http.StatusRequestTimeout, 2},
+		"get bad gateway":      {http.MethodGet, http.StatusBadGateway, 2},
+		"get gateway timeout":  {http.MethodGet, http.StatusGatewayTimeout, 2},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newFlakyServer(t, tt.status)
+			client, _ := newTestClient(config.RetryConfig{MaxAttempts: 3})
+
+			req, err := http.NewRequest(tt.method, srv.URL, strings.NewReader("csr"))
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Len(t, srv.bodies, tt.attempts)
+		})
+	}
+}
+
+// TestRetry_ConnectionErrors tests that a POST is sent again after a refused
+// connection, but not after the connection dropped once it was written.
+func TestRetry_ConnectionErrors(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack failed: %v", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		method   string
+		attempts int
+	}{
+		{http.MethodPost, 1},
+		{http.MethodGet, 3},
+	} {
+		requests = 0
+		client, _ := newTestClient(config.RetryConfig{MaxAttempts: 3})
+		req, err := http.NewRequest(tt.method, srv.URL, strings.NewReader("csr"))
+		require.NoError(t, err)
+		_, err = client.Do(req)
+		assert.Error(t, err, "Expected the dropped connection to be reported")
+		assert.Equal(t, tt.attempts, requests, "Unexpected attempts for %s", tt.method)
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	client, waits := newTestClient(config.RetryConfig{MaxAttempts: 3})
+	_, err := client.Post(closed.URL, "text/plain", strings.NewReader("csr"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "giving up after 3 attempts", "A refused connection never reached the CA")
+	assert.Len(t, *waits, 2)
+}
+
+// TestRetry_RetryAfter tests honouring Retry-After instead of the backoff, up
+// to the maximum backoff.
+func TestRetry_RetryAfter(t *testing.T) {
+	srv := newFlakyServer(t, http.StatusTooManyRequests, http.StatusServiceUnavailable)
+	srv.header.Set("Retry-After", "30")
+	client, waits := newTestClient(config.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Minute})
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []time.Duration{30 * time.Second, 30 * time.Second}, *waits)
+
+	srv = newFlakyServer(t, http.StatusServiceUnavailable)
+	srv.header.Set("Retry-After", "86400")
+	client, waits = newTestClient(config.RetryConfig{MaxAttempts: 2, InitialBackoff: time.Second, MaxBackoff: time.Minute})
+	resp, err = client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []time.Duration{time.Minute}, *waits, "A day-long Retry-After should be capped at max_backoff")
+}
+
+// TestRetry_Deadline tests not waiting for a retry that would start after the context deadline.
+func TestRetry_Deadline(t *testing.T) {
+	srv := newFlakyServer(t, http.StatusServiceUnavailable)
+	srv.header.Set("Retry-After", "3600")
+	client, waits := newTestClient(config.RetryConfig{MaxAttempts: 5})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Empty(t, *waits)
+}
+
+// TestRetry_RequestTimeout tests bounding each attempt and retrying one that timed out.
+func TestRetry_RequestTimeout(t *testing.T) {
+	srv := newFlakyServer(t)
+	srv.delay = 5 * time.Second
+	client, waits := newTestClient(config.RetryConfig{MaxAttempts: 2, RequestTimeout: 100 * time.Millisecond})
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err, "The body should be readable until it is closed")
+	assert.Equal(t, "ok", string(body))
+	assert.Len(t, *waits, 1)
+
+	client, _ = newTestClient(config.RetryConfig{MaxAttempts: 1, RequestTimeout: 100 * time.Millisecond})
+	srv.bodies = nil
+	_, err = client.Get(srv.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// TestBackoff tests exponential growth, the cap and jitter.
+func TestBackoff(t *testing.T) {
+	cfg := config.RetryConfig{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	tests := map[int][2]time.Duration{
+		1:  {500 * time.Millisecond, time.Second},
+		3:  {2 * time.Second, 4 * time.Second},
+		10: {5 * time.Second, 10 * time.Second},
+		80: {5 * time.Second, 10 * time.Second},
+	}
+	for n, bounds := range tests {
+		for range 20 {
+			d := Backoff(cfg, n, nil)
+			assert.True(t, d >= bounds[0] && d <= bounds[1], "Backoff(%d) = %s outside [%s, %s]", n, d, bounds[0], bounds[1])
+		}
+	}
+	assert.Zero(t, Backoff(config.RetryConfig{}, 3, nil), "No backoff configured should retry at once")
+}
+
+// TestRetryAfter tests parsing Retry-After in seconds and as an HTTP date.
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := map[string]struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		"seconds": {"30", 30 * time.Second, true},
+		"date":    {now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		"past":    {now.Add(-time.Hour).Format(http.TimeFormat), 0, true},
+		"missing": {"", 0, false},
+		"invalid": {"soon", 0, false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.value != "" {
+				resp.Header.Set("Retry-After", tt.value)
+			}
+			got, ok := RetryAfter(resp, now)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+)
+
+// versions maps tls.min_version values to TLS protocol versions.
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewHTTPClient returns an HTTP client for CA connections that uses the TLS
+// settings in tlsCfg and retries failed requests as described by retryCfg.
+// Each attempt is bounded by retryCfg.RequestTimeout; bound the whole request,
+// retries included, with a deadline on its context.
+func NewHTTPClient(tlsCfg config.TLSConfig, retryCfg config.RetryConfig) (*http.Client, error) {
+	tlsConfig, err := NewTLSConfig(tlsCfg)
+	if err != nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: &retryTransport{base: t, cfg: retryCfg, sleep: sleep}}, nil
+}
+
+// NewTLSConfig builds a client TLS configuration from cfg. CA bundles are
+// added to a copy of the system roots, so the system trust store is never
+// modified.
+func NewTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	minVersion := uint16(tls.VersionTLS12)
+	if cfg.MinVersion != "" {
+		v, ok := versions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version: %s", cfg.MinVersion)
+		}
+		minVersion = v
+	}
+	tlsConfig := &tls.Config{MinVersion: minVersion, ServerName: cfg.ServerName}
+
+	if len(cfg.CABundles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool() // No system roots on this platform
+		}
+		for _, path := range cfg.CABundles {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// WithClientCert returns a copy of httpClient that presents cert during TLS
+// handshakes, replacing any client certificate from the tls section.
+func WithClientCert(httpClient *http.Client, cert tls.Certificate) (*http.Client, error) {
+	client := *httpClient
+	switch t := httpClient.Transport.(type) {
+	case nil:
+		client.Transport = withCert(http.DefaultTransport.(*http.Transport), cert)
+	case *http.Transport:
+		client.Transport = withCert(t, cert)
+	case *retryTransport:
+		rt := *t
+		base, ok := t.base.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("cannot add a client certificate to transport %T", t.base)
+		}
+		rt.base = withCert(base, cert)
+		client.Transport = &rt
+	default:
+		return nil, fmt.Errorf("cannot add a client certificate to transport %T", t)
+	}
+	return &client, nil
+}
+
+// withCert returns a copy of t that presents cert.
+func withCert(t *http.Transport, cert tls.Certificate) *http.Transport {
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	return t
+}
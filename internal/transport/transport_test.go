@@ -0,0 +1,228 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues certificates from a private root for testing.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCA creates a private root certificate.
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Network Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a TLS certificate for the given DNS name, IP addresses and usage.
+func (ca *testCA) issue(t *testing.T, name string, ips []net.IP, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  ips,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writePEM writes a TLS certificate and its key as PEM files and returns their paths.
+func writePEM(t *testing.T, cert tls.Certificate) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+	certPath, keyPath := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0644))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certPath, keyPath
+}
+
+// newServer starts a TLS server presenting a certificate from ca for ca.internal and 127.0.0.1.
+func newServer(t *testing.T, ca *testCA, configure func(*tls.Config)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Header().Set("X-Client", r.TLS.PeerCertificates[0].Subject.CommonName)
+		}
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "ca.internal", []net.IP{net.ParseIP("127.0.0.1")}, x509.ExtKeyUsageServerAuth)},
+	}
+	if configure != nil {
+		configure(srv.TLS)
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// bundleFile writes the root certificate of ca to a PEM file.
+func bundleFile(t *testing.T, ca *testCA) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "root.crt")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0644))
+	return path
+}
+
+// TestNewHTTPClient_CABundle tests trusting a private root only when it is configured.
+func TestNewHTTPClient_CABundle(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newServer(t, ca, nil)
+
+	client, err := NewHTTPClient(config.TLSConfig{}, config.RetryConfig{})
+	require.NoError(t, err)
+	_, err = client.Get(srv.URL)
+	require.Error(t, err, "The private root should not be trusted by default")
+
+	client, err = NewHTTPClient(config.TLSConfig{CABundles: []string{bundleFile(t, ca)}}, config.RetryConfig{})
+	require.NoError(t, err)
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err, "The configured CA bundle should be trusted")
+	resp.Body.Close()
+}
+
+// TestNewHTTPClient_ClientCert tests presenting a client certificate for mutual TLS.
+func TestNewHTTPClient_ClientCert(t *testing.T) {
+	ca := newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	srv := newServer(t, ca, func(c *tls.Config) {
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		c.ClientCAs = pool
+	})
+	certPath, keyPath := writePEM(t, ca.issue(t, "host.example.com", nil, x509.ExtKeyUsageClientAuth))
+
+	client, err := NewHTTPClient(config.TLSConfig{
+		CABundles:  []string{bundleFile(t, ca)},
+		ClientCert: certPath,
+		ClientKey:  keyPath,
+	}, config.RetryConfig{})
+	require.NoError(t, err)
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err, "The server should accept the client certificate")
+	resp.Body.Close()
+	assert.Equal(t, "host.example.com", resp.Header.Get("X-Client"))
+}
+
+// TestWithClientCert tests adding a client certificate to a retrying client.
+func TestWithClientCert(t *testing.T) {
+	ca := newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	srv := newServer(t, ca, func(c *tls.Config) {
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		c.ClientCAs = pool
+	})
+
+	client, err := NewHTTPClient(config.TLSConfig{CABundles: []string{bundleFile(t, ca)}}, config.RetryConfig{MaxAttempts: 3})
+	require.NoError(t, err)
+	client, err = WithClientCert(client, ca.issue(t, "enrolled.example.com", nil, x509.ExtKeyUsageClientAuth))
+	require.NoError(t, err)
+	require.IsType(t, &retryTransport{}, client.Transport, "The client should still retry")
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err, "The server should accept the added client certificate")
+	resp.Body.Close()
+	assert.Equal(t, "enrolled.example.com", resp.Header.Get("X-Client"))
+}
+
+// TestNewHTTPClient_ServerName tests verifying the server against an overridden name.
+func TestNewHTTPClient_ServerName(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newServer(t, ca, nil)
+	bundle := bundleFile(t, ca)
+
+	client, err := NewHTTPClient(config.TLSConfig{CABundles: []string{bundle}, ServerName: "ca.internal"}, config.RetryConfig{})
+	require.NoError(t, err)
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err, "The certificate is valid for ca.internal")
+	resp.Body.Close()
+
+	client, err = NewHTTPClient(config.TLSConfig{CABundles: []string{bundle}, ServerName: "other.internal"}, config.RetryConfig{})
+	require.NoError(t, err)
+	_, err = client.Get(srv.URL)
+	assert.Error(t, err, "The certificate is not valid for other.internal")
+}
+
+// TestNewHTTPClient_MinVersion tests refusing servers below the minimum version.
+func TestNewHTTPClient_MinVersion(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newServer(t, ca, func(c *tls.Config) { c.MaxVersion = tls.VersionTLS12 })
+	bundle := bundleFile(t, ca)
+
+	client, err := NewHTTPClient(config.TLSConfig{CABundles: []string{bundle}, MinVersion: "1.3"}, config.RetryConfig{})
+	require.NoError(t, err)
+	_, err = client.Get(srv.URL)
+	assert.Error(t, err, "A TLS 1.2 server should be refused")
+
+	client, err = NewHTTPClient(config.TLSConfig{CABundles: []string{bundle}}, config.RetryConfig{})
+	require.NoError(t, err)
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err, "TLS 1.2 is accepted by default")
+	resp.Body.Close()
+}
+
+// TestNewTLSConfig_Errors tests reporting unusable settings.
+func TestNewTLSConfig_Errors(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.crt")
+	require.NoError(t, os.WriteFile(empty, []byte("not a certificate"), 0644))
+
+	tests := map[string]struct {
+		cfg     config.TLSConfig
+		wantErr string
+	}{
+		"version":        {config.TLSConfig{MinVersion: "2.0"}, "unsupported TLS version: 2.0"},
+		"missing bundle": {config.TLSConfig{CABundles: []string{"/nonexistent/root.crt"}}, "failed to read CA bundle"},
+		"empty bundle":   {config.TLSConfig{CABundles: []string{empty}}, "no certificates found in CA bundle"},
+		"client cert":    {config.TLSConfig{ClientCert: "/nonexistent/client.crt", ClientKey: "/nonexistent/client.key"}, "failed to load TLS client certificate"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewTLSConfig(tt.cfg)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
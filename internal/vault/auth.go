@@ -0,0 +1,60 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dstout-devops/hephaestus/internal/secret"
+)
+
+// loginResponse holds the fields of an auth login response that are used.
+type loginResponse struct {
+	Auth struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+}
+
+// login returns a Vault token for the configured auth method.
+func (c *Client) login(ctx context.Context) (string, error) {
+	a := c.cfg.Auth
+	switch a.Method {
+	case "", "token":
+		token, err := secret.Resolve(a.Token)
+		if err != nil {
+			return "", fmt.Errorf("failed to read Vault token: %w", err)
+		}
+		return token, nil
+	case "approle":
+		secretID, err := secret.Resolve(a.SecretID)
+		if err != nil {
+			return "", fmt.Errorf("failed to read AppRole secret ID: %w", err)
+		}
+		return c.loginWith(ctx, "approle", map[string]string{"role_id": a.RoleID, "secret_id": secretID})
+	case "kubernetes":
+		jwt, err := os.ReadFile(a.JWTFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read service account token: %w", err)
+		}
+		return c.loginWith(ctx, "kubernetes", map[string]string{"role": a.Role, "jwt": strings.TrimSpace(string(jwt))})
+	default:
+		return "", fmt.Errorf("unsupported Vault auth method: %s", a.Method)
+	}
+}
+
+// loginWith logs in at auth/<mount>/login, where mount defaults to the method name.
+func (c *Client) loginWith(ctx context.Context, method string, body map[string]string) (string, error) {
+	mount := strings.Trim(c.cfg.Auth.Mount, "/")
+	if mount == "" {
+		mount = method
+	}
+	var res loginResponse
+	if err := c.post(ctx, "auth/"+mount+"/login", "", body, &res); err != nil {
+		return "", fmt.Errorf("%s login failed: %w", method, err)
+	}
+	if res.Auth.ClientToken == "" {
+		return "", fmt.Errorf("%s login failed: response contains no client token", method)
+	}
+	return res.Auth.ClientToken, nil
+}
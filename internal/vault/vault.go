@@ -0,0 +1,140 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/dstout-devops/hephaestus/internal/config"
+)
+
+const (
+	// defaultTimeout bounds each request when no HTTP client is supplied.
+	defaultTimeout = 30 * time.Second
+	// maxErrorBody limits how much of an unparseable error body is reported.
+	maxErrorBody = 512
+)
+
+// signRequest is the body of a pki/sign/<role> request.
+type signRequest struct {
+	CSR    string `json:"csr"`
+	Format string `json:"format"`
+	TTL    string `json:"ttl,omitempty"`
+}
+
+// signResponse holds the fields of a pki/sign/<role> response that are used.
+type signResponse struct {
+	Data struct {
+		Certificate  string   `json:"certificate"`
+		IssuingCA    string   `json:"issuing_ca"`
+		CAChain      []string `json:"ca_chain"`
+		SerialNumber string   `json:"serial_number"`
+	} `json:"data"`
+}
+
+// Client signs CSRs with the Vault PKI secrets engine.
+type Client struct {
+	httpClient *http.Client
+	cfg        config.VaultConfig
+}
+
+// NewClient creates a new Client. A nil httpClient uses a client with a default timeout.
+func NewClient(httpClient *http.Client, cfg config.VaultConfig) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+	return &Client{httpClient: httpClient, cfg: cfg}
+}
+
+// Submit authenticates to Vault, signs the PEM-encoded CSR with pki/sign/<role>
+// and returns the certificate with ca_chain, or issuing_ca when the chain is empty.
+func (c *Client) Submit(ctx context.Context, csrPEM []byte) (*certs.Bundle, error) {
+	if c.cfg.Address == "" {
+		return nil, errors.New("no Vault address configured")
+	}
+	token, err := c.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := signRequest{CSR: string(csrPEM), Format: "pem"}
+	if c.cfg.TTL > 0 {
+		req.TTL = c.cfg.TTL.String()
+	}
+	var res signResponse
+	path := fmt.Sprintf("%s/sign/%s", c.mount(), c.cfg.Role)
+	if err := c.post(ctx, path, token, req, &res); err != nil {
+		return nil, fmt.Errorf("sign failed: %w", err)
+	}
+	if res.Data.Certificate == "" {
+		return nil, errors.New("sign failed: response contains no certificate")
+	}
+
+	chain := res.Data.CAChain
+	if len(chain) == 0 && res.Data.IssuingCA != "" {
+		chain = []string{res.Data.IssuingCA}
+	}
+	pemData := strings.Join(append([]string{res.Data.Certificate}, chain...), "\n")
+	return certs.ParsePEM([]byte(pemData))
+}
+
+// mount returns the PKI mount path without surrounding slashes.
+func (c *Client) mount() string {
+	if m := strings.Trim(c.cfg.Mount, "/"); m != "" {
+		return m
+	}
+	return "pki"
+}
+
+// post sends body as JSON to the Vault API path and decodes the response into out.
+func (c *Client) post(ctx context.Context, path, token string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	u := strings.TrimSuffix(c.cfg.Address, "/") + "/v1/" + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.cfg.Namespace)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return responseError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// responseError describes a failed response using Vault's errors list when present.
+func responseError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var body struct {
+		Errors []string `json:"errors"`
+	}
+	if json.Unmarshal(msg, &body) == nil && len(body.Errors) > 0 {
+		return fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(body.Errors, "; "))
+	}
+	return fmt.Errorf("vault returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
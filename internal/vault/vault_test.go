@@ -0,0 +1,214 @@
+package vault
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCSR creates a PEM-encoded CSR for testing.
+func newCSR(t *testing.T, cn string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate key")
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: cn},
+	}, key)
+	require.NoError(t, err, "failed to create CSR")
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+// encodePEM PEM-encodes a DER certificate.
+func encodePEM(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// fakeVault stands in for the Vault login and pki/sign endpoints.
+type fakeVault struct {
+	*httptest.Server
+	ca        *x509.Certificate
+	logins    map[string]map[string]string // Login bodies by path
+	sign      signRequest                  // Last sign request
+	token     string                       // Token presented to sign
+	namespace string                       // Namespace presented to sign
+	noChain   bool                         // Omit ca_chain from sign responses
+}
+
+// newFakeVault starts a Vault stand-in with a PKI mount at pki and a role named web.
+func newFakeVault(t *testing.T) *fakeVault {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Vault CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	f := &fakeVault{ca: ca, logins: map[string]map[string]string{}}
+	mux := http.NewServeMux()
+	login := func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		f.logins[r.URL.Path] = body
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]string{"client_token": "s.login"}})
+	}
+	mux.HandleFunc("/v1/auth/approle/login", login)
+	mux.HandleFunc("/v1/auth/k8s/login", login)
+	mux.HandleFunc("/v1/pki/sign/web", func(w http.ResponseWriter, r *http.Request) {
+		f.token = r.Header.Get("X-Vault-Token")
+		f.namespace = r.Header.Get("X-Vault-Namespace")
+		if f.token != "s.root" && f.token != "s.login" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&f.sign))
+		block, _ := pem.Decode([]byte(f.sign.CSR))
+		require.NotNil(t, block)
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		require.NoError(t, err)
+
+		leaf := &x509.Certificate{
+			SerialNumber: big.NewInt(42),
+			Subject:      csr.Subject,
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, leaf, ca, csr.PublicKey, caKey)
+		require.NoError(t, err)
+
+		data := map[string]interface{}{
+			"certificate":   encodePEM(der),
+			"issuing_ca":    encodePEM(ca.Raw),
+			"serial_number": "00:2a",
+		}
+		if !f.noChain {
+			data["ca_chain"] = []string{encodePEM(ca.Raw)}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// TestSubmit_Token tests signing with a token, namespace and TTL.
+func TestSubmit_Token(t *testing.T) {
+	f := newFakeVault(t)
+	t.Setenv("TEST_VAULT_TOKEN", "s.root")
+
+	client := NewClient(f.Client(), config.VaultConfig{
+		Address:   f.URL,
+		Namespace: "team-a",
+		Mount:     "/pki/",
+		Role:      "web",
+		TTL:       72 * time.Hour,
+		Auth:      config.VaultAuthConfig{Token: config.PassphraseConfig{Env: "TEST_VAULT_TOKEN"}},
+	})
+	bundle, err := client.Submit(context.Background(), newCSR(t, "web.example.com"))
+	require.NoError(t, err, "Submit should succeed")
+
+	assert.Equal(t, "s.root", f.token)
+	assert.Equal(t, "team-a", f.namespace)
+	assert.Equal(t, "pem", f.sign.Format)
+	assert.Equal(t, "72h0m0s", f.sign.TTL)
+	assert.Equal(t, "web.example.com", bundle.Certificate.Subject.CommonName)
+	require.Len(t, bundle.Chain, 1, "Expected ca_chain as the chain")
+	assert.True(t, bundle.Chain[0].Equal(f.ca))
+}
+
+// TestSubmit_AppRole tests logging in with AppRole before signing.
+func TestSubmit_AppRole(t *testing.T) {
+	f := newFakeVault(t)
+	f.noChain = true
+	secretFile := filepath.Join(t.TempDir(), "secret-id")
+	require.NoError(t, os.WriteFile(secretFile, []byte("secret-123\n"), 0600))
+
+	client := NewClient(f.Client(), config.VaultConfig{
+		Address: f.URL,
+		Role:    "web",
+		Auth: config.VaultAuthConfig{
+			Method:   "approle",
+			RoleID:   "role-abc",
+			SecretID: config.PassphraseConfig{File: secretFile},
+		},
+	})
+	bundle, err := client.Submit(context.Background(), newCSR(t, "web.example.com"))
+	require.NoError(t, err, "Submit should succeed")
+
+	assert.Equal(t, map[string]string{"role_id": "role-abc", "secret_id": "secret-123"}, f.logins["/v1/auth/approle/login"])
+	assert.Equal(t, "s.login", f.token, "Expected the login token to be used for signing")
+	require.Len(t, bundle.Chain, 1, "Expected issuing_ca as the chain when ca_chain is empty")
+	assert.True(t, bundle.Chain[0].Equal(f.ca))
+}
+
+// TestSubmit_Kubernetes tests logging in with a service account token at a custom mount.
+func TestSubmit_Kubernetes(t *testing.T) {
+	f := newFakeVault(t)
+	jwtFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(jwtFile, []byte("eyJhbGciOi.jwt\n"), 0600))
+
+	client := NewClient(f.Client(), config.VaultConfig{
+		Address: f.URL,
+		Role:    "web",
+		Auth:    config.VaultAuthConfig{Method: "kubernetes", Mount: "k8s", Role: "hephaestus", JWTFile: jwtFile},
+	})
+	_, err := client.Submit(context.Background(), newCSR(t, "web.example.com"))
+	require.NoError(t, err, "Submit should succeed")
+	assert.Equal(t, map[string]string{"role": "hephaestus", "jwt": "eyJhbGciOi.jwt"}, f.logins["/v1/auth/k8s/login"])
+	assert.Equal(t, "s.login", f.token)
+}
+
+// TestSubmit_Denied tests that Vault's error messages are reported.
+func TestSubmit_Denied(t *testing.T) {
+	f := newFakeVault(t)
+	t.Setenv("TEST_VAULT_TOKEN", "s.wrong")
+
+	client := NewClient(f.Client(), config.VaultConfig{
+		Address: f.URL,
+		Role:    "web",
+		Auth:    config.VaultAuthConfig{Token: config.PassphraseConfig{Env: "TEST_VAULT_TOKEN"}},
+	})
+	_, err := client.Submit(context.Background(), newCSR(t, "web.example.com"))
+	assert.EqualError(t, err, "sign failed: vault returned 403 Forbidden: permission denied")
+}
+
+// TestSubmit_EmptyToken tests that an empty token variable is an error rather
+// than an unauthenticated request.
+func TestSubmit_EmptyToken(t *testing.T) {
+	f := newFakeVault(t)
+	t.Setenv("TEST_VAULT_TOKEN", "")
+
+	client := NewClient(f.Client(), config.VaultConfig{
+		Address: f.URL,
+		Role:    "web",
+		Auth:    config.VaultAuthConfig{Token: config.PassphraseConfig{Env: "TEST_VAULT_TOKEN"}},
+	})
+	_, err := client.Submit(context.Background(), newCSR(t, "web.example.com"))
+	assert.EqualError(t, err, "failed to read Vault token: environment variable TEST_VAULT_TOKEN is empty")
+	assert.Empty(t, f.token, "Nothing should be signed")
+}
@@ -0,0 +1,224 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+)
+
+// Mismatch is one way an issued certificate differs from what was requested.
+type Mismatch struct {
+	Field string // Name of the checked property, e.g. "subject.common_name"
+	Want  string
+	Got   string
+}
+
+// Error lists every mismatch found by Certificate.
+type Error struct {
+	Mismatches []Mismatch
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("issued certificate does not match the request:")
+	for _, m := range e.Mismatches {
+		fmt.Fprintf(&b, "\n  %s: want %s, got %s", m.Field, m.Want, m.Got)
+	}
+	return b.String()
+}
+
+// Subject check modes for Options.Subject.
+const (
+	SubjectStrict = "strict" // Every subject attribute of the request must be carried
+	SubjectCN     = "cn"     // Only the common name must be carried
+	SubjectNone   = "none"   // The subject is not checked
+)
+
+// Options controls the checks made by Certificate.
+type Options struct {
+	Roots     *x509.CertPool // Trust anchors the certificate must chain to; the chain is not checked when nil
+	Now       time.Time      // Time the validity period is checked against
+	ClockSkew time.Duration  // Tolerance for a NotBefore slightly after Now
+	Subject   string         // Subject check mode, SubjectStrict when empty
+}
+
+// Certificate checks that the leaf of bundle is for pub, carries the subject
+// and SANs requested in csr, chains to opts.Roots, is currently valid and is
+// an end-entity certificate whose key usage fits its key. Subject and SANs are
+// not checked when csr is nil, and opts.Subject limits the subject check. All
+// problems are reported in one *Error.
+func Certificate(bundle *certs.Bundle, pub crypto.PublicKey, csr *x509.CertificateRequest, opts Options) error {
+	cert := bundle.Certificate
+	var errs []Mismatch
+	add := func(field, want, got string) {
+		errs = append(errs, Mismatch{Field: field, Want: want, Got: got})
+	}
+
+	if k, ok := pub.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(cert.PublicKey) {
+		add("public_key", "the request key", "a different "+cert.PublicKeyAlgorithm.String()+" key")
+	}
+
+	if csr != nil {
+		checkSubject(csr, cert, opts.Subject, add)
+		checkSANs(csr, cert, add)
+	}
+
+	if opts.Roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, c := range bundle.Chain {
+			intermediates.AddCert(c)
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         opts.Roots,
+			Intermediates: intermediates,
+			CurrentTime:   opts.Now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			add("chain", "a path to the trust bundle", err.Error())
+		}
+	}
+
+	switch {
+	case !cert.NotAfter.After(cert.NotBefore):
+		add("validity", "not_after after not_before", fmt.Sprintf("%s to %s", stamp(cert.NotBefore), stamp(cert.NotAfter)))
+	case opts.Now.Add(opts.ClockSkew).Before(cert.NotBefore):
+		add("not_before", "at or before "+stamp(opts.Now), stamp(cert.NotBefore))
+	case !opts.Now.Before(cert.NotAfter):
+		add("not_after", "after "+stamp(opts.Now), stamp(cert.NotAfter))
+	}
+
+	if cert.IsCA {
+		add("basic_constraints", "an end-entity certificate", "a CA certificate")
+	}
+	if cert.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+		add("key_usage", "no certificate or CRL signing", keyUsageString(cert.KeyUsage))
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		_, isRSA := cert.PublicKey.(*rsa.PublicKey)
+		if !isRSA || cert.KeyUsage&x509.KeyUsageKeyEncipherment == 0 {
+			add("key_usage", "digital_signature", keyUsageString(cert.KeyUsage))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &Error{Mismatches: errs}
+	}
+	return nil
+}
+
+// checkSubject reports every subject attribute of the CSR that the certificate
+// does not carry, or only the common name in SubjectCN mode.
+func checkSubject(csr *x509.CertificateRequest, cert *x509.Certificate, mode string, add func(field, want, got string)) {
+	if mode == SubjectNone {
+		return
+	}
+	want, got := csr.Subject, cert.Subject
+	if want.CommonName != "" && want.CommonName != got.CommonName {
+		add("subject.common_name", quote(want.CommonName), quote(got.CommonName))
+	}
+	if mode == SubjectCN {
+		return
+	}
+	for _, f := range []struct {
+		field     string
+		want, got []string
+	}{
+		{"subject.organization", want.Organization, got.Organization},
+		{"subject.organizational_unit", want.OrganizationalUnit, got.OrganizationalUnit},
+		{"subject.country", want.Country, got.Country},
+		{"subject.state", want.Province, got.Province},
+		{"subject.locality", want.Locality, got.Locality},
+	} {
+		if len(f.want) > 0 && !slices.Equal(f.want, f.got) {
+			add(f.field, list(f.want), list(f.got))
+		}
+	}
+}
+
+// checkSANs reports SAN lists that differ between the CSR and the certificate.
+// A DNS name equal to the common name may be added by the CA.
+func checkSANs(csr *x509.CertificateRequest, cert *x509.Certificate, add func(field, want, got string)) {
+	dns := slices.DeleteFunc(slices.Clone(cert.DNSNames), func(name string) bool {
+		return strings.EqualFold(name, csr.Subject.CommonName) && !containsFold(csr.DNSNames, name)
+	})
+	for _, f := range []struct {
+		field     string
+		want, got []string
+	}{
+		{"dns_names", csr.DNSNames, dns},
+		{"ip_addresses", stringify(csr.IPAddresses), stringify(cert.IPAddresses)},
+		{"email_addresses", csr.EmailAddresses, cert.EmailAddresses},
+		{"uris", stringify(csr.URIs), stringify(cert.URIs)},
+	} {
+		if !sameSet(f.want, f.got) {
+			add(f.field, list(f.want), list(f.got))
+		}
+	}
+}
+
+// Roots reads the PEM certificates in paths into a pool of trust anchors.
+func Roots(paths []string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trust bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in trust bundle %s", path)
+		}
+	}
+	return pool, nil
+}
+
+// sameSet reports whether a and b hold the same values, ignoring order and case.
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, v := range a {
+		if !containsFold(b, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, v string) bool {
+	return slices.ContainsFunc(list, func(s string) bool { return strings.EqualFold(s, v) })
+}
+
+func stringify[T fmt.Stringer](values []T) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = v.String()
+	}
+	return out
+}
+
+func quote(s string) string {
+	return fmt.Sprintf("%q", s)
+}
+
+func list(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+func stamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func keyUsageString(ku x509.KeyUsage) string {
+	return list(certs.KeyUsageNames(ku))
+}
@@ -0,0 +1,266 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dstout-devops/hephaestus/internal/certs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// testCA is a throwaway root that issues leaf certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCA creates a self-signed root valid around now.
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue signs a leaf for pub from tmpl, filling in the serial and issuer.
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate, pub crypto.PublicKey) *certs.Bundle {
+	t.Helper()
+	tmpl.SerialNumber = big.NewInt(2)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, pub, ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &certs.Bundle{Certificate: cert, Chain: []*x509.Certificate{ca.cert}}
+}
+
+// leafTemplate returns a certificate template matching testRequest.
+func leafTemplate() *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "test.com", Organization: []string{"Example"}},
+		DNSNames:    []string{"test.com", "www.test.com"},
+		IPAddresses: []net.IP{net.ParseIP("192.0.2.1")},
+		NotBefore:   now.Add(-time.Minute),
+		NotAfter:    now.Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+}
+
+// testRequest returns a CSR for key with a subject and SANs.
+func testRequest(t *testing.T, key crypto.Signer) *x509.CertificateRequest {
+	t.Helper()
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: "test.com", Organization: []string{"Example"}},
+		DNSNames:    []string{"www.test.com", "test.com"},
+		IPAddresses: []net.IP{net.ParseIP("192.0.2.1")},
+	}, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+	return csr
+}
+
+// TestCertificate tests that a certificate matching the request passes.
+func TestCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	bundle := ca.issue(t, leafTemplate(), &key.PublicKey)
+	assert.NoError(t, Certificate(bundle, &key.PublicKey, testRequest(t, key), Options{Roots: roots, Now: now}))
+	assert.NoError(t, Certificate(bundle, &key.PublicKey, nil, Options{Now: now}), "Without a CSR only the key and certificate should be checked")
+
+	tmpl := leafTemplate()
+	req, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: "test.com"},
+		DNSNames:    []string{"www.test.com"},
+		IPAddresses: []net.IP{net.ParseIP("192.0.2.1")},
+	}, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(req)
+	require.NoError(t, err)
+	tmpl.DNSNames = []string{"TEST.com", "www.test.com"}
+	assert.NoError(t, Certificate(ca.issue(t, tmpl, &key.PublicKey), &key.PublicKey, csr, Options{Now: now}), "The CA may add the common name as a DNS SAN")
+}
+
+// TestCertificate_Mismatches tests that each kind of mismatch is reported.
+func TestCertificate_Mismatches(t *testing.T) {
+	ca := newTestCA(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(newTestCA(t).cert)
+
+	tests := map[string]struct {
+		edit    func(*x509.Certificate)
+		pub     crypto.PublicKey
+		roots   *x509.CertPool
+		noChain bool // The chain check would also fail, as it covers validity
+		wantErr string
+	}{
+		"public key": {
+			pub:     &other.PublicKey,
+			wantErr: "public_key: want the request key, got a different ECDSA key",
+		},
+		"common name": {
+			edit:    func(c *x509.Certificate) { c.Subject.CommonName = "other.com" },
+			wantErr: `subject.common_name: want "test.com", got "other.com"`,
+		},
+		"organization": {
+			edit:    func(c *x509.Certificate) { c.Subject.Organization = nil },
+			wantErr: "subject.organization: want [Example], got none",
+		},
+		"dns names": {
+			edit:    func(c *x509.Certificate) { c.DNSNames = []string{"test.com", "evil.com"} },
+			wantErr: "dns_names: want [www.test.com, test.com], got [test.com, evil.com]",
+		},
+		"ip addresses": {
+			edit:    func(c *x509.Certificate) { c.IPAddresses = nil },
+			wantErr: "ip_addresses: want [192.0.2.1], got none",
+		},
+		"untrusted": {
+			roots:   otherRoots,
+			wantErr: "chain: want a path to the trust bundle, got x509: certificate signed by unknown authority",
+		},
+		"not yet valid": {
+			edit:    func(c *x509.Certificate) { c.NotBefore = now.Add(10 * time.Minute) },
+			noChain: true,
+			wantErr: "not_before: want at or before 2026-06-01T12:00:00Z, got 2026-06-01T12:10:00Z",
+		},
+		"expired": {
+			edit: func(c *x509.Certificate) {
+				c.NotBefore, c.NotAfter = now.Add(-2*time.Hour), now.Add(-time.Hour)
+			},
+			noChain: true,
+			wantErr: "not_after: want after 2026-06-01T12:00:00Z, got 2026-06-01T11:00:00Z",
+		},
+		"ca": {
+			edit:    func(c *x509.Certificate) { c.IsCA, c.BasicConstraintsValid = true, true },
+			wantErr: "basic_constraints: want an end-entity certificate, got a CA certificate",
+		},
+		"cert sign": {
+			edit:    func(c *x509.Certificate) { c.KeyUsage |= x509.KeyUsageCertSign },
+			wantErr: "key_usage: want no certificate or CRL signing, got [digital_signature, cert_sign]",
+		},
+		"no digital signature": {
+			edit:    func(c *x509.Certificate) { c.KeyUsage = x509.KeyUsageKeyEncipherment },
+			wantErr: "key_usage: want digital_signature, got [key_encipherment]",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpl := leafTemplate()
+			if tt.edit != nil {
+				tt.edit(tmpl)
+			}
+			pub := tt.pub
+			if pub == nil {
+				pub = &key.PublicKey
+			}
+			opts := Options{Roots: roots, Now: now, ClockSkew: 5 * time.Minute}
+			if tt.roots != nil {
+				opts.Roots = tt.roots
+			}
+			if tt.noChain {
+				opts.Roots = nil
+			}
+			err := Certificate(ca.issue(t, tmpl, &key.PublicKey), pub, testRequest(t, key), opts)
+			require.Error(t, err)
+			var verr *Error
+			require.ErrorAs(t, err, &verr)
+			assert.Len(t, verr.Mismatches, 1, "Expected only the introduced mismatch: %v", err)
+			assert.Contains(t, err.Error(), "issued certificate does not match the request:\n  "+tt.wantErr)
+		})
+	}
+}
+
+// TestCertificate_SubjectModes tests that the subject check honours Options.Subject.
+func TestCertificate_SubjectModes(t *testing.T) {
+	ca := newTestCA(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	csr := testRequest(t, key)
+
+	tmpl := leafTemplate()
+	tmpl.Subject.Organization = nil
+	dropped := ca.issue(t, tmpl, &key.PublicKey)
+	tmpl.Subject.CommonName = "other.com"
+	renamed := ca.issue(t, tmpl, &key.PublicKey)
+
+	tests := map[string]struct {
+		bundle  *certs.Bundle
+		mode    string
+		wantErr string
+	}{
+		"default":     {dropped, "", "subject.organization: want [Example], got none"},
+		"strict":      {dropped, SubjectStrict, "subject.organization: want [Example], got none"},
+		"cn":          {dropped, SubjectCN, ""},
+		"cn mismatch": {renamed, SubjectCN, `subject.common_name: want "test.com", got "other.com"`},
+		"none":        {renamed, SubjectNone, ""},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := Certificate(tt.bundle, &key.PublicKey, csr, Options{Now: now, Subject: tt.mode})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestRoots tests loading trust bundles.
+func TestRoots(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	bundle := filepath.Join(dir, "root.pem")
+	require.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0644))
+	empty := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(empty, []byte("not a certificate"), 0644))
+
+	want := x509.NewCertPool()
+	want.AddCert(ca.cert)
+	pool, err := Roots([]string{bundle})
+	require.NoError(t, err)
+	assert.True(t, want.Equal(pool), "Expected the bundle certificate in the pool")
+
+	_, err = Roots([]string{filepath.Join(dir, "missing.pem")})
+	assert.ErrorContains(t, err, "failed to read trust bundle")
+	_, err = Roots([]string{empty})
+	assert.ErrorContains(t, err, "no certificates found in trust bundle "+empty)
+}